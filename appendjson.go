@@ -0,0 +1,392 @@
+package gojsonrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+)
+
+// The AppendJSON methods append the same bytes as json.Marshal would produce
+// for a message, without going through reflection for the message itself or
+// for the types encoding/json produces when parsing (nil, bool, string,
+// float64, json.Number, []interface{}, map[string]interface{}), json.RawMessage
+// and the basic Go types. Other params, results and error data are passed to
+// json.Marshal.
+
+// AppendJSON appends the JSON encoding of r to dst.
+func (r *Request) AppendJSON(dst []byte) ([]byte, error) {
+	if r.JSONRPCVersion() == Version1 {
+		return appendMessageV1(dst, r.Method(), r.Params(), &r.requestData.ID)
+	}
+
+	dst = append(dst, `{"jsonrpc":`...)
+	dst = appendJSONString(dst, r.requestData.Jsonrpc)
+	dst = append(dst, `,"method":`...)
+	dst = appendJSONString(dst, r.Method())
+
+	var err error
+	if r.Params() != nil {
+		dst = append(dst, `,"params":`...)
+		if dst, err = appendJSONValue(dst, r.Params()); err != nil {
+			return nil, err
+		}
+	}
+
+	dst = append(dst, `,"id":`...)
+	dst = strconv.AppendUint(dst, uint64(r.ID()), 10)
+	return append(dst, '}'), nil
+}
+
+// AppendJSON appends the JSON encoding of n to dst.
+func (n *Notification) AppendJSON(dst []byte) ([]byte, error) {
+	if n.JSONRPCVersion() == Version1 {
+		return appendMessageV1(dst, n.Method(), n.Params(), nil)
+	}
+
+	dst = append(dst, `{"jsonrpc":`...)
+	dst = appendJSONString(dst, n.notificationData.Jsonrpc)
+	dst = append(dst, `,"method":`...)
+	dst = appendJSONString(dst, n.Method())
+
+	var err error
+	if n.Params() != nil {
+		dst = append(dst, `,"params":`...)
+		if dst, err = appendJSONValue(dst, n.Params()); err != nil {
+			return nil, err
+		}
+	}
+
+	return append(dst, '}'), nil
+}
+
+// AppendJSON appends the JSON encoding of r to dst.
+func (r *Response) AppendJSON(dst []byte) ([]byte, error) {
+	var err error
+
+	if r.JSONRPCVersion() == Version1 {
+		dst = append(dst, `{"result":`...)
+		if dst, err = appendJSONValue(dst, r.Result()); err != nil {
+			return nil, err
+		}
+		dst = append(dst, `,"error":`...)
+		if dst, err = r.Error().AppendJSON(dst); err != nil {
+			return nil, err
+		}
+		dst = append(dst, `,"id":`...)
+		return append(appendJSONID(dst, r.responseData.ID), '}'), nil
+	}
+
+	dst = append(dst, `{"jsonrpc":`...)
+	dst = appendJSONString(dst, r.responseData.Jsonrpc)
+
+	// As in MarshalJSON, a nil result is kept as null in result Responses.
+	if r.Result() != nil || r.IsResult() {
+		dst = append(dst, `,"result":`...)
+		if dst, err = appendJSONValue(dst, r.Result()); err != nil {
+			return nil, err
+		}
+	}
+	if r.Error() != nil && !(r.IsResult() && r.Result() == nil) {
+		dst = append(dst, `,"error":`...)
+		if dst, err = r.Error().AppendJSON(dst); err != nil {
+			return nil, err
+		}
+	}
+
+	dst = append(dst, `,"id":`...)
+	return append(appendJSONID(dst, r.responseData.ID), '}'), nil
+}
+
+// AppendJSON appends the JSON encoding of e to dst. A nil e appends null.
+func (e *Error) AppendJSON(dst []byte) ([]byte, error) {
+	if e == nil {
+		return append(dst, "null"...), nil
+	}
+
+	dst = append(dst, `{"code":`...)
+	dst = strconv.AppendInt(dst, int64(e.Code()), 10)
+	dst = append(dst, `,"message":`...)
+	dst = appendJSONString(dst, e.Message())
+
+	var err error
+	if e.Data() != nil {
+		dst = append(dst, `,"data":`...)
+		if dst, err = appendJSONValue(dst, e.Data()); err != nil {
+			return nil, err
+		}
+	}
+
+	return append(dst, '}'), nil
+}
+
+func appendMessageV1(dst []byte, method string, params interface{}, id *uint) ([]byte, error) {
+	dst = append(dst, `{"method":`...)
+	dst = appendJSONString(dst, method)
+	dst = append(dst, `,"params":`...)
+
+	var err error
+	if dst, err = appendJSONValue(dst, paramsV1(params)); err != nil {
+		return nil, err
+	}
+
+	dst = append(dst, `,"id":`...)
+	return append(appendJSONID(dst, id), '}'), nil
+}
+
+func appendJSONID(dst []byte, id *uint) []byte {
+	if id == nil {
+		return append(dst, "null"...)
+	}
+
+	return strconv.AppendUint(dst, uint64(*id), 10)
+}
+
+func appendJSONValue(dst []byte, v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case nil:
+		return append(dst, "null"...), nil
+	case bool:
+		return strconv.AppendBool(dst, v), nil
+	case string:
+		return appendJSONString(dst, v), nil
+	case float64:
+		return appendJSONFloat(dst, v, 64)
+	case float32:
+		return appendJSONFloat(dst, float64(v), 32)
+	case int:
+		return strconv.AppendInt(dst, int64(v), 10), nil
+	case int8:
+		return strconv.AppendInt(dst, int64(v), 10), nil
+	case int16:
+		return strconv.AppendInt(dst, int64(v), 10), nil
+	case int32:
+		return strconv.AppendInt(dst, int64(v), 10), nil
+	case int64:
+		return strconv.AppendInt(dst, v, 10), nil
+	case uint:
+		return strconv.AppendUint(dst, uint64(v), 10), nil
+	case uint8:
+		return strconv.AppendUint(dst, uint64(v), 10), nil
+	case uint16:
+		return strconv.AppendUint(dst, uint64(v), 10), nil
+	case uint32:
+		return strconv.AppendUint(dst, uint64(v), 10), nil
+	case uint64:
+		return strconv.AppendUint(dst, v, 10), nil
+	case json.Number:
+		if v == "" {
+			return append(dst, '0'), nil
+		}
+		if !isValidJSONNumber(string(v)) {
+			break
+		}
+		return append(dst, v...), nil
+	case json.RawMessage:
+		if v == nil {
+			return append(dst, "null"...), nil
+		}
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, v); err != nil {
+			break
+		}
+		out := bytes.NewBuffer(dst)
+		json.HTMLEscape(out, buf.Bytes())
+		return out.Bytes(), nil
+	case []interface{}:
+		if v == nil {
+			return append(dst, "null"...), nil
+		}
+		dst = append(dst, '[')
+		for i, elem := range v {
+			if i > 0 {
+				dst = append(dst, ',')
+			}
+			var err error
+			if dst, err = appendJSONValue(dst, elem); err != nil {
+				return nil, err
+			}
+		}
+		return append(dst, ']'), nil
+	case []string:
+		if v == nil {
+			return append(dst, "null"...), nil
+		}
+		dst = append(dst, '[')
+		for i, elem := range v {
+			if i > 0 {
+				dst = append(dst, ',')
+			}
+			dst = appendJSONString(dst, elem)
+		}
+		return append(dst, ']'), nil
+	case map[string]interface{}:
+		if v == nil {
+			return append(dst, "null"...), nil
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		dst = append(dst, '{')
+		for i, k := range keys {
+			if i > 0 {
+				dst = append(dst, ',')
+			}
+			dst = append(appendJSONString(dst, k), ':')
+			var err error
+			if dst, err = appendJSONValue(dst, v[k]); err != nil {
+				return nil, err
+			}
+		}
+		return append(dst, '}'), nil
+	}
+
+	// Anything else, including invalid json.Numbers and json.RawMessages so
+	// that the error matches json.Marshal's.
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return append(dst, raw...), nil
+}
+
+// appendJSONFloat formats f as encoding/json does.
+func appendJSONFloat(dst []byte, f float64, bits int) ([]byte, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil, &json.UnsupportedValueError{Str: strconv.FormatFloat(f, 'g', -1, bits)}
+	}
+
+	abs := math.Abs(f)
+	format := byte('f')
+	if abs != 0 {
+		if bits == 64 && (abs < 1e-6 || abs >= 1e21) || bits == 32 && (float32(abs) < 1e-6 || float32(abs) >= 1e21) {
+			format = 'e'
+		}
+	}
+
+	dst = strconv.AppendFloat(dst, f, format, -1, bits)
+	if format == 'e' {
+		// Clean up e-09 to e-9.
+		n := len(dst)
+		if n >= 4 && dst[n-4] == 'e' && dst[n-3] == '-' && dst[n-2] == '0' {
+			dst[n-2] = dst[n-1]
+			dst = dst[:n-1]
+		}
+	}
+
+	return dst, nil
+}
+
+// appendJSONString quotes s as encoding/json does, including its escaping of
+// HTML characters, U+2028 and U+2029, and replacement of invalid UTF-8.
+func appendJSONString(dst []byte, s string) []byte {
+	const hex = "0123456789abcdef"
+
+	dst = append(dst, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		if c := s[i]; c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' && c != '<' && c != '>' && c != '&' {
+				i++
+				continue
+			}
+
+			dst = append(dst, s[start:i]...)
+			switch c {
+			case '"', '\\':
+				dst = append(dst, '\\', c)
+			case '\b':
+				dst = append(dst, '\\', 'b')
+			case '\f':
+				dst = append(dst, '\\', 'f')
+			case '\n':
+				dst = append(dst, '\\', 'n')
+			case '\r':
+				dst = append(dst, '\\', 'r')
+			case '\t':
+				dst = append(dst, '\\', 't')
+			default:
+				dst = append(dst, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xf])
+			}
+			i++
+			start = i
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			dst = append(dst, s[start:i]...)
+			dst = append(dst, "\ufffd"...)
+			i += size
+			start = i
+			continue
+		}
+		if r == '\u2028' || r == '\u2029' {
+			dst = append(dst, s[start:i]...)
+			dst = append(dst, '\\', 'u', '2', '0', '2', hex[r&0xf])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+
+	dst = append(dst, s[start:]...)
+	return append(dst, '"')
+}
+
+// isValidJSONNumber reports whether s is a valid JSON number literal.
+func isValidJSONNumber(s string) bool {
+	if s == "" {
+		return false
+	}
+
+	if s[0] == '-' {
+		s = s[1:]
+		if s == "" {
+			return false
+		}
+	}
+
+	// Integer part.
+	switch {
+	case s[0] == '0':
+		s = s[1:]
+	case '1' <= s[0] && s[0] <= '9':
+		s = s[1:]
+		for len(s) > 0 && '0' <= s[0] && s[0] <= '9' {
+			s = s[1:]
+		}
+	default:
+		return false
+	}
+
+	// Fraction.
+	if len(s) >= 2 && s[0] == '.' && '0' <= s[1] && s[1] <= '9' {
+		s = s[2:]
+		for len(s) > 0 && '0' <= s[0] && s[0] <= '9' {
+			s = s[1:]
+		}
+	}
+
+	// Exponent.
+	if len(s) >= 2 && (s[0] == 'e' || s[0] == 'E') {
+		s = s[1:]
+		if s[0] == '+' || s[0] == '-' {
+			s = s[1:]
+			if s == "" {
+				return false
+			}
+		}
+		for len(s) > 0 && '0' <= s[0] && s[0] <= '9' {
+			s = s[1:]
+		}
+	}
+
+	return s == ""
+}
@@ -0,0 +1,224 @@
+package gojsonrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+)
+
+type testAppendJSONMarshaler interface {
+	Message
+	AppendJSON(dst []byte) ([]byte, error)
+}
+
+var testAppendJSONValues = []interface{}{
+	nil,
+	true,
+	"",
+	"plain",
+	"quotes \" and \\ backslashes",
+	"control \b\f\n\r\t\x00\x1f\x7f",
+	"html <script>&</script>",
+	"unicode é 😀    ",
+	"invalid \xff utf-8 \xe2\x82",
+	0.0,
+	math.Copysign(0, -1),
+	1.0,
+	-1.5,
+	1e20,
+	1e21,
+	1e-6,
+	1e-7,
+	123456789.123456789,
+	float32(0.1),
+	float32(1e21),
+	float32(1e-7),
+	int(-1), int8(-8), int16(-16), int32(-32), int64(math.MinInt64),
+	uint(1), uint8(8), uint16(16), uint32(32), uint64(math.MaxUint64),
+	json.Number("12345678901234567890"),
+	json.Number("-1.5e-10"),
+	json.Number(""),
+	json.RawMessage(` { "a" : [1, 2] , "b":"<&>" } `),
+	json.RawMessage(nil),
+	[]interface{}{},
+	[]interface{}(nil),
+	[]interface{}{1.0, "a", nil, []interface{}{true}},
+	[]string{"a", "<b>"},
+	[]string(nil),
+	map[string]interface{}{},
+	map[string]interface{}(nil),
+	map[string]interface{}{"z": 1.0, "a": "x", "m": map[string]interface{}{"<": nil}},
+	[]int{1, 2},
+	map[int]string{2: "b", 1: "a"},
+	&struct {
+		Field1 string `json:"key1"`
+		Field2 *int   `json:"key2,omitempty"`
+	}{"test", nil},
+	time.Date(2016, 8, 3, 0, 0, 0, 0, time.UTC),
+}
+
+func testAppendJSONMessages(t testing.TB) []testAppendJSONMarshaler {
+	var msgs []testAppendJSONMarshaler
+	add := func(msg testAppendJSONMarshaler, err error) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		msgs = append(msgs, msg)
+	}
+	addResp := func(msg *Response, err error) {
+		add(msg, err)
+	}
+
+	add(MakeRequest("test", nil, 0))
+	add(MakeRequest("méthod <&>", nil, ^uint(0)))
+	add(MakeNotification("test", nil))
+	add(MakeRequestV1("test", nil, 1))
+	add(MakeNotificationV1("test", nil))
+	add(MakeResponseWithResult(nil, 1), nil)
+	addResp(MakeResponseWithError(MakeError(-32600, "Invalid Request", nil), 2))
+	add(ErrorResponseFor([]byte(`{`), InvalidMessage), nil)
+
+	req, _ := MakeRequestV1("test", nil, 3)
+	add(req.MakeResponseWithResult(nil), nil)
+	addResp(req.MakeResponseWithError(MakeError(1, "failed", []interface{}{1})))
+
+	for _, v := range testAppendJSONValues {
+		params := []interface{}{v}
+		add(MakeRequest("test", params, 1))
+		add(MakeNotification("test", map[string]interface{}{"v": v}))
+		add(MakeRequestV1("test", params, 1))
+		add(MakeResponseWithResult(v, 1), nil)
+		addResp(MakeResponseWithError(MakeError(-1, "error", v), 1))
+
+		resp := req.MakeResponseWithResult(v)
+		add(resp, nil)
+	}
+
+	for _, raw := range testCodecMessages {
+		msg, err := (&Parser{UseNumber: true}).ParseIncoming(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		add(msg.(testAppendJSONMarshaler), nil)
+	}
+
+	return msgs
+}
+
+func TestAppendJSONMatchesEncodingJSON(t *testing.T) {
+	for _, msg := range testAppendJSONMessages(t) {
+		expected, expectedErr := json.Marshal(msg)
+		got, err := msg.AppendJSON(nil)
+
+		if (err == nil) != (expectedErr == nil) {
+			t.Errorf("%#v: expected error %v got %v", msg, expectedErr, err)
+		} else if !bytes.Equal(expected, got) {
+			t.Errorf("expected %s got %s", expected, got)
+		}
+	}
+}
+
+func TestAppendJSONAppends(t *testing.T) {
+	r, err := MakeRequest(testRequestMethod, nil, testRequestId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := r.AppendJSON([]byte("prefix "))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `prefix {"jsonrpc":"2.0","method":"test","id":1}`
+	if string(got) != expected {
+		t.Errorf("expected %s got %s", expected, got)
+	}
+}
+
+func TestAppendJSONErrors(t *testing.T) {
+	values := []interface{}{
+		math.NaN(),
+		math.Inf(1),
+		[]interface{}{math.Inf(-1)},
+		json.Number("1.2.3"),
+		json.RawMessage(`{`),
+		make(chan int),
+	}
+
+	for _, v := range values {
+		r := MakeResponseWithResult(v, 1)
+		if _, err := r.AppendJSON(nil); err == nil {
+			t.Errorf("%#v: should have returned an error", v)
+		}
+	}
+}
+
+func TestIsValidJSONNumber(t *testing.T) {
+	valid := []string{"0", "-0", "1", "-12", "1.5", "0.5", "1e5", "1E+5", "1e-05", "-1.5e10"}
+	invalid := []string{"", "-", "01", "+1", "1.", ".5", "1e", "1e+", "0x1", "1.5.5", "NaN"}
+
+	for _, s := range valid {
+		if !isValidJSONNumber(s) {
+			t.Errorf("%s should be valid", s)
+		}
+	}
+	for _, s := range invalid {
+		if isValidJSONNumber(s) {
+			t.Errorf("%s should be invalid", s)
+		}
+	}
+}
+
+func testBenchmarkResponse() *Response {
+	return MakeResponseWithResult(map[string]interface{}{
+		"account": json.Number("12345678901234567890"),
+		"balance": 1234.5,
+		"history": []interface{}{"a", "b", "c", 1.0, 2.0, 3.0, true, nil},
+		"owner":   "test <user>",
+	}, 1)
+}
+
+func BenchmarkResponseMarshalJSON(b *testing.B) {
+	r := testBenchmarkResponse()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := json.Marshal(r); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkResponseAppendJSON(b *testing.B) {
+	r := testBenchmarkResponse()
+	buf := make([]byte, 0, 1024)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var err error
+		if buf, err = r.AppendJSON(buf[:0]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRequestMarshalJSON(b *testing.B) {
+	r, _ := MakeRequest("test", []interface{}{"a", 1.0, true}, 1)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := json.Marshal(r); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRequestAppendJSON(b *testing.B) {
+	r, _ := MakeRequest("test", []interface{}{"a", 1.0, true}, 1)
+	buf := make([]byte, 0, 1024)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var err error
+		if buf, err = r.AppendJSON(buf[:0]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
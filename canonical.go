@@ -0,0 +1,283 @@
+package gojsonrpc
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// The CanonicalJSON methods encode messages using the JSON Canonicalization
+// Scheme (RFC 8785), so that messages holding the same values always encode to
+// the same bytes, whatever the Go types or map order used to build them. In
+// particular:
+//
+//   - object members are sorted by the UTF-16 code units of their names;
+//   - there is no whitespace;
+//   - numbers are written as ECMAScript would write the nearest float64, so 1,
+//     1.0 and json.Number("1e0") all become 1;
+//   - strings are only escaped where JSON requires it.
+//
+// As in MarshalJSON, a nil Params is left out, and a null result is kept in
+// result Responses.
+
+// ErrNotCanonicalizable is returned when a value can't be represented under
+// RFC 8785: a number outside the float64 range, an integer that a float64 can't
+// hold exactly (such as most integers above 2^53), or a string that isn't valid
+// UTF-8.
+var ErrNotCanonicalizable = errors.New("value can't be canonicalized")
+
+// Batch is a list of messages sent together, encoded as a JSON array.
+type Batch []Message
+
+// CanonicalJSON returns the RFC 8785 encoding of r.
+func (r *Request) CanonicalJSON() ([]byte, error) {
+	return canonicalJSON(r)
+}
+
+// CanonicalJSON returns the RFC 8785 encoding of n.
+func (n *Notification) CanonicalJSON() ([]byte, error) {
+	return canonicalJSON(n)
+}
+
+// CanonicalJSON returns the RFC 8785 encoding of r.
+func (r *Response) CanonicalJSON() ([]byte, error) {
+	return canonicalJSON(r)
+}
+
+// CanonicalJSON returns the RFC 8785 encoding of b. The order of the messages
+// is kept.
+func (b Batch) CanonicalJSON() ([]byte, error) {
+	return canonicalJSON([]Message(b))
+}
+
+func canonicalJSON(v interface{}) ([]byte, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	// json.Marshal has already replaced invalid UTF-8 in strings it encoded
+	// itself, but json.RawMessage and Marshalers are copied as is.
+	if !utf8.Valid(raw) {
+		return nil, ErrNotCanonicalizable
+	}
+
+	tree, err := unmarshalUseNumber(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	return appendCanonical(nil, tree)
+}
+
+func appendCanonical(dst []byte, v interface{}) ([]byte, error) {
+	var err error
+
+	switch v := v.(type) {
+	case nil:
+		return append(dst, "null"...), nil
+	case bool:
+		return strconv.AppendBool(dst, v), nil
+	case string:
+		return appendCanonicalString(dst, v), nil
+	case json.Number:
+		f, err := strconv.ParseFloat(string(v), 64)
+		if err != nil || !isExactFloat(string(v), f) {
+			return nil, ErrNotCanonicalizable
+		}
+		return appendCanonicalNumber(dst, f)
+	case []interface{}:
+		dst = append(dst, '[')
+		for i, elem := range v {
+			if i > 0 {
+				dst = append(dst, ',')
+			}
+			if dst, err = appendCanonical(dst, elem); err != nil {
+				return nil, err
+			}
+		}
+		return append(dst, ']'), nil
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return lessUTF16(keys[i], keys[j])
+		})
+
+		dst = append(dst, '{')
+		for i, k := range keys {
+			if i > 0 {
+				dst = append(dst, ',')
+			}
+			dst = append(appendCanonicalString(dst, k), ':')
+			if dst, err = appendCanonical(dst, v[k]); err != nil {
+				return nil, err
+			}
+		}
+		return append(dst, '}'), nil
+	}
+
+	return nil, ErrNotCanonicalizable
+}
+
+// lessUTF16 compares a and b by their UTF-16 code units. This only differs
+// from comparing their bytes when characters above U+FFFF are compared with
+// characters between U+E000 and U+FFFF.
+func lessUTF16(a, b string) bool {
+	ua, ub := utf16.Encode([]rune(a)), utf16.Encode([]rune(b))
+	for i := 0; i < len(ua) && i < len(ub); i++ {
+		if ua[i] != ub[i] {
+			return ua[i] < ub[i]
+		}
+	}
+
+	return len(ua) < len(ub)
+}
+
+// appendCanonicalString quotes s, escaping only '"', '\\' and control
+// characters.
+func appendCanonicalString(dst []byte, s string) []byte {
+	const hex = "0123456789abcdef"
+
+	dst = append(dst, '"')
+	start := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= 0x20 && c != '"' && c != '\\' {
+			continue
+		}
+
+		dst = append(dst, s[start:i]...)
+		switch c {
+		case '"', '\\':
+			dst = append(dst, '\\', c)
+		case '\b':
+			dst = append(dst, '\\', 'b')
+		case '\f':
+			dst = append(dst, '\\', 'f')
+		case '\n':
+			dst = append(dst, '\\', 'n')
+		case '\r':
+			dst = append(dst, '\\', 'r')
+		case '\t':
+			dst = append(dst, '\\', 't')
+		default:
+			dst = append(dst, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xf])
+		}
+		start = i + 1
+	}
+
+	dst = append(dst, s[start:]...)
+	return append(dst, '"')
+}
+
+// isExactFloat tells whether the JSON number s, if it is an integer, has the
+// same value as f, the float64 it was parsed into, once f is formatted with the
+// shortest digits that round trip. Fractions are rounded to the closest
+// float64, as RFC 8785 requires.
+func isExactFloat(s string, f float64) bool {
+	neg, digits, exp, ok := splitDecimal(s)
+	if !ok {
+		return false
+	}
+	if f == 0 {
+		return digits == ""
+	}
+	if exp < 0 {
+		return true
+	}
+
+	fneg, fdigits, fexp, _ := splitDecimal(strconv.FormatFloat(f, 'e', -1, 64))
+	return neg == fneg && digits == fdigits && exp == fexp
+}
+
+// splitDecimal splits the decimal number s into its sign, its significant
+// digits without leading or trailing zeros, and the power of ten of the last
+// of them.
+func splitDecimal(s string) (neg bool, digits string, exp int, ok bool) {
+	if strings.HasPrefix(s, "-") {
+		neg, s = true, s[1:]
+	}
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		x, err := strconv.Atoi(s[i+1:])
+		if err != nil {
+			return false, "", 0, false
+		}
+		exp, s = x, s[:i]
+	}
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		exp -= len(s) - i - 1
+		s = s[:i] + s[i+1:]
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false, "", 0, false
+		}
+	}
+
+	s = strings.TrimLeft(s, "0")
+	digits = strings.TrimRight(s, "0")
+	return neg, digits, exp + len(s) - len(digits), true
+}
+
+// appendCanonicalNumber formats f as ECMAScript's Number.prototype.toString
+// does.
+func appendCanonicalNumber(dst []byte, f float64) ([]byte, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil, ErrNotCanonicalizable
+	}
+	if f == 0 {
+		// Including -0.
+		return append(dst, '0'), nil
+	}
+	if f < 0 {
+		dst = append(dst, '-')
+		f = -f
+	}
+
+	// The shortest digits that round trip, d.ddde±x.
+	e := strconv.FormatFloat(f, 'e', -1, 64)
+	mantissa, exp := e[:strings.IndexByte(e, 'e')], e[strings.IndexByte(e, 'e')+1:]
+	digits := strings.Replace(mantissa, ".", "", 1)
+	x, _ := strconv.Atoi(exp)
+
+	// The decimal point goes after n digits.
+	n, k := x+1, len(digits)
+	switch {
+	case k <= n && n <= 21:
+		dst = append(dst, digits...)
+		for i := k; i < n; i++ {
+			dst = append(dst, '0')
+		}
+	case 0 < n && n <= 21:
+		dst = append(dst, digits[:n]...)
+		dst = append(dst, '.')
+		dst = append(dst, digits[n:]...)
+	case -6 < n && n <= 0:
+		dst = append(dst, '0', '.')
+		for i := n; i < 0; i++ {
+			dst = append(dst, '0')
+		}
+		dst = append(dst, digits...)
+	default:
+		dst = append(dst, digits[0])
+		if k > 1 {
+			dst = append(dst, '.')
+			dst = append(dst, digits[1:]...)
+		}
+		dst = append(dst, 'e')
+		if n-1 >= 0 {
+			dst = append(dst, '+')
+		}
+		dst = strconv.AppendInt(dst, int64(n-1), 10)
+	}
+
+	return dst, nil
+}
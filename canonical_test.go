@@ -0,0 +1,139 @@
+package gojsonrpc
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestCanonicalNumbers(t *testing.T) {
+	// From RFC 8785 appendix B.
+	tests := map[uint64]string{
+		0x0000000000000000: "0",
+		0x8000000000000000: "0",
+		0x0000000000000001: "5e-324",
+		0x8000000000000001: "-5e-324",
+		0x7fefffffffffffff: "1.7976931348623157e+308",
+		0xffefffffffffffff: "-1.7976931348623157e+308",
+		0x4340000000000000: "9007199254740992",
+		0xc340000000000000: "-9007199254740992",
+		0x4430000000000000: "295147905179352830000",
+		0x44b52d02c7e14af5: "9.999999999999997e+22",
+		0x44b52d02c7e14af6: "1e+23",
+		0x3eb0c6f7a0b5ed8d: "0.000001",
+		0x3eb0c6f7a0b5ed8c: "9.999999999999997e-7",
+		0x41b3de4355555555: "333333333.3333333",
+	}
+
+	for bits, expected := range tests {
+		got, err := appendCanonicalNumber(nil, math.Float64frombits(bits))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != expected {
+			t.Errorf("%016x: expected %s got %s", bits, expected, got)
+		}
+	}
+
+	for _, f := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		if _, err := appendCanonicalNumber(nil, f); err != ErrNotCanonicalizable {
+			t.Errorf("%v: expected %v got %v", f, ErrNotCanonicalizable, err)
+		}
+	}
+}
+
+func TestCanonicalJSON(t *testing.T) {
+	// The examples from RFC 8785 sections 3.2.2 and 3.2.3.
+	tests := []struct {
+		result   json.RawMessage
+		expected string
+	}{
+		{
+			json.RawMessage(`{
+				"numbers": [333333333.33333329, 1E30, 4.50, 2e-3, 0.000000000000000000000000001],
+				"string": "\u20ac$\u000F\u000aA'\u0042\u0022\u005c\\\"\/",
+				"literals": [null, true, false]
+			}`),
+			`{"literals":[null,true,false],"numbers":[333333333.3333333,1e+30,4.5,0.002,1e-27],"string":"€$\u000f\nA'B\"\\\\\"/"}`,
+		},
+		{
+			json.RawMessage(`{"\u20ac":"Euro Sign","\r":"Carriage Return","\ufb33":"Hebrew Letter Dalet With Dagesh","1":"One","\ud83d\ude00":"Emoji: Grinning Face","\u0080":"Control","\u00f6":"Latin Small Letter O With Diaeresis"}`),
+			"{\"\\r\":\"Carriage Return\",\"1\":\"One\",\"\u0080\":\"Control\",\"\u00f6\":\"Latin Small Letter O With Diaeresis\",\"\u20ac\":\"Euro Sign\",\"\U0001f600\":\"Emoji: Grinning Face\",\"\ufb33\":\"Hebrew Letter Dalet With Dagesh\"}",
+		},
+		{json.RawMessage(`"<&>\u2028"`), "\"<&>\u2028\""},
+		{json.RawMessage(`[9007199254740992, -0, 0e10, 1.0, 150e-1, 0.10000000000000001, 1E+30]`), `[9007199254740992,0,0,1,15,0.1,1e+30]`},
+	}
+
+	for _, test := range tests {
+		got, err := MakeResponseWithResult(test.result, 1).CanonicalJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := `{"id":1,"jsonrpc":"2.0","result":` + test.expected + `}`
+		if string(got) != expected {
+			t.Errorf("expected %s got %s", expected, got)
+		}
+	}
+}
+
+func TestCanonicalJSONIsDeterministic(t *testing.T) {
+	a, _ := MakeRequest("test", map[string]interface{}{"b": 1, "a": []interface{}{1.0, "x"}}, 1)
+	b, _ := MakeRequest("test", map[string]interface{}{"a": []interface{}{json.Number("1e0"), "x"}, "b": 1.0}, 1)
+	c, _ := MakeRequest("test", json.RawMessage(` { "b" : 1.00, "a" : [ 10e-1, "x" ] } `), 1)
+
+	expected := `{"id":1,"jsonrpc":"2.0","method":"test","params":{"a":[1,"x"],"b":1}}`
+	for _, r := range []*Request{a, b, c} {
+		got, err := r.CanonicalJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != expected {
+			t.Errorf("expected %s got %s", expected, got)
+		}
+	}
+}
+
+func TestCanonicalJSONMessages(t *testing.T) {
+	notif, _ := MakeNotification("test", nil)
+	req, _ := MakeRequestV1("test", nil, 2)
+	resp := MakeResponseWithResult(nil, 3)
+	errResp, _ := MakeResponseWithError(MakeError(-1, "failed", nil), 4)
+
+	tests := map[string]interface {
+		CanonicalJSON() ([]byte, error)
+	}{
+		`{"jsonrpc":"2.0","method":"test"}`:                                        notif,
+		`{"id":2,"method":"test","params":[]}`:                                     req,
+		`{"id":3,"jsonrpc":"2.0","result":null}`:                                   resp,
+		`[{"jsonrpc":"2.0","method":"test"},{"id":2,"method":"test","params":[]}]`: Batch{notif, req},
+		`{"error":{"code":-1,"message":"failed"},"id":4,"jsonrpc":"2.0"}`:          errResp,
+	}
+
+	for expected, msg := range tests {
+		got, err := msg.CanonicalJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != expected {
+			t.Errorf("expected %s got %s", expected, got)
+		}
+	}
+}
+
+func TestCanonicalJSONErrors(t *testing.T) {
+	values := []interface{}{
+		json.Number("1e400"),
+		json.Number("9007199254740993"),
+		json.Number("-18446744073709551615"),
+		json.Number("1e-400"),
+		json.Number("1000000000000000019884624838656"),
+		uint64(math.MaxUint64),
+		json.RawMessage("\"\xff\""),
+	}
+
+	for _, v := range values {
+		if _, err := MakeResponseWithResult(v, 1).CanonicalJSON(); err != ErrNotCanonicalizable {
+			t.Errorf("%#v: expected %v got %v", v, ErrNotCanonicalizable, err)
+		}
+	}
+}
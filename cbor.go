@@ -0,0 +1,387 @@
+package gojsonrpc
+
+import (
+	"encoding/json"
+	"math"
+	"math/big"
+	"strconv"
+)
+
+// CBORCodec encodes messages using CBOR (RFC 8949). The messages have the
+// same structure as their JSON counterparts: a map with the same keys and
+// values. Integers that don't fit in 64 bits are encoded as bignums (tags 2
+// and 3).
+type CBORCodec struct {
+	Parser Parser
+}
+
+// Encode converts msg to CBOR.
+func (c *CBORCodec) Encode(msg Message) ([]byte, error) {
+	tree, err := jsonTree(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	return appendCBOR(nil, tree)
+}
+
+// Decode converts data to JSON and parses it with c.Parser.
+func (c *CBORCodec) Decode(data []byte) (Message, error) {
+	r, err := newBinaryReader(data, &c.Parser)
+	if err != nil {
+		return nil, err
+	}
+
+	w := new(jsonWriter)
+	if err = r.cborToJSON(w); err != nil {
+		return nil, err
+	}
+	if r.pos != len(r.data) {
+		return nil, InvalidMessage
+	}
+
+	return c.Parser.ParseIncoming(w.String())
+}
+
+const (
+	cborUint = iota
+	cborNegInt
+	cborBytes
+	cborText
+	cborArray
+	cborMap
+	cborTag
+	cborSimple
+)
+
+const (
+	cborFalse      = 0xf4
+	cborTrue       = 0xf5
+	cborNull       = 0xf6
+	cborUndefined  = 0xf7
+	cborFloat16    = 0xf9
+	cborFloat32    = 0xfa
+	cborFloat64    = 0xfb
+	cborBreak      = 0xff
+	cborIndefinite = 31
+
+	cborTagPosBignum = 2
+	cborTagNegBignum = 3
+)
+
+func appendCBORHead(dst []byte, major byte, n uint64) []byte {
+	major <<= 5
+	switch {
+	case n < 24:
+		return append(dst, major|byte(n))
+	case n <= math.MaxUint8:
+		return append(dst, major|24, byte(n))
+	case n <= math.MaxUint16:
+		return appendUint(append(dst, major|25), n, 2)
+	case n <= math.MaxUint32:
+		return appendUint(append(dst, major|26), n, 4)
+	}
+
+	return appendUint(append(dst, major|27), n, 8)
+}
+
+func appendCBOR(dst []byte, v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case nil:
+		return append(dst, cborNull), nil
+	case bool:
+		if v {
+			return append(dst, cborTrue), nil
+		}
+		return append(dst, cborFalse), nil
+	case json.Number:
+		i, u, f, kind, err := jsonNumber(v)
+		if err != nil {
+			return nil, err
+		}
+		switch kind {
+		case 'i':
+			if i >= 0 {
+				return appendCBORHead(dst, cborUint, uint64(i)), nil
+			}
+			return appendCBORHead(dst, cborNegInt, uint64(-1-i)), nil
+		case 'u':
+			return appendCBORHead(dst, cborUint, u), nil
+		case 'f':
+			return appendUint(append(dst, cborFloat64), math.Float64bits(f), 8), nil
+		}
+		return appendCBORBignum(dst, string(v))
+	case string:
+		return append(appendCBORHead(dst, cborText, uint64(len(v))), v...), nil
+	case []interface{}:
+		dst = appendCBORHead(dst, cborArray, uint64(len(v)))
+		for _, elem := range v {
+			var err error
+			if dst, err = appendCBOR(dst, elem); err != nil {
+				return nil, err
+			}
+		}
+		return dst, nil
+	case map[string]interface{}:
+		dst = appendCBORHead(dst, cborMap, uint64(len(v)))
+		for _, k := range sortedKeys(v) {
+			dst = append(appendCBORHead(dst, cborText, uint64(len(k))), k...)
+
+			var err error
+			if dst, err = appendCBOR(dst, v[k]); err != nil {
+				return nil, err
+			}
+		}
+		return dst, nil
+	}
+
+	return nil, ErrUnsupportedValue
+}
+
+func appendCBORBignum(dst []byte, n string) ([]byte, error) {
+	b, ok := new(big.Int).SetString(n, 10)
+	if !ok {
+		return nil, ErrUnsupportedValue
+	}
+
+	tag := uint64(cborTagPosBignum)
+	if b.Sign() < 0 {
+		// Negative bignums hold -1-n.
+		tag = cborTagNegBignum
+		b.Neg(b).Sub(b, big.NewInt(1))
+	}
+
+	mag := b.Bytes()
+	dst = appendCBORHead(dst, cborTag, tag)
+	return append(appendCBORHead(dst, cborBytes, uint64(len(mag))), mag...), nil
+}
+
+// cborHead reads the initial byte of a data item and its argument. For
+// indefinite length items, indefinite is true and arg is 0.
+func (r *binaryReader) cborHead() (major, info byte, arg uint64, indefinite bool, err error) {
+	b, err := r.byte()
+	if err != nil {
+		return 0, 0, 0, false, err
+	}
+
+	major, info = b>>5, b&0x1f
+	switch {
+	case info < 24:
+		arg = uint64(info)
+	case info <= 27:
+		arg, err = r.uint(1 << (info - 24))
+	case info == cborIndefinite:
+		indefinite = true
+	default:
+		err = ErrUnsupportedValue
+	}
+
+	return major, info, arg, indefinite, err
+}
+
+// atBreak consumes the break that ends an indefinite length item, if it is
+// next.
+func (r *binaryReader) atBreak() bool {
+	if r.pos < len(r.data) && r.data[r.pos] == cborBreak {
+		r.pos++
+		return true
+	}
+
+	return false
+}
+
+// cborToJSON converts the next CBOR data item to JSON.
+func (r *binaryReader) cborToJSON(w *jsonWriter) error {
+	major, info, arg, indefinite, err := r.cborHead()
+	// Tags other than bignums don't change the JSON representation of their
+	// content. They are skipped in a loop, as they can be nested without
+	// bound.
+	for err == nil && major == cborTag && arg != cborTagPosBignum && arg != cborTagNegBignum {
+		major, info, arg, indefinite, err = r.cborHead()
+	}
+	if err != nil {
+		return err
+	}
+
+	switch major {
+	case cborUint:
+		w.WriteString(strconv.FormatUint(arg, 10))
+	case cborNegInt:
+		n := new(big.Int).SetUint64(arg)
+		w.WriteString(n.Neg(n).Sub(n, big.NewInt(1)).String())
+	case cborBytes, cborText:
+		s, err := r.cborString(major, arg, indefinite)
+		if err != nil {
+			return err
+		}
+		if major == cborBytes {
+			return w.writeBinary(s)
+		}
+		w.writeString(s)
+	case cborArray:
+		return r.cborArrayToJSON(w, arg, indefinite)
+	case cborMap:
+		return r.cborMapToJSON(w, arg, indefinite)
+	case cborTag:
+		return r.cborBignumToJSON(w, arg == cborTagNegBignum)
+	case cborSimple:
+		return r.cborSimpleToJSON(w, info, arg)
+	}
+
+	return nil
+}
+
+// cborString reads the content of a byte or text string, joining the chunks
+// of indefinite length strings.
+func (r *binaryReader) cborString(major byte, n uint64, indefinite bool) ([]byte, error) {
+	if !indefinite {
+		return r.next(n)
+	}
+
+	var s []byte
+	for !r.atBreak() {
+		chunkMajor, _, chunkLen, chunkIndefinite, err := r.cborHead()
+		if err != nil {
+			return nil, err
+		}
+		if chunkMajor != major || chunkIndefinite {
+			return nil, ErrUnsupportedValue
+		}
+
+		chunk, err := r.next(chunkLen)
+		if err != nil {
+			return nil, err
+		}
+		s = append(s, chunk...)
+	}
+
+	return s, nil
+}
+
+func (r *binaryReader) cborArrayToJSON(w *jsonWriter, n uint64, indefinite bool) error {
+	if err := r.enter(); err != nil {
+		return err
+	}
+
+	w.WriteByte('[')
+	for i := uint64(0); indefinite || i < n; i++ {
+		if indefinite && r.atBreak() {
+			break
+		}
+		if i > 0 {
+			w.WriteByte(',')
+		}
+		if err := r.cborToJSON(w); err != nil {
+			return err
+		}
+	}
+	w.WriteByte(']')
+
+	r.leave()
+	return nil
+}
+
+func (r *binaryReader) cborMapToJSON(w *jsonWriter, n uint64, indefinite bool) error {
+	if err := r.enter(); err != nil {
+		return err
+	}
+
+	w.WriteByte('{')
+	for i := uint64(0); indefinite || i < n; i++ {
+		if indefinite && r.atBreak() {
+			break
+		}
+		if i > 0 {
+			w.WriteByte(',')
+		}
+
+		// Keys must be text strings.
+		major, _, keyLen, keyIndefinite, err := r.cborHead()
+		if err != nil {
+			return err
+		}
+		if major != cborText {
+			return ErrUnsupportedValue
+		}
+		key, err := r.cborString(major, keyLen, keyIndefinite)
+		if err != nil {
+			return err
+		}
+		w.writeString(key)
+
+		w.WriteByte(':')
+		if err = r.cborToJSON(w); err != nil {
+			return err
+		}
+	}
+	w.WriteByte('}')
+
+	r.leave()
+	return nil
+}
+
+func (r *binaryReader) cborBignumToJSON(w *jsonWriter, negative bool) error {
+	major, _, n, indefinite, err := r.cborHead()
+	if err != nil {
+		return err
+	}
+	if major != cborBytes {
+		return ErrUnsupportedValue
+	}
+
+	mag, err := r.cborString(major, n, indefinite)
+	if err != nil {
+		return err
+	}
+
+	b := new(big.Int).SetBytes(mag)
+	if negative {
+		b.Neg(b).Sub(b, big.NewInt(1))
+	}
+	w.WriteString(b.String())
+	return nil
+}
+
+func (r *binaryReader) cborSimpleToJSON(w *jsonWriter, info byte, arg uint64) error {
+	switch info {
+	case cborFalse & 0x1f:
+		w.WriteString("false")
+	case cborTrue & 0x1f:
+		w.WriteString("true")
+	case cborNull & 0x1f, cborUndefined & 0x1f:
+		w.WriteString("null")
+	case cborFloat16 & 0x1f:
+		return w.writeFloat(float64(float16frombits(uint16(arg))), 32)
+	case cborFloat32 & 0x1f:
+		return w.writeFloat(float64(math.Float32frombits(uint32(arg))), 32)
+	case cborFloat64 & 0x1f:
+		return w.writeFloat(math.Float64frombits(arg), 64)
+	default:
+		// Other simple values, and breaks outside of indefinite length items.
+		return ErrUnsupportedValue
+	}
+
+	return nil
+}
+
+// float16frombits converts an IEEE 754 half precision float.
+func float16frombits(h uint16) float32 {
+	sign := uint32(h>>15) << 31
+	exp := uint32(h>>10) & 0x1f
+	frac := uint32(h) & 0x3ff
+
+	switch exp {
+	case 0:
+		// Zero or subnormal.
+		f := float32(frac) / (1 << 24)
+		if sign != 0 {
+			f = -f
+		}
+		return f
+	case 0x1f:
+		// Infinity or NaN.
+		return math.Float32frombits(sign | 0xff<<23 | frac<<13)
+	}
+
+	return math.Float32frombits(sign | (exp+127-15)<<23 | frac<<13)
+}
@@ -0,0 +1,165 @@
+package gojsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrUnexpectedResponse is returned by Client.Call when the reply isn't a
+// Response to the request that was sent.
+var ErrUnexpectedResponse = errors.New("unexpected response")
+
+// RoundTripper sends encoded messages to a server. For a Request, RoundTrip
+// returns the encoded Response. For a Notification, the returned data is
+// ignored.
+type RoundTripper interface {
+	RoundTrip(ctx context.Context, message []byte) ([]byte, error)
+}
+
+// RoundTripperFunc adapts a function to the RoundTripper interface.
+type RoundTripperFunc func(ctx context.Context, message []byte) ([]byte, error)
+
+// RoundTrip calls f.
+func (f RoundTripperFunc) RoundTrip(ctx context.Context, message []byte) ([]byte, error) {
+	return f(ctx, message)
+}
+
+// CallHandler sends a request and returns its response, which may be an error
+// Response. Errors returned are those of the transport.
+type CallHandler func(ctx context.Context, req *Request) (*Response, error)
+
+// Interceptor wraps the CallHandler of a Client, e.g. to log or time the
+// requests it sends. Each attempt of a retried call goes through the
+// interceptors with a Request of its own.
+type Interceptor func(next CallHandler) CallHandler
+
+// Client makes calls over a RoundTripper. It is safe for concurrent use.
+type Client struct {
+	Transport RoundTripper
+	// Parser is used to parse responses. Numbers in results are always
+	// decoded as if UseNumber were set, so that they keep their precision
+	// until they are decoded into the caller's result.
+	Parser Parser
+	// Retry holds the RetryPolicy of each method whose failed calls should
+	// be retried. The policy under "" applies to the methods not listed.
+	Retry map[string]RetryPolicy
+
+	lastID            uint64
+	lastProgressToken uint64
+	progress          sync.Map
+
+	mu           sync.RWMutex
+	interceptors []Interceptor
+}
+
+// Use adds interceptors around the requests sent by Call. The first
+// interceptor added is the outermost.
+func (c *Client) Use(interceptors ...Interceptor) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.interceptors = append(c.interceptors, interceptors...)
+}
+
+// Call sends a request for method with params, which must be nil or encode
+// to a JSON array or object, and waits for its response. The result is
+// decoded into result, as json.Unmarshal would, unless result is nil. If the
+// server returns an error, Call returns it as an *Error.
+//
+// If a RetryPolicy is set for method, failed calls are retried following it,
+// each time with a new request ID.
+func (c *Client) Call(ctx context.Context, method string, params interface{}, result interface{}) error {
+	resp, err := c.callWithRetry(ctx, method, params)
+	if err != nil {
+		return err
+	}
+
+	if result == nil {
+		return nil
+	}
+	raw, err := json.Marshal(resp.Result())
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, result)
+}
+
+// call makes a single attempt at a call, returning the server's error as an
+// *Error.
+func (c *Client) call(ctx context.Context, method string, params interface{}) (*Response, error) {
+	id := uint(atomic.AddUint64(&c.lastID, 1))
+	req, err := MakeRequest(method, params, id)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.RLock()
+	h := CallHandler(c.send)
+	for i := len(c.interceptors) - 1; i >= 0; i-- {
+		h = c.interceptors[i](h)
+	}
+	c.mu.RUnlock()
+
+	resp, err := h(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.IsError() {
+		return nil, resp.Error()
+	}
+	return resp, nil
+}
+
+// send is the innermost CallHandler. It checks that the reply is the Response
+// to req.
+func (c *Client) send(ctx context.Context, req *Request) (*Response, error) {
+	raw, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	raw, err = c.Transport.RoundTrip(ctx, raw)
+	if err != nil {
+		return nil, err
+	}
+
+	p := c.Parser
+	p.UseNumber = true
+	msg, err := p.ParseIncoming(string(raw))
+	if err != nil {
+		return nil, err
+	}
+
+	resp, ok := msg.(*Response)
+	if !ok {
+		return nil, ErrUnexpectedResponse
+	}
+	if resp.IsError() {
+		// Errors about the request as a whole may have a null ID.
+		if !resp.HasNullID() && resp.ID() != req.ID() {
+			return nil, ErrUnexpectedResponse
+		}
+		return resp, nil
+	}
+	if resp.HasNullID() || resp.ID() != req.ID() {
+		return nil, ErrUnexpectedResponse
+	}
+	return resp, nil
+}
+
+// Notify sends a notification for method with params.
+func (c *Client) Notify(ctx context.Context, method string, params interface{}) error {
+	notif, err := MakeNotification(method, params)
+	if err != nil {
+		return err
+	}
+
+	raw, err := json.Marshal(notif)
+	if err != nil {
+		return err
+	}
+	_, err = c.Transport.RoundTrip(ctx, raw)
+	return err
+}
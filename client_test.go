@@ -0,0 +1,104 @@
+package gojsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+// testClient returns a Client whose requests are handled by d.
+func testClient(d *Dispatcher) *Client {
+	return &Client{Transport: RoundTripperFunc(func(ctx context.Context, message []byte) ([]byte, error) {
+		resp := d.Dispatch(ctx, string(message))
+		if resp == nil {
+			return nil, nil
+		}
+		return json.Marshal(resp)
+	})}
+}
+
+func TestClientCall(t *testing.T) {
+	c := testClient(testTypedDispatcher(t))
+
+	var sum int
+	if err := c.Call(context.Background(), "add", map[string]int{"a": 1, "b": 2}, &sum); err != nil {
+		t.Fatal(err)
+	}
+	if sum != 3 {
+		t.Errorf("expected 3 got %d", sum)
+	}
+
+	if err := c.Call(context.Background(), "ping", nil, nil); err != nil {
+		t.Error(err)
+	}
+
+	err := c.Call(context.Background(), "add", []interface{}{1, 2, "failed"}, &sum)
+	var rpcErr *Error
+	if !errors.As(err, &rpcErr) || rpcErr.Code() != 1 || rpcErr.Message() != "failed" {
+		t.Errorf("expected the handler's error, got %v", err)
+	}
+	if err.Error() != "jsonrpc error 1: failed" {
+		t.Errorf("unexpected error string %q", err.Error())
+	}
+
+	if err = c.Call(context.Background(), "add", "bad", &sum); err != InvalidRequestInvalidParamsType {
+		t.Errorf("expected %v got %v", InvalidRequestInvalidParamsType, err)
+	}
+}
+
+func TestClientCallPreservesNumbers(t *testing.T) {
+	d := new(Dispatcher)
+	d.Register("big", func(ctx context.Context, params interface{}) (interface{}, *Error) {
+		return json.Number("18446744073709551615"), nil
+	})
+
+	var n uint64
+	if err := testClient(d).Call(context.Background(), "big", nil, &n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 18446744073709551615 {
+		t.Errorf("expected 18446744073709551615 got %d", n)
+	}
+}
+
+func TestClientUnexpectedResponse(t *testing.T) {
+	replies := []string{
+		`{"jsonrpc":"2.0","result":1,"id":99}`,
+		`{"jsonrpc":"2.0","result":1,"id":null}`,
+		`{"jsonrpc":"2.0","method":"test","id":1}`,
+	}
+
+	for _, reply := range replies {
+		c := &Client{Transport: RoundTripperFunc(func(ctx context.Context, message []byte) ([]byte, error) {
+			return []byte(reply), nil
+		})}
+		if err := c.Call(context.Background(), "test", nil, nil); err != ErrUnexpectedResponse {
+			t.Errorf("%s: expected %v got %v", reply, ErrUnexpectedResponse, err)
+		}
+	}
+
+	// Errors about the whole request may have a null ID.
+	c := &Client{Transport: RoundTripperFunc(func(ctx context.Context, message []byte) ([]byte, error) {
+		return []byte(`{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request"},"id":null}`), nil
+	})}
+	if err := c.Call(context.Background(), "test", nil, nil); AsError(err).Code() != CodeInvalidRequest {
+		t.Errorf("expected an invalid request error, got %v", err)
+	}
+}
+
+func TestClientNotify(t *testing.T) {
+	var got string
+	c := &Client{Transport: RoundTripperFunc(func(ctx context.Context, message []byte) ([]byte, error) {
+		got = string(message)
+		return nil, nil
+	})}
+
+	if err := c.Notify(context.Background(), "test", []int{1}); err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"jsonrpc":"2.0","method":"test","params":[1]}`
+	if got != expected {
+		t.Errorf("expected %s got %s", expected, got)
+	}
+}
@@ -0,0 +1,594 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/token"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/asib/gojsonrpc"
+)
+
+const componentsPrefix = "#/components/schemas/"
+
+// options control the generated code.
+type options struct {
+	Package string
+	Name    string
+	Server  bool
+}
+
+// generator accumulates the type declarations needed by the methods.
+type generator struct {
+	doc *gojsonrpc.OpenRPCDocument
+
+	decls      map[string]string // Go type name to declaration.
+	declOrder  []string
+	structs    map[string]bool
+	components map[string]bool // Component schemas that have been declared.
+}
+
+// method is a method of the document with the Go names and types of its
+// params and result.
+type method struct {
+	name        string
+	goName      string
+	summary     string
+	description string
+	byName      bool
+	params      []param
+	result      string // "" if the method has no result.
+	resultPtr   bool
+}
+
+type param struct {
+	name     string
+	goName   string // Exported name, for struct fields.
+	argName  string // Unexported name, for function arguments.
+	goType   string
+	required bool
+}
+
+func generate(doc *gojsonrpc.OpenRPCDocument, opts options) ([]byte, error) {
+	g := &generator{
+		doc:        doc,
+		decls:      make(map[string]string),
+		structs:    make(map[string]bool),
+		components: make(map[string]bool),
+	}
+
+	name := opts.Name
+	if name == "" {
+		name = doc.Info.Title
+	}
+	name = goName(name)
+	if name == "" {
+		return nil, fmt.Errorf("no name: set info.title or use -name")
+	}
+
+	if doc.Components != nil {
+		for _, component := range sortedKeys(doc.Components.Schemas) {
+			if _, err := g.component(component); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var methods []method
+	byGoName := make(map[string]string)
+	for _, m := range doc.Methods {
+		gm, err := g.method(m)
+		if err != nil {
+			return nil, fmt.Errorf("method %s: %v", m.Name, err)
+		}
+		if other, ok := byGoName[gm.goName]; ok {
+			return nil, fmt.Errorf("methods %s and %s both map to the Go name %s", other, m.Name, gm.goName)
+		}
+		byGoName[gm.goName] = m.Name
+		methods = append(methods, gm)
+	}
+
+	for _, typeName := range []string{name + "Client", "New" + name + "Client", name + "Server", "Register" + name + "Server"} {
+		if _, ok := g.decls[typeName]; ok {
+			return nil, fmt.Errorf("type %s clashes with the generated API, use -name to rename it", typeName)
+		}
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by gojsonrpc-gen. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&b, "package %s\n\n", opts.Package)
+	fmt.Fprintf(&b, "import (\n")
+	if len(methods) > 0 {
+		fmt.Fprintf(&b, "%q\n\n", "context")
+	}
+	fmt.Fprintf(&b, "%q\n)\n\n", "github.com/asib/gojsonrpc")
+
+	for _, typeName := range g.declOrder {
+		b.WriteString(g.decls[typeName])
+		b.WriteString("\n\n")
+	}
+
+	writeClient(&b, name, doc, methods)
+	if opts.Server {
+		writeServer(&b, name, methods)
+	}
+
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("formatting generated code: %v\n%s", err, b.Bytes())
+	}
+	return src, nil
+}
+
+func (g *generator) method(m gojsonrpc.OpenRPCMethod) (method, error) {
+	gm := method{
+		name:        m.Name,
+		goName:      goName(m.Name),
+		summary:     m.Summary,
+		description: m.Description,
+		byName:      m.ParamStructure == "by-name",
+	}
+	if gm.goName == "" {
+		return gm, fmt.Errorf("can't derive a Go name")
+	}
+
+	used := map[string]bool{"ctx": true, "c": true, "s": true, "p": true, "result": true, "err": true}
+	fields := make(map[string]string)
+	for _, cd := range m.Params {
+		if other, ok := fields[goName(cd.Name)]; ok {
+			return gm, fmt.Errorf("params %s and %s both map to the Go name %s", other, cd.Name, goName(cd.Name))
+		}
+		fields[goName(cd.Name)] = cd.Name
+
+		t, err := g.goType(cd.Schema, gm.goName+goName(cd.Name))
+		if err != nil {
+			return gm, fmt.Errorf("param %s: %v", cd.Name, err)
+		}
+		if g.structs[t] {
+			t = "*" + t
+		}
+
+		argName := goArgName(cd.Name)
+		for used[argName] || token.IsKeyword(argName) {
+			argName += "_"
+		}
+		used[argName] = true
+
+		gm.params = append(gm.params, param{
+			name:     cd.Name,
+			goName:   goName(cd.Name),
+			argName:  argName,
+			goType:   t,
+			required: cd.Required,
+		})
+	}
+
+	if m.Result != nil {
+		t, err := g.goType(m.Result.Schema, gm.goName+"Result")
+		if err != nil {
+			return gm, fmt.Errorf("result: %v", err)
+		}
+		gm.result, gm.resultPtr = t, g.structs[t]
+	}
+
+	return gm, nil
+}
+
+// component declares the Go type for a schema in components, returning its
+// name.
+func (g *generator) component(name string) (string, error) {
+	typeName := goName(name)
+	if g.components[name] {
+		return typeName, nil
+	}
+
+	var schema map[string]interface{}
+	if g.doc.Components != nil {
+		schema = g.doc.Components.Schemas[name]
+	}
+	if schema == nil {
+		return "", fmt.Errorf("no schema %s%s", componentsPrefix, name)
+	}
+	g.components[name] = true
+
+	// Mark structs before declaring them, so that recursive references know
+	// to use pointers.
+	if isStructSchema(schema) {
+		g.structs[typeName] = true
+	}
+
+	t, err := g.goType(schema, typeName)
+	if err != nil {
+		return "", fmt.Errorf("schema %s: %v", name, err)
+	}
+	if t != typeName {
+		if err = g.declare(typeName, fmt.Sprintf("%stype %s %s", comment(schema), typeName, t)); err != nil {
+			return "", err
+		}
+	}
+	return typeName, nil
+}
+
+// declare adds the declaration of typeName, failing if two schemas, such as a
+// component and an inline object named after a method or property, map to the
+// same Go name.
+func (g *generator) declare(typeName, decl string) error {
+	if _, ok := g.decls[typeName]; ok {
+		return fmt.Errorf("two schemas map to the Go type %s", typeName)
+	}
+	g.declOrder = append(g.declOrder, typeName)
+	g.decls[typeName] = decl
+	return nil
+}
+
+// goType returns the Go type for values matching schema, declaring a struct
+// named hint if the schema describes an object with properties.
+func (g *generator) goType(schema map[string]interface{}, hint string) (string, error) {
+	if ref, ok := schema["$ref"].(string); ok {
+		if !strings.HasPrefix(ref, componentsPrefix) {
+			return "", fmt.Errorf("unsupported $ref %q", ref)
+		}
+		return g.component(strings.TrimPrefix(ref, componentsPrefix))
+	}
+
+	var types []string
+	nullable := false
+	switch t := schema["type"].(type) {
+	case string:
+		types = []string{t}
+	case []interface{}:
+		for _, elem := range t {
+			if s, ok := elem.(string); ok {
+				types = append(types, s)
+			}
+		}
+	}
+	var nonNull []string
+	for _, t := range types {
+		if t == "null" {
+			nullable = true
+		} else {
+			nonNull = append(nonNull, t)
+		}
+	}
+	if len(nonNull) == 0 && schema["properties"] != nil {
+		nonNull = []string{"object"}
+	}
+	if len(nonNull) != 1 {
+		return "interface{}", nil
+	}
+
+	var t string
+	switch nonNull[0] {
+	case "string":
+		t = "string"
+		if schema["contentEncoding"] == "base64" {
+			return "[]byte", nil
+		}
+	case "integer":
+		t = "int64"
+		if min, ok := schema["minimum"].(float64); ok && min >= 0 {
+			t = "uint64"
+		}
+	case "number":
+		t = "float64"
+	case "boolean":
+		t = "bool"
+	case "array":
+		items, _ := schema["items"].(map[string]interface{})
+		if items == nil {
+			return "[]interface{}", nil
+		}
+		elem, err := g.goType(items, hint+"Item")
+		if err != nil {
+			return "", err
+		}
+		if g.structs[elem] {
+			elem = "*" + elem
+		}
+		return "[]" + elem, nil
+	case "object":
+		if isStructSchema(schema) {
+			if err := g.declareStruct(schema, hint); err != nil {
+				return "", err
+			}
+			t = hint
+			break
+		}
+		if additional, ok := schema["additionalProperties"].(map[string]interface{}); ok {
+			elem, err := g.goType(additional, hint+"Value")
+			if err != nil {
+				return "", err
+			}
+			if g.structs[elem] {
+				elem = "*" + elem
+			}
+			return "map[string]" + elem, nil
+		}
+		return "map[string]interface{}", nil
+	default:
+		return "interface{}", nil
+	}
+
+	// Structs are always used through pointers, which are already nullable.
+	if nullable && !g.structs[t] {
+		return "*" + t, nil
+	}
+	return t, nil
+}
+
+func (g *generator) declareStruct(schema map[string]interface{}, typeName string) error {
+	g.structs[typeName] = true
+
+	properties, _ := schema["properties"].(map[string]interface{})
+	required := make(map[string]bool)
+	if list, ok := schema["required"].([]interface{}); ok {
+		for _, elem := range list {
+			if name, ok := elem.(string); ok {
+				required[name] = true
+			}
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%stype %s struct {\n", comment(schema), typeName)
+	fields := make(map[string]bool)
+	for _, name := range sortedKeys(properties) {
+		propSchema, _ := properties[name].(map[string]interface{})
+		fieldName := goName(name)
+		if fieldName == "" {
+			return fmt.Errorf("property %q: can't derive a Go name", name)
+		}
+		for fields[fieldName] {
+			fieldName += "_"
+		}
+		fields[fieldName] = true
+
+		t, err := g.goType(propSchema, typeName+fieldName)
+		if err != nil {
+			return fmt.Errorf("property %s: %v", name, err)
+		}
+		if g.structs[t] {
+			t = "*" + t
+		}
+
+		tag := name
+		if !required[name] {
+			tag += ",omitempty"
+		}
+		fmt.Fprintf(&b, "%s%s %s `json:%q`\n", comment(propSchema), fieldName, t, tag)
+	}
+	b.WriteString("}")
+
+	return g.declare(typeName, b.String())
+}
+
+func isStructSchema(schema map[string]interface{}) bool {
+	properties, ok := schema["properties"].(map[string]interface{})
+	return ok && len(properties) > 0
+}
+
+func writeClient(b *bytes.Buffer, name string, doc *gojsonrpc.OpenRPCDocument, methods []method) {
+	client := name + "Client"
+	fmt.Fprintf(b, "// %s calls the methods of the %s API.\n", client, doc.Info.Title)
+	fmt.Fprintf(b, "type %s struct {\nclient *gojsonrpc.Client\n}\n\n", client)
+	fmt.Fprintf(b, "// New%s returns a %s making calls with c.\n", client, client)
+	fmt.Fprintf(b, "func New%s(c *gojsonrpc.Client) *%s {\nreturn &%s{client: c}\n}\n\n", client, client, client)
+
+	for _, m := range methods {
+		fmt.Fprintf(b, "// %s calls %s.", m.goName, m.name)
+		writeDoc(b, m)
+		fmt.Fprintf(b, "func (c *%s) %s(%s) %s {\n", client, m.goName, signatureArgs(m), signatureResults(m))
+
+		params := "nil"
+		if len(m.params) > 0 && m.byName {
+			var elems []string
+			for _, p := range m.params {
+				elems = append(elems, fmt.Sprintf("%q: %s", p.name, p.argName))
+			}
+			params = "map[string]interface{}{" + strings.Join(elems, ", ") + "}"
+		} else if len(m.params) > 0 {
+			var elems []string
+			for _, p := range m.params {
+				elems = append(elems, p.argName)
+			}
+			params = "[]interface{}{" + strings.Join(elems, ", ") + "}"
+		}
+
+		switch {
+		case m.result == "":
+			fmt.Fprintf(b, "return c.client.Call(ctx, %q, %s, nil)\n", m.name, params)
+		case m.resultPtr:
+			fmt.Fprintf(b, "result := new(%s)\n", m.result)
+			fmt.Fprintf(b, "if err := c.client.Call(ctx, %q, %s, result); err != nil {\nreturn nil, err\n}\n", m.name, params)
+			fmt.Fprintf(b, "return result, nil\n")
+		default:
+			fmt.Fprintf(b, "var result %s\n", m.result)
+			fmt.Fprintf(b, "err := c.client.Call(ctx, %q, %s, &result)\n", m.name, params)
+			fmt.Fprintf(b, "return result, err\n")
+		}
+		fmt.Fprintf(b, "}\n\n")
+	}
+}
+
+func writeServer(b *bytes.Buffer, name string, methods []method) {
+	server := name + "Server"
+	fmt.Fprintf(b, "// %s is implemented by servers of the API. Errors that are or wrap a\n", server)
+	fmt.Fprintf(b, "// *gojsonrpc.Error are sent as they are, others as internal errors.\n")
+	fmt.Fprintf(b, "type %s interface {\n", server)
+	for _, m := range methods {
+		fmt.Fprintf(b, "// %s handles %s.", m.goName, m.name)
+		writeDoc(b, m)
+		fmt.Fprintf(b, "%s(%s) %s\n", m.goName, signatureArgs(m), signatureResults(m))
+	}
+	fmt.Fprintf(b, "}\n\n")
+
+	fmt.Fprintf(b, "// Register%s registers the methods of s with d.\n", server)
+	fmt.Fprintf(b, "func Register%s(d *gojsonrpc.Dispatcher, s %s) error {\n", server, server)
+	for _, m := range methods {
+		result := "interface{}"
+		if m.result != "" {
+			result = m.result
+			if m.resultPtr {
+				result = "*" + result
+			}
+		}
+
+		fmt.Fprintf(b, "if err := d.RegisterFunc(%q, func(ctx context.Context", m.name)
+		var args []string
+		if len(m.params) > 0 {
+			fmt.Fprintf(b, ", p struct {\n")
+			for _, p := range m.params {
+				tag := p.name
+				if !p.required {
+					tag += ",omitempty"
+				}
+				fmt.Fprintf(b, "%s %s `json:%q`\n", p.goName, p.goType, tag)
+				args = append(args, "p."+p.goName)
+			}
+			fmt.Fprintf(b, "}")
+		}
+		fmt.Fprintf(b, ") (%s, *gojsonrpc.Error) {\n", result)
+
+		call := fmt.Sprintf("s.%s(%s)", m.goName, strings.Join(append([]string{"ctx"}, args...), ", "))
+		if m.result == "" {
+			fmt.Fprintf(b, "return nil, gojsonrpc.AsError(%s)\n", call)
+		} else {
+			fmt.Fprintf(b, "result, err := %s\nreturn result, gojsonrpc.AsError(err)\n", call)
+		}
+		fmt.Fprintf(b, "}); err != nil {\nreturn err\n}\n")
+	}
+	fmt.Fprintf(b, "return nil\n}\n")
+}
+
+func writeDoc(b *bytes.Buffer, m method) {
+	for _, text := range []string{m.summary, m.description} {
+		if text != "" {
+			b.WriteString("\n//\n")
+			b.WriteString(commentLines(text))
+		}
+	}
+	b.WriteString("\n")
+}
+
+func signatureArgs(m method) string {
+	args := []string{"ctx context.Context"}
+	for _, p := range m.params {
+		args = append(args, p.argName+" "+p.goType)
+	}
+	return strings.Join(args, ", ")
+}
+
+func signatureResults(m method) string {
+	switch {
+	case m.result == "":
+		return "error"
+	case m.resultPtr:
+		return "(*" + m.result + ", error)"
+	}
+	return "(" + m.result + ", error)"
+}
+
+// comment returns the description of schema as a comment, or "".
+func comment(schema map[string]interface{}) string {
+	description, _ := schema["description"].(string)
+	if description == "" {
+		return ""
+	}
+	return commentLines(description) + "\n"
+}
+
+func commentLines(text string) string {
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight("// "+line, " ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+var initialisms = map[string]bool{
+	"API": true, "HTTP": true, "ID": true, "IP": true, "JSON": true, "RPC": true,
+	"URI": true, "URL": true, "UUID": true,
+}
+
+// words splits s on non-alphanumeric characters and lower to upper case
+// transitions.
+func words(s string) []string {
+	var words []string
+	var word []rune
+	var prev rune
+	for _, r := range s {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			if len(word) > 0 {
+				words = append(words, string(word))
+			}
+			word, prev = nil, r
+			continue
+		}
+		if unicode.IsUpper(r) && (unicode.IsLower(prev) || unicode.IsDigit(prev)) && len(word) > 0 {
+			words = append(words, string(word))
+			word = nil
+		}
+		word = append(word, r)
+		prev = r
+	}
+	if len(word) > 0 {
+		words = append(words, string(word))
+	}
+	return words
+}
+
+// goName converts s to an exported Go identifier, e.g. "get_user_id" to
+// "GetUserID".
+func goName(s string) string {
+	var b strings.Builder
+	for _, w := range words(s) {
+		if upper := strings.ToUpper(w); initialisms[upper] {
+			b.WriteString(upper)
+			continue
+		}
+		runes := []rune(w)
+		b.WriteString(strings.ToUpper(string(runes[0])) + string(runes[1:]))
+	}
+
+	name := b.String()
+	if name != "" && unicode.IsDigit([]rune(name)[0]) {
+		name = "X" + name
+	}
+	return name
+}
+
+// goArgName converts s to an unexported Go identifier, e.g. "user_id" to
+// "userID".
+func goArgName(s string) string {
+	ws := words(s)
+	if len(ws) == 0 {
+		return "arg"
+	}
+
+	first := strings.ToLower(ws[0])
+	rest := goName(strings.Join(ws[1:], " "))
+	if unicode.IsDigit([]rune(first)[0]) {
+		return "arg" + first + rest
+	}
+	return first + rest
+}
+
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	switch m := m.(type) {
+	case map[string]interface{}:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]map[string]interface{}:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/asib/gojsonrpc"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+// testTypeCheck fails the test if src, a generated file, doesn't compile.
+func testTypeCheck(t *testing.T, name string, src []byte) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, name, src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	if _, err = conf.Check(f.Name.Name, fset, []*ast.File{f}, nil); err != nil {
+		t.Errorf("%s doesn't compile: %v", name, err)
+	}
+}
+
+func TestGenerateGolden(t *testing.T) {
+	tests := []struct {
+		in, golden string
+		opts       options
+	}{
+		{"wallet.json", "wallet_client.golden", options{Package: "wallet"}},
+		{"wallet.json", "wallet_server.golden", options{Package: "wallet", Name: "Bank", Server: true}},
+	}
+
+	for _, test := range tests {
+		raw, err := ioutil.ReadFile(filepath.Join("testdata", test.in))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var doc gojsonrpc.OpenRPCDocument
+		if err = json.Unmarshal(raw, &doc); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := generate(&doc, test.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		golden := filepath.Join("testdata", test.golden)
+		testTypeCheck(t, golden, got)
+		if *update {
+			if err = ioutil.WriteFile(golden, got, 0666); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+
+		expected, err := ioutil.ReadFile(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(expected, got) {
+			t.Errorf("%s: generated code differs from %s, run go test -update to update it\n%s", test.in, golden, got)
+		}
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	docs := map[string]string{
+		`{"info":{"title":""},"methods":[]}`: "no name",
+		`{"info":{"title":"a"},"methods":[{"name":"m","params":[{"name":"p","schema":{"$ref":"other.json"}}]}]}`:                                                                        "unsupported $ref",
+		`{"info":{"title":"a"},"methods":[{"name":"m","params":[],"result":{"name":"r","schema":{"$ref":"#/components/schemas/X"}}}]}`:                                                  "no schema",
+		`{"info":{"title":"a"},"methods":[{"name":"...","params":[]}]}`:                                                                                                                 "can't derive a Go name",
+		`{"info":{"title":"a"},"methods":[{"name":"get_x","params":[]},{"name":"getX","params":[]}]}`:                                                                                   "both map to the Go name GetX",
+		`{"info":{"title":"a"},"methods":[{"name":"m","params":[{"name":"a_b","schema":{}},{"name":"aB","schema":{}}]}]}`:                                                               "both map to the Go name AB",
+		`{"info":{"title":"a"},"methods":[{"name":"get","params":[],"result":{"name":"r","schema":{"properties":{"a":{}}}}}],"components":{"schemas":{"GetResult":{"type":"string"}}}}`: "Go type GetResult",
+		`{"info":{"title":"a"},"methods":[],"components":{"schemas":{"AClient":{"type":"string"}}}}`:                                                                                    "clashes with the generated API",
+	}
+
+	for raw, expected := range docs {
+		var doc gojsonrpc.OpenRPCDocument
+		if err := json.Unmarshal([]byte(raw), &doc); err != nil {
+			t.Fatal(err)
+		}
+		_, err := generate(&doc, options{Package: "p"})
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%s: expected an error containing %q, got %v", raw, expected, err)
+		}
+	}
+}
+
+func TestGoName(t *testing.T) {
+	tests := map[string]string{
+		"getBalance":     "GetBalance",
+		"get_user_id":    "GetUserID",
+		"wallet.getHTTP": "WalletGetHTTP",
+		"eth_getBalance": "EthGetBalance",
+		"2fa":            "X2fa",
+		"url":            "URL",
+		"":               "",
+	}
+	for in, expected := range tests {
+		if got := goName(in); got != expected {
+			t.Errorf("%q: expected %q got %q", in, expected, got)
+		}
+	}
+
+	args := map[string]string{
+		"addr":     "addr",
+		"block_id": "blockID",
+		"URL":      "url",
+		"2fa":      "arg2fa",
+		"":         "arg",
+	}
+	for in, expected := range args {
+		if got := goArgName(in); got != expected {
+			t.Errorf("%q: expected %q got %q", in, expected, got)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+// Command gojsonrpc-gen generates Go types and a typed client for an API
+// described by an OpenRPC document. The client is built on gojsonrpc.Client.
+// With -server, it also generates an interface for servers of the API and a
+// function registering an implementation with a gojsonrpc.Dispatcher.
+//
+// Usage:
+//
+//	gojsonrpc-gen [flags] openrpc.json
+//
+// The flags are:
+//
+//	-o file
+//		write the generated code to file instead of standard output
+//	-package name
+//		package name of the generated code (default "client")
+//	-name name
+//		prefix of the generated client and server names (default: the
+//		document's info.title)
+//	-server
+//		also generate the server interface and registration function
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/asib/gojsonrpc"
+)
+
+func main() {
+	var opts options
+	out := flag.String("o", "", "write the generated code to `file` instead of standard output")
+	flag.StringVar(&opts.Package, "package", "client", "package `name` of the generated code")
+	flag.StringVar(&opts.Name, "name", "", "prefix of the generated client and server names (default: the document's info.title)")
+	flag.BoolVar(&opts.Server, "server", false, "also generate the server interface and registration function")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: gojsonrpc-gen [flags] openrpc.json\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(flag.Arg(0), *out, opts); err != nil {
+		fmt.Fprintf(os.Stderr, "gojsonrpc-gen: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(in, out string, opts options) error {
+	raw, err := ioutil.ReadFile(in)
+	if err != nil {
+		return err
+	}
+
+	var doc gojsonrpc.OpenRPCDocument
+	if err = json.Unmarshal(raw, &doc); err != nil {
+		return fmt.Errorf("%s: %v", in, err)
+	}
+
+	src, err := generate(&doc, opts)
+	if err != nil {
+		return fmt.Errorf("%s: %v", in, err)
+	}
+
+	if out == "" {
+		_, err = os.Stdout.Write(src)
+		return err
+	}
+	return ioutil.WriteFile(out, src, 0666)
+}
@@ -0,0 +1,389 @@
+// Command jsonrpc makes ad-hoc JSON-RPC calls and checks JSON-RPC messages.
+//
+// Usage:
+//
+//	jsonrpc call [flags] target method [params...]
+//	jsonrpc notify [flags] target method [params...]
+//	jsonrpc batch [flags] target [-n] method [params...] [-- [-n] method [params...]]...
+//	jsonrpc validate [-strict] [-v1] < message.json
+//
+// The target is an http:// or https:// URL, tcp://host:port,
+// unix:///path/to/socket or exec:command args..., which runs a subprocess and
+// talks to it over its stdin and stdout. Stream targets send and receive one
+// message per line.
+//
+// Params of the form key=value are sent by name with string values, and
+// key:=json by name with JSON values. Other params are sent by position,
+// decoded as JSON if possible and as strings otherwise. In a batch, calls are
+// separated by "--", and calls starting with -n are sent as notifications.
+//
+// Results are pretty-printed to standard output, and errors to standard
+// error. The exit status is:
+//
+//	0  success
+//	1  the server returned an application error
+//	2  invalid command line
+//	3  transport error, such as a failed connection or an HTTP error
+//	4  the reply, or the message given to validate, isn't valid JSON-RPC
+//	5  the server returned an error with a code reserved by the protocol
+//	   (-32768 to -32000), such as method not found or invalid params
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/asib/gojsonrpc"
+)
+
+// Exit statuses.
+const (
+	exitOK = iota
+	exitApplicationError
+	exitUsage
+	exitTransport
+	exitInvalidMessage
+	exitProtocolError
+)
+
+const usage = `usage:
+  jsonrpc call [flags] target method [params...]
+  jsonrpc notify [flags] target method [params...]
+  jsonrpc batch [flags] target [-n] method [params...] [-- [-n] method [params...]]...
+  jsonrpc validate [-strict] [-v1] < message.json
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// headerFlags collects repeated -H flags.
+type headerFlags http.Header
+
+func (h headerFlags) String() string { return "" }
+
+func (h headerFlags) Set(s string) error {
+	colon := strings.IndexByte(s, ':')
+	if colon <= 0 {
+		return fmt.Errorf("header must be Name: value")
+	}
+	http.Header(h).Add(strings.TrimSpace(s[:colon]), strings.TrimSpace(s[colon+1:]))
+	return nil
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return exitUsage
+	}
+
+	cmd, args := args[0], args[1:]
+	if cmd == "validate" {
+		return validate(args, stdin, stdout, stderr)
+	}
+	if cmd != "call" && cmd != "notify" && cmd != "batch" {
+		fmt.Fprintf(stderr, "unknown command %q\n%s", cmd, usage)
+		return exitUsage
+	}
+
+	flags := flag.NewFlagSet(cmd, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	headers := make(headerFlags)
+	timeout := flags.Duration("timeout", 30*time.Second, "give up after `duration`")
+	raw := flags.Bool("raw", false, "print the whole reply instead of the result")
+	flags.Var(headers, "H", "add an HTTP `header` (Name: value), may be repeated")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	args = flags.Args()
+
+	minArgs := 2
+	if cmd == "batch" {
+		minArgs = 1
+	}
+	if len(args) < minArgs {
+		fmt.Fprint(stderr, usage)
+		return exitUsage
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	target := args[0]
+	switch cmd {
+	case "call":
+		return call(ctx, target, http.Header(headers), args[1:], *raw, stdout, stderr)
+	case "notify":
+		return notify(ctx, target, http.Header(headers), args[1:], stderr)
+	}
+	return batch(ctx, target, http.Header(headers), args[1:], *raw, stdout, stderr)
+}
+
+func call(ctx context.Context, target string, headers http.Header, args []string, raw bool, stdout, stderr io.Writer) int {
+	params, err := parseParams(args[1:])
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitUsage
+	}
+
+	transport, err := newTransport(target, headers, true)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitUsage
+	}
+
+	var reply []byte
+	if raw {
+		// Keep hold of the reply for printing.
+		inner := transport
+		transport = gojsonrpc.RoundTripperFunc(func(ctx context.Context, message []byte) ([]byte, error) {
+			var err error
+			reply, err = inner.RoundTrip(ctx, message)
+			return reply, err
+		})
+	}
+
+	var result json.RawMessage
+	c := &gojsonrpc.Client{Transport: transport}
+	err = c.Call(ctx, args[0], params, &result)
+	if raw && reply != nil {
+		printJSON(stdout, reply)
+		return exitStatus(err)
+	}
+	if err != nil {
+		printError(stderr, err)
+		return exitStatus(err)
+	}
+
+	printJSON(stdout, result)
+	return exitOK
+}
+
+func notify(ctx context.Context, target string, headers http.Header, args []string, stderr io.Writer) int {
+	params, err := parseParams(args[1:])
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitUsage
+	}
+
+	transport, err := newTransport(target, headers, false)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitUsage
+	}
+
+	c := &gojsonrpc.Client{Transport: transport}
+	if err = c.Notify(ctx, args[0], params); err != nil {
+		printError(stderr, err)
+		return exitStatus(err)
+	}
+	return exitOK
+}
+
+func batch(ctx context.Context, target string, headers http.Header, args []string, raw bool, stdout, stderr io.Writer) int {
+	var messages gojsonrpc.Batch
+	requests := 0
+	for _, callArgs := range splitBatch(args) {
+		isNotification := len(callArgs) > 0 && callArgs[0] == "-n"
+		if isNotification {
+			callArgs = callArgs[1:]
+		}
+		if len(callArgs) == 0 {
+			fmt.Fprintln(stderr, "empty call in batch")
+			return exitUsage
+		}
+
+		params, err := parseParams(callArgs[1:])
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitUsage
+		}
+
+		var msg gojsonrpc.Message
+		if isNotification {
+			msg, err = gojsonrpc.MakeNotification(callArgs[0], params)
+		} else {
+			requests++
+			msg, err = gojsonrpc.MakeRequest(callArgs[0], params, uint(requests))
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %v\n", callArgs[0], err)
+			return exitUsage
+		}
+		messages = append(messages, msg)
+	}
+	if len(messages) == 0 {
+		fmt.Fprint(stderr, usage)
+		return exitUsage
+	}
+
+	transport, err := newTransport(target, headers, requests > 0)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitUsage
+	}
+
+	encoded, err := json.Marshal(messages)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitUsage
+	}
+	reply, err := transport.RoundTrip(ctx, encoded)
+	if err != nil {
+		printError(stderr, err)
+		return exitTransport
+	}
+	if requests == 0 {
+		return exitOK
+	}
+	if raw {
+		printJSON(stdout, reply)
+	}
+
+	// A batch is answered with an array of responses, in any order, or with
+	// a single error response if the batch itself was rejected.
+	var replies []json.RawMessage
+	if err = json.Unmarshal(reply, &replies); err != nil {
+		replies = []json.RawMessage{reply}
+	}
+
+	status := exitOK
+	for _, r := range replies {
+		msg, err := gojsonrpc.ParseIncoming(string(r))
+		resp, ok := msg.(*gojsonrpc.Response)
+		if err != nil || !ok {
+			fmt.Fprintf(stderr, "invalid reply: %s\n", r)
+			return exitInvalidMessage
+		}
+		if raw {
+			continue
+		}
+
+		fmt.Fprintf(stdout, "%s: ", responseLabel(resp))
+		if resp.IsError() {
+			fmt.Fprintln(stdout)
+			printError(stdout, resp.Error())
+			if status == exitOK {
+				status = exitStatus(resp.Error())
+			}
+			continue
+		}
+		result, _ := json.Marshal(resp.Result())
+		printJSON(stdout, result)
+	}
+	return status
+}
+
+// splitBatch splits args on "--".
+func splitBatch(args []string) [][]string {
+	calls := [][]string{nil}
+	for _, arg := range args {
+		if arg == "--" {
+			calls = append(calls, nil)
+			continue
+		}
+		calls[len(calls)-1] = append(calls[len(calls)-1], arg)
+	}
+	return calls
+}
+
+func responseLabel(resp *gojsonrpc.Response) string {
+	if resp.HasNullID() {
+		return "id null"
+	}
+	return fmt.Sprintf("id %d", resp.ID())
+}
+
+func validate(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("validate", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	var p gojsonrpc.Parser
+	flags.BoolVar(&p.Strict, "strict", false, "also reject duplicate keys, invalid UTF-8 and lone surrogates")
+	flags.BoolVar(&p.AllowVersion1, "v1", false, "accept JSON-RPC 1.0 messages")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() != 0 {
+		fmt.Fprint(stderr, usage)
+		return exitUsage
+	}
+
+	data, err := ioutil.ReadAll(stdin)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitUsage
+	}
+
+	msg, err := p.ParseIncoming(string(bytes.TrimSpace(data)))
+	if err != nil {
+		fmt.Fprintf(stderr, "invalid: %v\n", err)
+		return exitInvalidMessage
+	}
+
+	kind := "response"
+	switch msg.(type) {
+	case *gojsonrpc.Request:
+		kind = "request"
+	case *gojsonrpc.Notification:
+		kind = "notification"
+	}
+	fmt.Fprintf(stdout, "valid JSON-RPC %s %s\n", msg.JSONRPCVersion(), kind)
+	return exitOK
+}
+
+// exitStatus classifies an error returned by a call.
+func exitStatus(err error) int {
+	if err == nil {
+		return exitOK
+	}
+
+	var rpcErr *gojsonrpc.Error
+	if errors.As(err, &rpcErr) {
+		if rpcErr.Code() >= -32768 && rpcErr.Code() <= -32000 {
+			return exitProtocolError
+		}
+		return exitApplicationError
+	}
+
+	var parseErr gojsonrpc.ParseError
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &parseErr) || errors.As(err, &syntaxErr) || err == gojsonrpc.ErrUnexpectedResponse {
+		return exitInvalidMessage
+	}
+	return exitTransport
+}
+
+func printError(w io.Writer, err error) {
+	var rpcErr *gojsonrpc.Error
+	if !errors.As(err, &rpcErr) {
+		fmt.Fprintf(w, "error: %v\n", err)
+		return
+	}
+
+	fmt.Fprintf(w, "error %d: %s\n", rpcErr.Code(), rpcErr.Message())
+	if rpcErr.Data() != nil {
+		data, _ := json.Marshal(rpcErr.Data())
+		printJSON(w, data)
+	}
+}
+
+func printJSON(w io.Writer, data []byte) {
+	var b bytes.Buffer
+	if err := json.Indent(&b, data, "", "  "); err != nil {
+		w.Write(data)
+		fmt.Fprintln(w)
+		return
+	}
+	b.WriteByte('\n')
+	w.Write(b.Bytes())
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/asib/gojsonrpc"
+)
+
+// When set, the test binary acts as a server on its stdin and stdout, for the
+// exec: transport.
+const testServerEnv = "JSONRPC_TEST_SERVER"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(testServerEnv) == "1" {
+		serveLines(os.Stdin, os.Stdout)
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func testDispatcher() *gojsonrpc.Dispatcher {
+	d := new(gojsonrpc.Dispatcher)
+	d.Register("echo", func(ctx context.Context, params interface{}) (interface{}, *gojsonrpc.Error) {
+		return params, nil
+	})
+	d.Register("fail", func(ctx context.Context, params interface{}) (interface{}, *gojsonrpc.Error) {
+		return nil, gojsonrpc.MakeError(7, "failed", map[string]interface{}{"why": "test"})
+	})
+	return d
+}
+
+// handle answers a message or a batch of messages.
+func handle(d *gojsonrpc.Dispatcher, message []byte) []byte {
+	var batch []json.RawMessage
+	if json.Unmarshal(message, &batch) != nil {
+		resp := d.Dispatch(context.Background(), string(message))
+		if resp == nil {
+			return nil
+		}
+		reply, _ := json.Marshal(resp)
+		return reply
+	}
+
+	var replies []*gojsonrpc.Response
+	for _, m := range batch {
+		if resp := d.Dispatch(context.Background(), string(m)); resp != nil {
+			replies = append(replies, resp)
+		}
+	}
+	if len(replies) == 0 {
+		return nil
+	}
+	reply, _ := json.Marshal(replies)
+	return reply
+}
+
+func serveLines(r *os.File, w *os.File) {
+	d := testDispatcher()
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if reply := handle(d, scanner.Bytes()); reply != nil {
+			w.Write(append(reply, '\n'))
+		}
+	}
+}
+
+func testHTTPServer(t *testing.T) *httptest.Server {
+	d := testDispatcher()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Token") == "bad" {
+			http.Error(w, "", http.StatusUnauthorized)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write(handle(d, body))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func testStreamServer(t *testing.T, network, address string) string {
+	l, err := net.Listen(network, address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	d := testDispatcher()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					if reply := handle(d, scanner.Bytes()); reply != nil {
+						conn.Write(append(reply, '\n'))
+					}
+				}
+			}()
+		}
+	}()
+
+	return network + "://" + l.Addr().String()
+}
+
+func testRun(t *testing.T, stdin string, args ...string) (status int, stdout, stderr string) {
+	var out, errOut bytes.Buffer
+	status = run(args, strings.NewReader(stdin), &out, &errOut)
+	return status, out.String(), errOut.String()
+}
+
+func TestCallTransports(t *testing.T) {
+	os.Setenv(testServerEnv, "1")
+	defer os.Unsetenv(testServerEnv)
+
+	targets := []string{
+		testHTTPServer(t).URL,
+		testStreamServer(t, "tcp", "127.0.0.1:0"),
+		testStreamServer(t, "unix", filepath.Join(t.TempDir(), "sock")),
+		"exec:" + os.Args[0],
+	}
+
+	for _, target := range targets {
+		status, stdout, stderr := testRun(t, "", "call", target, "echo", "a=1", "b:=[true]")
+		expected := "{\n  \"a\": \"1\",\n  \"b\": [\n    true\n  ]\n}\n"
+		if status != exitOK || stdout != expected {
+			t.Errorf("%s: expected %d %q got %d %q %q", target, exitOK, expected, status, stdout, stderr)
+		}
+
+		if status, _, stderr = testRun(t, "", "notify", target, "echo", "1"); status != exitOK {
+			t.Errorf("%s: notify: expected %d got %d %q", target, exitOK, status, stderr)
+		}
+	}
+}
+
+func TestCallErrors(t *testing.T) {
+	url := testHTTPServer(t).URL
+
+	tests := []struct {
+		args   []string
+		status int
+		stderr string
+	}{
+		{[]string{"call", url, "fail"}, exitApplicationError, "error 7: failed\n{\n  \"why\": \"test\"\n}\n"},
+		{[]string{"call", url, "missing"}, exitProtocolError, "error -32601: Method not found\n"},
+		{[]string{"call", "-H", "X-Token: bad", url, "echo"}, exitTransport, "error: HTTP 401 Unauthorized\n"},
+		{[]string{"call", "tcp://127.0.0.1:1", "echo"}, exitTransport, ""},
+		{[]string{"call", "ftp://host", "echo"}, exitUsage, ""},
+		{[]string{"call", url}, exitUsage, ""},
+		{[]string{"call", url, "echo", "a=1", "2"}, exitUsage, ""},
+		{[]string{"frobnicate"}, exitUsage, ""},
+		{nil, exitUsage, ""},
+	}
+
+	for _, test := range tests {
+		status, _, stderr := testRun(t, "", test.args...)
+		if status != test.status || (test.stderr != "" && stderr != test.stderr) {
+			t.Errorf("%q: expected %d %q got %d %q", test.args, test.status, test.stderr, status, stderr)
+		}
+	}
+}
+
+func TestCallInvalidReply(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"jsonrpc":"2.0","result":1}`))
+	}))
+	defer s.Close()
+
+	if status, _, _ := testRun(t, "", "call", s.URL, "echo"); status != exitInvalidMessage {
+		t.Errorf("expected %d got %d", exitInvalidMessage, status)
+	}
+}
+
+func TestCallRaw(t *testing.T) {
+	status, stdout, _ := testRun(t, "", "call", "-raw", testHTTPServer(t).URL, "fail")
+	if status != exitApplicationError || !strings.Contains(stdout, `"jsonrpc": "2.0"`) || !strings.Contains(stdout, `"code": 7`) {
+		t.Errorf("unexpected %d %q", status, stdout)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	url := testHTTPServer(t).URL
+
+	status, stdout, stderr := testRun(t, "", "batch", url, "echo", "1", "--", "-n", "echo", "--", "fail")
+	expected := "id 1: [\n  1\n]\nid 2: \nerror 7: failed\n{\n  \"why\": \"test\"\n}\n"
+	if status != exitApplicationError || stdout != expected {
+		t.Errorf("expected %d %q got %d %q %q", exitApplicationError, expected, status, stdout, stderr)
+	}
+
+	if status, stdout, _ = testRun(t, "", "batch", url, "-n", "echo"); status != exitOK || stdout != "" {
+		t.Errorf("notification only batch: got %d %q", status, stdout)
+	}
+
+	if status, _, _ = testRun(t, "", "batch", url, "echo", "--"); status != exitUsage {
+		t.Errorf("empty call: expected %d got %d", exitUsage, status)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		args    []string
+		message string
+		status  int
+		stdout  string
+	}{
+		{nil, `{"jsonrpc":"2.0","method":"a","id":1}` + "\n", exitOK, "valid JSON-RPC 2.0 request\n"},
+		{nil, `{"jsonrpc":"2.0","method":"a"}`, exitOK, "valid JSON-RPC 2.0 notification\n"},
+		{nil, `{"jsonrpc":"2.0","result":1,"id":1}`, exitOK, "valid JSON-RPC 2.0 response\n"},
+		{nil, `{"method":"a","params":[],"id":1}`, exitInvalidMessage, ""},
+		{[]string{"-v1"}, `{"method":"a","params":[],"id":1}`, exitOK, "valid JSON-RPC 1.0 request\n"},
+		{nil, `{"jsonrpc":"2.0","method":"a","method":"b"}`, exitOK, "valid JSON-RPC 2.0 notification\n"},
+		{[]string{"-strict"}, `{"jsonrpc":"2.0","method":"a","method":"b"}`, exitInvalidMessage, ""},
+		{nil, `{`, exitInvalidMessage, ""},
+		{[]string{"extra"}, ``, exitUsage, ""},
+	}
+
+	for _, test := range tests {
+		status, stdout, _ := testRun(t, test.message, append([]string{"validate"}, test.args...)...)
+		if status != test.status || stdout != test.stdout {
+			t.Errorf("%q %s: expected %d %q got %d %q", test.args, test.message, test.status, test.stdout, status, stdout)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// parseParams builds params from command line arguments. Arguments of the
+// form key=value give named params with string values, and key:=json named
+// params with JSON values. Other arguments are positional params, decoded as
+// JSON if possible and used as strings otherwise. Named and positional params
+// can't be mixed. No arguments give nil params.
+func parseParams(args []string) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, nil
+	}
+
+	named := make(map[string]interface{})
+	var positional []interface{}
+	for _, arg := range args {
+		key, value, isNamed := splitNamedParam(arg)
+		if !isNamed {
+			positional = append(positional, parsePositional(arg))
+			continue
+		}
+
+		if strings.HasSuffix(key, ":") {
+			key = strings.TrimSuffix(key, ":")
+			v, err := unmarshalJSON(value)
+			if err != nil {
+				return nil, fmt.Errorf("param %s: invalid JSON: %v", key, err)
+			}
+			named[key] = v
+		} else {
+			named[key] = value
+		}
+	}
+
+	switch {
+	case len(named) > 0 && len(positional) > 0:
+		return nil, fmt.Errorf("can't mix named (key=value) and positional params")
+	case len(named) > 0:
+		return named, nil
+	}
+	return positional, nil
+}
+
+// splitNamedParam splits key=value. Arguments that are valid JSON, such as
+// "{\"a\":\"b=c\"}", are positional even if they contain '='.
+func splitNamedParam(arg string) (key, value string, ok bool) {
+	eq := strings.IndexByte(arg, '=')
+	if eq <= 0 || json.Valid([]byte(arg)) {
+		return "", "", false
+	}
+	return arg[:eq], arg[eq+1:], true
+}
+
+func parsePositional(arg string) interface{} {
+	v, err := unmarshalJSON(arg)
+	if err != nil {
+		return arg
+	}
+	return v
+}
+
+// unmarshalJSON decodes data as json.Unmarshal would, but keeps numbers as
+// json.Number, so that large integers are sent as given rather than rounded.
+func unmarshalJSON(data string) (interface{}, error) {
+	dec := json.NewDecoder(strings.NewReader(data))
+	dec.UseNumber()
+
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("unexpected data after the value")
+	}
+	return v, nil
+}
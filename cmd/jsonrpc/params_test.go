@@ -0,0 +1,38 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestParseParams(t *testing.T) {
+	tests := []struct {
+		args     []string
+		expected interface{}
+	}{
+		{nil, nil},
+		{[]string{"1", "a", "true", "null", `{"a":"b=c"}`, "[1]"}, []interface{}{json.Number("1"), "a", true, nil, map[string]interface{}{"a": "b=c"}, []interface{}{json.Number("1")}}},
+		{[]string{"a=1", "b:=1", "c:=[true]", "d=x=y", "e="}, map[string]interface{}{"a": "1", "b": json.Number("1"), "c": []interface{}{true}, "d": "x=y", "e": ""}},
+		{[]string{"9007199254740993", "1 2", "[0.10000000000000001]"}, []interface{}{json.Number("9007199254740993"), "1 2", []interface{}{json.Number("0.10000000000000001")}}},
+		{[]string{"id:=18446744073709551615"}, map[string]interface{}{"id": json.Number("18446744073709551615")}},
+		{[]string{"=a"}, []interface{}{"=a"}},
+	}
+
+	for _, test := range tests {
+		got, err := parseParams(test.args)
+		if err != nil {
+			t.Errorf("%q: %v", test.args, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("%q: expected %#v got %#v", test.args, test.expected, got)
+		}
+	}
+
+	for _, args := range [][]string{{"a=1", "2"}, {"a:={"}, {"a:=1 2"}} {
+		if _, err := parseParams(args); err == nil {
+			t.Errorf("%q: expected an error", args)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os/exec"
+	"strings"
+
+	"github.com/asib/gojsonrpc"
+)
+
+// newTransport returns a RoundTripper for target, which is one of:
+//
+//	http://host/path, https://host/path  POST each message
+//	tcp://host:port                      newline delimited messages
+//	unix:///path/to/socket               newline delimited messages
+//	exec:command args...                 newline delimited messages over the
+//	                                     stdin and stdout of a subprocess
+//
+// expectReply tells stream transports whether to wait for a reply.
+func newTransport(target string, headers http.Header, expectReply bool) (gojsonrpc.RoundTripper, error) {
+	switch {
+	case strings.HasPrefix(target, "http://"), strings.HasPrefix(target, "https://"):
+		return &httpTransport{url: target, headers: headers}, nil
+	case strings.HasPrefix(target, "tcp://"):
+		return &streamTransport{network: "tcp", address: strings.TrimPrefix(target, "tcp://"), expectReply: expectReply}, nil
+	case strings.HasPrefix(target, "unix://"):
+		return &streamTransport{network: "unix", address: strings.TrimPrefix(target, "unix://"), expectReply: expectReply}, nil
+	case strings.HasPrefix(target, "exec:"):
+		args := strings.Fields(strings.TrimPrefix(target, "exec:"))
+		if len(args) == 0 {
+			return nil, fmt.Errorf("exec: no command")
+		}
+		return &execTransport{args: args, expectReply: expectReply}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported target %q: use http://, https://, tcp://, unix:// or exec:", target)
+}
+
+type httpTransport struct {
+	url     string
+	headers http.Header
+}
+
+func (t *httpTransport) RoundTrip(ctx context.Context, message []byte) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodPost, t.url, bytes.NewReader(message))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	for k, v := range t.headers {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	// JSON-RPC errors may come with any status, as long as there is a body.
+	if resp.StatusCode/100 != 2 && len(bytes.TrimSpace(body)) == 0 {
+		return nil, fmt.Errorf("HTTP %s", resp.Status)
+	}
+	return body, nil
+}
+
+type streamTransport struct {
+	network, address string
+	expectReply      bool
+}
+
+func (t *streamTransport) RoundTrip(ctx context.Context, message []byte) ([]byte, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, t.network, t.address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	return exchangeLine(conn, conn, message, t.expectReply)
+}
+
+type execTransport struct {
+	args        []string
+	expectReply bool
+}
+
+func (t *execTransport) RoundTrip(ctx context.Context, message []byte) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, t.args[0], t.args[1:]...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	reply, err := exchangeLine(stdin, stdout, message, t.expectReply)
+	stdin.Close()
+	if waitErr := cmd.Wait(); err == nil && waitErr != nil && reply == nil {
+		err = waitErr
+	}
+	return reply, err
+}
+
+// exchangeLine writes message followed by a newline, then reads one line of
+// reply if expectReply is set.
+func exchangeLine(w io.Writer, r io.Reader, message []byte, expectReply bool) ([]byte, error) {
+	if _, err := w.Write(append(message, '\n')); err != nil {
+		return nil, err
+	}
+	if !expectReply {
+		return nil, nil
+	}
+
+	reply, err := bufio.NewReader(r).ReadBytes('\n')
+	if err == io.EOF && len(bytes.TrimSpace(reply)) > 0 {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimSpace(reply), nil
+}
@@ -0,0 +1,223 @@
+package gojsonrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Codec converts messages to and from a wire encoding. Decode must apply the
+// same validation as ParseIncoming.
+type Codec interface {
+	Encode(msg Message) ([]byte, error)
+	Decode(data []byte) (Message, error)
+}
+
+// JSONCodec is the default Codec, using encoding/json and Parser.
+type JSONCodec struct {
+	Parser Parser
+}
+
+// Encode marshals msg to JSON.
+func (c *JSONCodec) Encode(msg Message) ([]byte, error) {
+	return json.Marshal(msg)
+}
+
+// Decode parses data with c.Parser.
+func (c *JSONCodec) Decode(data []byte) (Message, error) {
+	return c.Parser.ParseIncoming(string(data))
+}
+
+// ErrUnsupportedValue is returned by the binary codecs for values that have no
+// equivalent on the other side: binary map keys that aren't strings, numbers
+// that don't fit the binary format, NaN and infinities, and so on.
+var ErrUnsupportedValue = errors.New("gojsonrpc: value cannot be transcoded")
+
+// The binary codecs are transcoders: Encode marshals the message to JSON as
+// usual and converts the result, and Decode converts the input to JSON text
+// and hands it to the Parser. This guarantees the binary encodings follow
+// exactly the same rules as JSON, including Strict and Limits, and keep the
+// same ID types. Binary strings have no JSON equivalent, so they are decoded
+// as base64 strings, as encoding/json does for []byte.
+
+// jsonTree marshals msg and decodes it again as a tree of nil, bool,
+// json.Number, string, []interface{} and map[string]interface{}.
+func jsonTree(msg Message) (interface{}, error) {
+	raw, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	return unmarshalUseNumber(raw)
+}
+
+// sortedKeys returns the keys of m in order, so that binary encodings are
+// deterministic.
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// jsonWriter builds the JSON text produced when decoding a binary message.
+type jsonWriter struct {
+	bytes.Buffer
+}
+
+// writeString writes s as a JSON string. Invalid UTF-8 is copied as is rather
+// than replaced, so that Parser.Strict can still see it.
+func (w *jsonWriter) writeString(s []byte) {
+	const hex = "0123456789abcdef"
+
+	w.WriteByte('"')
+	for len(s) > 0 {
+		c := s[0]
+		switch {
+		case c == '"' || c == '\\':
+			w.WriteByte('\\')
+			w.WriteByte(c)
+		case c < 0x20:
+			w.WriteString(`\u00`)
+			w.WriteByte(hex[c>>4])
+			w.WriteByte(hex[c&0xf])
+		case c < utf8.RuneSelf:
+			w.WriteByte(c)
+		default:
+			_, size := utf8.DecodeRune(s)
+			w.Write(s[:size])
+			s = s[size:]
+			continue
+		}
+		s = s[1:]
+	}
+	w.WriteByte('"')
+}
+
+func (w *jsonWriter) writeBinary(b []byte) error {
+	raw, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+
+	w.Write(raw)
+	return nil
+}
+
+func (w *jsonWriter) writeFloat(f float64, bits int) error {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return ErrUnsupportedValue
+	}
+
+	w.Write(strconv.AppendFloat(w.AvailableBuffer(), f, 'g', -1, bits))
+	return nil
+}
+
+// jsonNumber classifies a number from a jsonTree. kind is 'i' for integers
+// that fit in an int64, 'u' for larger integers that fit in a uint64, 'b' for
+// integers that don't fit in 64 bits and 'f' for everything else.
+func jsonNumber(n json.Number) (i int64, u uint64, f float64, kind byte, err error) {
+	if strings.ContainsAny(string(n), ".eE") {
+		if f, err = strconv.ParseFloat(string(n), 64); err != nil {
+			return 0, 0, 0, 0, ErrUnsupportedValue
+		}
+		return 0, 0, f, 'f', nil
+	}
+
+	if i, err = strconv.ParseInt(string(n), 10, 64); err == nil {
+		return i, 0, 0, 'i', nil
+	}
+	if u, err = strconv.ParseUint(string(n), 10, 64); err == nil {
+		return 0, u, 0, 'u', nil
+	}
+
+	return 0, 0, 0, 'b', nil
+}
+
+// maxTranscodeDepth bounds the nesting accepted by the binary decoders when
+// the Parser has no MaxDepth limit, matching encoding/json's own limit.
+const maxTranscodeDepth = 10000
+
+// binaryReader is the input of the binary decoders.
+type binaryReader struct {
+	data     []byte
+	pos      int
+	depth    int
+	maxDepth int
+}
+
+func newBinaryReader(data []byte, p *Parser) (*binaryReader, error) {
+	r := &binaryReader{data: data, maxDepth: maxTranscodeDepth}
+	if p.Limits != nil {
+		if p.Limits.MaxBytes > 0 && len(data) > p.Limits.MaxBytes {
+			return nil, MessageTooLarge
+		}
+		if p.Limits.MaxDepth > 0 {
+			r.maxDepth = p.Limits.MaxDepth
+		}
+	}
+
+	return r, nil
+}
+
+func (r *binaryReader) next(n uint64) ([]byte, error) {
+	if n > uint64(len(r.data)-r.pos) {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	b := r.data[r.pos : r.pos+int(n)]
+	r.pos += int(n)
+	return b, nil
+}
+
+func (r *binaryReader) byte() (byte, error) {
+	b, err := r.next(1)
+	if err != nil {
+		return 0, err
+	}
+
+	return b[0], nil
+}
+
+// uint reads a big endian unsigned integer of n bytes.
+func (r *binaryReader) uint(n uint64) (uint64, error) {
+	b, err := r.next(n)
+	if err != nil {
+		return 0, err
+	}
+
+	var u uint64
+	for _, c := range b {
+		u = u<<8 | uint64(c)
+	}
+	return u, nil
+}
+
+func (r *binaryReader) enter() error {
+	r.depth++
+	if r.depth > r.maxDepth {
+		return NestingTooDeep
+	}
+
+	return nil
+}
+
+func (r *binaryReader) leave() {
+	r.depth--
+}
+
+// appendUint appends u to dst as a big endian integer of n bytes.
+func appendUint(dst []byte, u uint64, n int) []byte {
+	for i := n - 1; i >= 0; i-- {
+		dst = append(dst, byte(u>>(uint(i)*8)))
+	}
+	return dst
+}
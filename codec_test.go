@@ -0,0 +1,311 @@
+package gojsonrpc
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+)
+
+var testCodecs = map[string]func(p Parser) Codec{
+	"json":    func(p Parser) Codec { return &JSONCodec{Parser: p} },
+	"msgpack": func(p Parser) Codec { return &MessagePackCodec{Parser: p} },
+	"cbor":    func(p Parser) Codec { return &CBORCodec{Parser: p} },
+}
+
+// testCodecMessages are round tripped through every codec. They are compared
+// through their JSON encoding, parsed with UseNumber.
+var testCodecMessages = []string{
+	`{"jsonrpc":"2.0","method":"test"}`,
+	`{"jsonrpc":"2.0","method":"test","params":[1,-1,-200,70000,-70000,1.5,"a",true,false,null,[],{}]}`,
+	`{"jsonrpc":"2.0","method":"test","params":{"big":18446744073709551615,"min":-9223372036854775808},"id":18446744073709551615}`,
+	`{"jsonrpc":"2.0","method":"test","params":{"s":"` + string(bytes.Repeat([]byte("x"), 70000)) + `"},"id":1}`,
+	`{"jsonrpc":"2.0","result":{"nested":[[[{"a":"é😀\n\""}]]]},"id":2}`,
+	`{"jsonrpc":"2.0","result":null,"id":3}`,
+	`{"jsonrpc":"2.0","error":{"code":-32601,"message":"Method not found","data":[0.25]},"id":4}`,
+	`{"jsonrpc":"2.0","error":{"code":-32700,"message":"Parse error"},"id":null}`,
+}
+
+func TestCodecsRoundTrip(t *testing.T) {
+	p := Parser{UseNumber: true}
+	for name, makeCodec := range testCodecs {
+		c := makeCodec(p)
+		for _, raw := range testCodecMessages {
+			msg, err := p.ParseIncoming(raw)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			encoded, err := c.Encode(msg)
+			if err != nil {
+				t.Errorf("%s: encoding %.80s: %v", name, raw, err)
+				continue
+			}
+			decoded, err := c.Decode(encoded)
+			if err != nil {
+				t.Errorf("%s: decoding %.80s: %v", name, raw, err)
+				continue
+			}
+
+			expected, _ := json.Marshal(msg)
+			got, _ := json.Marshal(decoded)
+			if !bytes.Equal(expected, got) {
+				t.Errorf("%s: expected %.80s got %.80s", name, expected, got)
+			}
+		}
+	}
+}
+
+// Every codec must reject what ParseIncoming rejects, with the same error.
+func TestCodecsValidation(t *testing.T) {
+	tests := []struct {
+		parser Parser
+		tree   string
+		err    error
+	}{
+		{Parser{}, `{"jsonrpc":"2.0","method":"test","params":"bad","id":1}`, InvalidMessage},
+		{Parser{}, `{"jsonrpc":"1.0","method":"test","id":1}`, InvalidVersion},
+		{Parser{}, `{"method":"test","id":1}`, InvalidMessage},
+		{Parser{}, `{"jsonrpc":"2.0","method":"test","id":1,"extra":1}`, InvalidMessage},
+		{Parser{Limits: &Limits{MaxDepth: 2}}, `{"jsonrpc":"2.0","method":"test","params":[[1]],"id":1}`, NestingTooDeep},
+		{Parser{Limits: &Limits{MaxElements: 2}}, `{"jsonrpc":"2.0","method":"test","params":[1,2,3],"id":1}`, TooManyElements},
+	}
+
+	for name, makeCodec := range testCodecs {
+		for _, test := range tests {
+			tree, err := unmarshalUseNumber(json.RawMessage(test.tree))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var encoded []byte
+			switch name {
+			case "json":
+				encoded = []byte(test.tree)
+			case "msgpack":
+				encoded, err = appendMsgpack(nil, tree)
+			case "cbor":
+				encoded, err = appendCBOR(nil, tree)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err = makeCodec(test.parser).Decode(encoded); err != test.err {
+				t.Errorf("%s: %s: expected %v got %v", name, test.tree, test.err, err)
+			}
+		}
+	}
+}
+
+func TestJSONCodecEncode(t *testing.T) {
+	r, err := MakeRequest(testRequestMethod, nil, testRequestId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := new(JSONCodec).Encode(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedJSON := `{"jsonrpc":"2.0","method":"test","id":1}`
+	if string(encoded) != expectedJSON {
+		t.Errorf("expected %s got %s", expectedJSON, encoded)
+	}
+}
+
+func testDecodeHex(t *testing.T, c Codec, data string) (Message, error) {
+	b, err := hex.DecodeString(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return c.Decode(b)
+}
+
+func TestMessagePackEncode(t *testing.T) {
+	r, err := MakeRequest("t", []interface{}{-1, 300}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := new(MessagePackCodec).Encode(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// {"id":1,"jsonrpc":"2.0","method":"t","params":[-1,300]}
+	expected := "84a2696401a76a736f6e727063a3322e30a66d6574686f64a174a6706172616d7392ffcd012c"
+	if hex.EncodeToString(encoded) != expected {
+		t.Errorf("expected %s got %x", expected, encoded)
+	}
+}
+
+func TestMessagePackDecodeFormats(t *testing.T) {
+	// {"jsonrpc":"2.0","method":"t","params":[...]} where params holds a
+	// uint16, int8, int32, float32, bin8, str8 and map16 with one member.
+	data := "83a76a736f6e727063a3322e30a66d6574686f64a174a6706172616d7397" +
+		"cd0100d080d2fffe7960ca3fc00000c40201ffd90161de0001a16bc0"
+	msg, err := testDecodeHex(t, new(MessagePackCodec), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, _ := json.Marshal(msg)
+	expected := `{"jsonrpc":"2.0","method":"t","params":[256,-128,-100000,1.5,"Af8=","a",{"k":null}]}`
+	if string(got) != expected {
+		t.Errorf("expected %s got %s", expected, got)
+	}
+}
+
+func TestMessagePackDecodeErrors(t *testing.T) {
+	tests := map[string]error{
+		"":                         nil, // any error
+		"81a1":                     nil, // truncated
+		"8101c0":                   ErrUnsupportedValue,
+		"d40100":                   ErrUnsupportedValue,
+		"c1":                       ErrUnsupportedValue,
+		"c0c0":                     InvalidMessage,
+		"81a161cb7ff8000000000000": ErrUnsupportedValue, // NaN
+	}
+
+	for data, expected := range tests {
+		_, err := testDecodeHex(t, new(MessagePackCodec), data)
+		if err == nil || (expected != nil && err != expected) {
+			t.Errorf("%s: expected %v got %v", data, expected, err)
+		}
+	}
+}
+
+func TestMessagePackEncodeBigInteger(t *testing.T) {
+	msg, err := (&Parser{UseNumber: true}).ParseIncoming(`{"jsonrpc":"2.0","method":"t","params":[18446744073709551616]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = new(MessagePackCodec).Encode(msg); err != ErrUnsupportedValue {
+		t.Errorf("expected %v got %v", ErrUnsupportedValue, err)
+	}
+}
+
+func TestCBOREncode(t *testing.T) {
+	r, err := MakeRequest("t", []interface{}{-1, 300}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := new(CBORCodec).Encode(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// {"id":1,"jsonrpc":"2.0","method":"t","params":[-1,300]}
+	expected := "a462696401676a736f6e72706363322e30666d6574686f64617466706172616d73822019012c"
+	if hex.EncodeToString(encoded) != expected {
+		t.Errorf("expected %s got %x", expected, encoded)
+	}
+}
+
+func TestCBORDecodeFormats(t *testing.T) {
+	// An indefinite length map {"jsonrpc":"2.0","method":"t","params":[...]}
+	// where params is an indefinite length array holding a half float, an
+	// indefinite length text string, a positive and a negative bignum, a
+	// tagged value, undefined and a byte string.
+	data := "bf676a736f6e72706363322e30666d6574686f64617466706172616d739f" +
+		"f93e007f6161626262ffc249010000000000000000c349010000000000000000c11a5f5e1000f74201ffffff"
+	msg, err := testDecodeHex(t, &CBORCodec{Parser: Parser{UseNumber: true}}, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, _ := json.Marshal(msg)
+	expected := `{"jsonrpc":"2.0","method":"t","params":[1.5,"abb",18446744073709551616,-18446744073709551617,1600000000,null,"Af8="]}`
+	if string(got) != expected {
+		t.Errorf("expected %s got %s", expected, got)
+	}
+}
+
+func TestCBORBignumRoundTrip(t *testing.T) {
+	p := Parser{UseNumber: true}
+	raw := `{"jsonrpc":"2.0","method":"t","params":[18446744073709551616,-18446744073709551617,-18446744073709551616]}`
+	msg, err := p.ParseIncoming(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &CBORCodec{Parser: p}
+	encoded, err := c.Encode(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := c.Decode(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, _ := json.Marshal(decoded)
+	if string(got) != raw {
+		t.Errorf("expected %s got %s", raw, got)
+	}
+}
+
+func TestCBORDecodeErrors(t *testing.T) {
+	tests := map[string]error{
+		"":       nil, // any error
+		"a161":   nil, // truncated
+		"a101f6": ErrUnsupportedValue,
+		"ff":     ErrUnsupportedValue,
+		"f0":     ErrUnsupportedValue,
+		"1c":     ErrUnsupportedValue,
+		"f6f6":   InvalidMessage,
+	}
+
+	for data, expected := range tests {
+		_, err := testDecodeHex(t, new(CBORCodec), data)
+		if err == nil || (expected != nil && err != expected) {
+			t.Errorf("%s: expected %v got %v", data, expected, err)
+		}
+	}
+}
+
+func TestBinaryCodecsStrict(t *testing.T) {
+	// {"jsonrpc":"2.0","method":"a","method":"b","id":1} can't be built from a
+	// Go map, so it is written out by hand.
+	msgpackData := "84a76a736f6e727063a3322e30a66d6574686f64a161a66d6574686f64a162a2696401"
+	cborData := "a4676a736f6e72706363322e30666d6574686f646161666d6574686f64616262696401"
+
+	for name, data := range map[string]string{"msgpack": msgpackData, "cbor": cborData} {
+		c := testCodecs[name](Parser{Strict: true})
+		if _, err := testDecodeHex(t, c, data); err != DuplicateKey {
+			t.Errorf("%s: expected %v got %v", name, DuplicateKey, err)
+		}
+
+		c = testCodecs[name](Parser{})
+		msg, err := testDecodeHex(t, c, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.(*Request).Method() != "b" {
+			t.Errorf("%s: expected non-strict decode to keep the last method", name)
+		}
+	}
+}
+
+func TestBinaryCodecsDepthLimit(t *testing.T) {
+	// 20000 nested single element arrays.
+	msgpackData := bytes.Repeat([]byte{0x91}, 20000)
+	if _, err := new(MessagePackCodec).Decode(msgpackData); err != NestingTooDeep {
+		t.Errorf("msgpack: expected %v got %v", NestingTooDeep, err)
+	}
+
+	cborData := bytes.Repeat([]byte{0x81}, 20000)
+	if _, err := new(CBORCodec).Decode(cborData); err != NestingTooDeep {
+		t.Errorf("cbor: expected %v got %v", NestingTooDeep, err)
+	}
+
+	// Nested tags don't count as nesting, but mustn't exhaust the stack.
+	cborData = append(bytes.Repeat([]byte{0xc6}, 20<<20), 0x01)
+	r := &binaryReader{data: cborData, maxDepth: maxTranscodeDepth}
+	var w jsonWriter
+	if err := r.cborToJSON(&w); err != nil || w.String() != "1" {
+		t.Errorf("cbor tags: expected 1 got %q, %v", w.String(), err)
+	}
+}
@@ -6,6 +6,9 @@ import "fmt"
 
 const (
 	Version = "2.0"
+	// Version1 is reported by JSONRPCVersion for messages using the JSON-RPC
+	// 1.0 dialect. See Parser.AllowVersion1.
+	Version1 = "1.0"
 
 	VersionKey      = "jsonrpc"
 	MethodKey       = "method"
@@ -38,6 +41,22 @@ type ParseError int
 const (
 	InvalidVersion ParseError = iota
 	InvalidMessage
+
+	// The following are only returned by a Parser with Strict set. A server
+	// should answer DuplicateKey with a -32600 (invalid request) response, and
+	// the others with -32700 (parse error).
+	DuplicateKey
+	InvalidUTF8
+	LoneSurrogate
+
+	// The following are only returned by a Parser with Limits set. A server
+	// should answer MessageTooLarge with a -32700 (parse error) response, and
+	// the others with -32600 (invalid request).
+	MessageTooLarge
+	NestingTooDeep
+	TooManyElements
+	StringTooLong
+	BatchTooLong
 )
 
 // This method returns the string representation of a ParseError.
@@ -0,0 +1,220 @@
+package gojsonrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sync"
+)
+
+// HandlerFunc handles a single method. params is the Params of the request or
+// notification being handled. A non-nil *Error is sent back to the caller as
+// an error Response, otherwise result is sent as the result. Both are ignored
+// for notifications.
+type HandlerFunc func(ctx context.Context, params interface{}) (result interface{}, err *Error)
+
+// MessageHandler handles a parsed message, returning the Response to send back
+// or nil. Dispatcher.DispatchMessage is a MessageHandler.
+type MessageHandler func(ctx context.Context, msg Message) *Response
+
+// Middleware wraps a MessageHandler, e.g. to check messages before they reach
+// the handlers registered with a Dispatcher.
+type Middleware func(next MessageHandler) MessageHandler
+
+// Dispatcher routes incoming messages to the HandlerFunc registered for their
+// method. The zero value is ready to use.
+type Dispatcher struct {
+	// Parser is used to parse every incoming message.
+	Parser Parser
+	// ValidateResults enables checking handler results against the result
+	// schemas set with RegisterSchema. It is meant for debugging: a result
+	// that doesn't match is replaced by a CodeInternalError error listing the
+	// violations.
+	ValidateResults bool
+
+	mu         sync.RWMutex
+	handlers   map[string]HandlerFunc
+	schemas    map[string]MethodSchema
+	typed      map[string]*typedMethod
+	info       map[string]MethodInfo
+	middleware []Middleware
+}
+
+// MethodSchema holds the schemas for the params and result of a method. Either
+// may be nil.
+type MethodSchema struct {
+	Params *Schema
+	Result *Schema
+}
+
+// Register sets the handler for method, replacing any existing one, along
+// with the signature recorded by RegisterFunc.
+func (d *Dispatcher) Register(method string, handler HandlerFunc) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.handlers == nil {
+		d.handlers = make(map[string]HandlerFunc)
+	}
+	d.handlers[method] = handler
+	delete(d.typed, method)
+}
+
+// RegisterSchema sets the schemas for method, replacing any existing ones.
+// Params of requests and notifications for method are checked before the
+// handler runs. Requests whose params don't match are answered with a
+// CodeInvalidParams error whose data is the list of SchemaViolations, and
+// notifications are dropped. Absent params are validated as null.
+func (d *Dispatcher) RegisterSchema(method string, schema MethodSchema) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.schemas == nil {
+		d.schemas = make(map[string]MethodSchema)
+	}
+	d.schemas[method] = schema
+}
+
+// Use adds middleware around the handling of every message. The first
+// middleware added is the outermost.
+func (d *Dispatcher) Use(middleware ...Middleware) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.middleware = append(d.middleware, middleware...)
+}
+
+func (d *Dispatcher) handler(method string) (HandlerFunc, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	h, ok := d.handlers[method]
+	return h, ok
+}
+
+func (d *Dispatcher) schema(method string) MethodSchema {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return d.schemas[method]
+}
+
+// Dispatch parses message and runs the matching handler. It returns the
+// Response to send back, or nil if there is nothing to send (the message was a
+// notification or a response). Messages that can't be parsed are answered
+// using ErrorResponseFor, and requests for unregistered methods with a
+// CodeMethodNotFound error.
+func (d *Dispatcher) Dispatch(ctx context.Context, message string) *Response {
+	msg, err := d.Parser.ParseIncoming(message)
+	if err != nil {
+		return ErrorResponseFor([]byte(message), err)
+	}
+
+	return d.DispatchMessage(ctx, msg)
+}
+
+// DispatchRaw answers data, which holds a single message or a batch, returning
+// the encoded reply or nil if there is nothing to send. The messages of a
+// batch are dispatched in turn, and their responses sent back together. An
+// empty batch is answered with a single CodeInvalidRequest error, as is a
+// batch that fails the Parser's Strict or Limits checks (including
+// MaxBatchLength), which are run on the batch as a whole before it is split.
+func (d *Dispatcher) DispatchRaw(ctx context.Context, data []byte) []byte {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || data[0] != '[' {
+		return encodeReply(d.Dispatch(ctx, string(data)))
+	}
+
+	if d.Parser.Strict || d.Parser.Limits != nil {
+		// Checked before the batch is split, as json.Unmarshal would
+		// allocate for it.
+		if err := scanMessage(data, d.Parser.Strict, d.Parser.Limits); err != nil {
+			return encodeReply(ErrorResponseFor(data, err))
+		}
+	}
+
+	var messages []json.RawMessage
+	if err := json.Unmarshal(data, &messages); err != nil {
+		return encodeReply(ErrorResponseFor(data, err))
+	}
+	if len(messages) == 0 {
+		return encodeReply(ErrorResponseFor(data, InvalidMessage))
+	}
+
+	var replies Batch
+	for _, m := range messages {
+		if resp := d.Dispatch(ctx, string(m)); resp != nil {
+			replies = append(replies, resp)
+		}
+	}
+	if len(replies) == 0 {
+		return nil
+	}
+	reply, _ := json.Marshal(replies)
+	return reply
+}
+
+func encodeReply(resp *Response) []byte {
+	if resp == nil {
+		return nil
+	}
+	reply, _ := json.Marshal(resp)
+	return reply
+}
+
+// DispatchMessage is like Dispatch for a message that has already been
+// parsed, e.g. by a Codec.
+func (d *Dispatcher) DispatchMessage(ctx context.Context, msg Message) *Response {
+	d.mu.RLock()
+	h := d.dispatch
+	for i := len(d.middleware) - 1; i >= 0; i-- {
+		h = d.middleware[i](h)
+	}
+	d.mu.RUnlock()
+
+	return h(ctx, msg)
+}
+
+func (d *Dispatcher) dispatch(ctx context.Context, msg Message) *Response {
+	switch m := msg.(type) {
+	case *Notification:
+		h, ok := d.handler(m.Method())
+		if !ok {
+			break
+		}
+		if s := d.schema(m.Method()).Params; s != nil && s.Validate(m.Params()) != nil {
+			break
+		}
+		h(ctx, m.Params())
+	case *Request:
+		h, ok := d.handler(m.Method())
+		if !ok {
+			resp, _ := m.MakeResponseWithError(MakeError(CodeMethodNotFound, "Method not found", nil))
+			return resp
+		}
+
+		schema := d.schema(m.Method())
+		if schema.Params != nil {
+			if violations := schema.Params.Validate(m.Params()); violations != nil {
+				resp, _ := m.MakeResponseWithError(MakeError(CodeInvalidParams, "Invalid params", violations))
+				return resp
+			}
+		}
+
+		result, rpcErr := h(withProgressToken(ctx, m.Params()), m.Params())
+		if rpcErr != nil {
+			resp, _ := m.MakeResponseWithError(rpcErr)
+			return resp
+		}
+
+		if d.ValidateResults && schema.Result != nil {
+			if violations := schema.Result.Validate(result); violations != nil {
+				resp, _ := m.MakeResponseWithError(MakeError(CodeInternalError, "Invalid result", violations))
+				return resp
+			}
+		}
+		return m.MakeResponseWithResult(result)
+	}
+
+	return nil
+}
@@ -0,0 +1,176 @@
+package gojsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func testDispatcher() *Dispatcher {
+	d := new(Dispatcher)
+	d.Register("echo", func(ctx context.Context, params interface{}) (interface{}, *Error) {
+		return params, nil
+	})
+	d.Register("fail", func(ctx context.Context, params interface{}) (interface{}, *Error) {
+		return nil, MakeError(1, "failed", nil)
+	})
+	return d
+}
+
+func testDispatch(t *testing.T, d *Dispatcher, message, expected string) {
+	resp := d.Dispatch(context.Background(), message)
+	if expected == "" {
+		if resp != nil {
+			t.Errorf("%s: expected no response got %v", message, resp)
+		}
+		return
+	}
+
+	jsonResp, err := json.Marshal(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(jsonResp) != expected {
+		t.Errorf("%s: expected %s got %s", message, expected, jsonResp)
+	}
+}
+
+func TestDispatchRequest(t *testing.T) {
+	testDispatch(t, testDispatcher(),
+		`{"jsonrpc":"2.0", "method":"echo", "params":[1], "id":1}`,
+		`{"jsonrpc":"2.0","result":[1],"id":1}`)
+}
+
+func TestDispatchRequestWithError(t *testing.T) {
+	testDispatch(t, testDispatcher(),
+		`{"jsonrpc":"2.0", "method":"fail", "id":2}`,
+		`{"jsonrpc":"2.0","error":{"code":1,"message":"failed"},"id":2}`)
+}
+
+func TestDispatchMethodNotFound(t *testing.T) {
+	testDispatch(t, testDispatcher(),
+		`{"jsonrpc":"2.0", "method":"missing", "id":3}`,
+		`{"jsonrpc":"2.0","error":{"code":-32601,"message":"Method not found"},"id":3}`)
+}
+
+func TestDispatchNotification(t *testing.T) {
+	called := false
+	d := new(Dispatcher)
+	d.Register("notify", func(ctx context.Context, params interface{}) (interface{}, *Error) {
+		called = true
+		return nil, nil
+	})
+
+	testDispatch(t, d, `{"jsonrpc":"2.0", "method":"notify"}`, "")
+	testDispatch(t, d, `{"jsonrpc":"2.0", "method":"missing"}`, "")
+	if !called {
+		t.Error("handler should have been called")
+	}
+}
+
+func TestDispatchResponse(t *testing.T) {
+	testDispatch(t, testDispatcher(), `{"jsonrpc":"2.0", "result":1, "id":1}`, "")
+}
+
+func TestDispatchUnparseable(t *testing.T) {
+	testDispatch(t, testDispatcher(),
+		`{"jsonrpc":"2.0", "method":"echo", "params":"bad", "id":4}`,
+		`{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request","data":"gojsonrpc: parse error: InvalidMessage"},"id":4}`)
+	testDispatch(t, testDispatcher(),
+		`{"jsonrpc":"2.0", "method":"echo", "params":[1}`,
+		`{"jsonrpc":"2.0","error":{"code":-32700,"message":"Parse error","data":"invalid character '}' after array element"},"id":null}`)
+}
+
+func TestDispatchVersion1(t *testing.T) {
+	d := testDispatcher()
+	d.Parser.AllowVersion1 = true
+	testDispatch(t, d,
+		`{"method":"echo", "params":[1], "id":1}`,
+		`{"result":[1],"error":null,"id":1}`)
+	testDispatch(t, d,
+		`{"jsonrpc":"2.0", "method":"echo", "params":[1], "id":1}`,
+		`{"jsonrpc":"2.0","result":[1],"id":1}`)
+}
+
+func TestDispatcherMiddleware(t *testing.T) {
+	var order []string
+	mark := func(name string) Middleware {
+		return func(next MessageHandler) MessageHandler {
+			return func(ctx context.Context, msg Message) *Response {
+				order = append(order, name)
+				return next(ctx, msg)
+			}
+		}
+	}
+
+	d := testDispatcher()
+	d.Use(mark("first"), mark("second"))
+	d.Use(func(next MessageHandler) MessageHandler {
+		return func(ctx context.Context, msg Message) *Response {
+			if req, ok := msg.(*Request); ok && req.Method() == "blocked" {
+				return MakeResponseWithResult("blocked", req.ID())
+			}
+			return next(ctx, msg)
+		}
+	})
+
+	testDispatch(t, d,
+		`{"jsonrpc":"2.0", "method":"echo", "params":[1], "id":1}`,
+		`{"jsonrpc":"2.0","result":[1],"id":1}`)
+	testDispatch(t, d,
+		`{"jsonrpc":"2.0", "method":"blocked", "id":2}`,
+		`{"jsonrpc":"2.0","result":"blocked","id":2}`)
+
+	if len(order) != 4 || order[0] != "first" || order[1] != "second" {
+		t.Errorf("unexpected middleware order %v", order)
+	}
+}
+
+func TestDispatchRaw(t *testing.T) {
+	tests := []struct {
+		message, expected string
+	}{
+		{`{"jsonrpc":"2.0", "method":"echo", "params":[1], "id":1}`,
+			`{"jsonrpc":"2.0","result":[1],"id":1}`},
+		{`{"jsonrpc":"2.0", "method":"echo", "params":[1]}`, ``},
+		{` [{"jsonrpc":"2.0", "method":"echo", "params":[1], "id":1}, {"jsonrpc":"2.0", "method":"fail", "id":2}]`,
+			`[{"jsonrpc":"2.0","result":[1],"id":1},{"jsonrpc":"2.0","error":{"code":1,"message":"failed"},"id":2}]`},
+		{`[{"jsonrpc":"2.0", "method":"echo"}, {"jsonrpc":"2.0", "method":"fail"}]`, ``},
+		{`[{"jsonrpc":"2.0", "method":"missing", "id":4}]`,
+			`[{"jsonrpc":"2.0","error":{"code":-32601,"message":"Method not found"},"id":4}]`},
+		{`[]`,
+			`{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request","data":"gojsonrpc: parse error: InvalidMessage"},"id":null}`},
+		{`[{"jsonrpc":"2.0", "method":"echo", "id":1}`,
+			`{"jsonrpc":"2.0","error":{"code":-32700,"message":"Parse error","data":"unexpected end of JSON input"},"id":null}`},
+	}
+
+	d := testDispatcher()
+	for _, test := range tests {
+		reply := d.DispatchRaw(context.Background(), []byte(test.message))
+		if string(reply) != test.expected {
+			t.Errorf("%s: expected %s got %s", test.message, test.expected, reply)
+		}
+	}
+}
+
+func TestDispatchRawChecksBatches(t *testing.T) {
+	tests := []struct {
+		message, expected string
+	}{
+		{`[{"jsonrpc":"2.0", "method":"echo", "id":1}, {"jsonrpc":"2.0", "method":"echo", "id":2}, {"jsonrpc":"2.0", "method":"echo", "id":3}]`,
+			`{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request","data":"gojsonrpc: parse error: BatchTooLong"},"id":null}`},
+		{`[{"jsonrpc":"2.0", "method":"echo", "id":1, "id":2}]`,
+			`{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request","data":"gojsonrpc: parse error: DuplicateKey"},"id":null}`},
+		{`[{"jsonrpc":"2.0", "method":"echo", "id":1}, {"jsonrpc":"2.0", "method":"echo", "id":2}]`,
+			`[{"jsonrpc":"2.0","result":null,"id":1},{"jsonrpc":"2.0","result":null,"id":2}]`},
+	}
+
+	d := testDispatcher()
+	d.Parser = Parser{Strict: true, Limits: &Limits{MaxBatchLength: 2}}
+	for _, test := range tests {
+		reply := d.DispatchRaw(context.Background(), []byte(test.message))
+		if string(reply) != test.expected {
+			t.Errorf("%s: expected %s got %s", test.message, test.expected, reply)
+		}
+	}
+}
@@ -1,6 +1,19 @@
 package gojsonrpc
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// The error codes reserved by the JSON-RPC 2.0 specification.
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+)
 
 type errorData struct {
 	Code    int         `json:"code"`
@@ -13,6 +26,11 @@ type Error struct {
 	errorData
 }
 
+// Reset clears e, so that it can be reused.
+func (e *Error) Reset() {
+	e.errorData = errorData{}
+}
+
 // Code returns the error's code.
 func (e *Error) Code() int {
 	return e.errorData.Code
@@ -29,6 +47,27 @@ func (e *Error) Data() interface{} {
 	return e.errorData.Data
 }
 
+// Error implements the error interface, so that an Error received in a
+// response can be returned as a Go error.
+func (e *Error) Error() string {
+	return fmt.Sprintf("jsonrpc error %d: %s", e.Code(), e.Message())
+}
+
+// AsError converts err into an Error to send in a response. If err is or wraps
+// an *Error, that Error is returned. Other errors become a CodeInternalError
+// whose data is err's description. A nil err gives nil.
+func AsError(err error) *Error {
+	if err == nil {
+		return nil
+	}
+
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	return MakeError(CodeInternalError, "Internal error", err.Error())
+}
+
 // Use this function to create Error's - do not try to use a struct literal.
 // You may pass nil for the data argument.
 func MakeError(code int, message string, data interface{}) *Error {
@@ -2,6 +2,8 @@ package gojsonrpc
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"reflect"
 	"testing"
 )
@@ -152,3 +154,19 @@ func TestUnmarshalWithoutData(t *testing.T) {
 		t.Error("data should be nil")
 	}
 }
+
+func TestAsError(t *testing.T) {
+	if AsError(nil) != nil {
+		t.Error("expected nil for a nil error")
+	}
+
+	e := MakeError(1, "failed", nil)
+	if AsError(fmt.Errorf("wrapped: %w", e)) != e {
+		t.Error("expected the wrapped Error")
+	}
+
+	got := AsError(errors.New("boom"))
+	if got.Code() != CodeInternalError || got.Message() != "Internal error" || got.Data() != "boom" {
+		t.Errorf("unexpected error %#v", got)
+	}
+}
@@ -0,0 +1,93 @@
+package gojsonrpc
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// ErrorResponseFor builds the error Response a server should send when raw
+// could not be parsed, parseErr being the error returned by ParseIncoming. The
+// code is CodeParseError if raw is not valid JSON (or was rejected before it
+// was decoded, e.g. for being too large), and CodeInvalidRequest otherwise.
+// The error's data holds parseErr's description.
+//
+// The response's ID is recovered from raw if possible, even if the message is
+// cut short after it. Otherwise the ID is null. It is always null when raw
+// exceeded the Parser's Limits, so as not to decode what the limits rejected.
+func ErrorResponseFor(raw []byte, parseErr error) *Response {
+	code, message := CodeInvalidRequest, "Invalid Request"
+	if isParseErrorCode(parseErr) {
+		code, message = CodeParseError, "Parse error"
+	}
+
+	var data interface{}
+	if parseErr != nil {
+		data = parseErr.Error()
+	}
+
+	resp := makeResponse(nil, MakeError(code, message, data), 0, responseTypeError)
+	resp.responseData.ID = nil
+	if !isLimitError(parseErr) {
+		if id, ok := recoverID(raw); ok {
+			resp.responseData.ID = &id
+		}
+	}
+
+	return resp
+}
+
+func isParseErrorCode(err error) bool {
+	switch err.(type) {
+	case *json.SyntaxError:
+		return true
+	}
+
+	switch err {
+	case MessageTooLarge, InvalidUTF8, LoneSurrogate:
+		return true
+	}
+
+	return false
+}
+
+func isLimitError(err error) bool {
+	switch err {
+	case MessageTooLarge, NestingTooDeep, TooManyElements, StringTooLong, BatchTooLong:
+		return true
+	}
+
+	return false
+}
+
+// recoverID looks for a valid id member in the top level object of raw,
+// stopping at the first syntax error.
+func recoverID(raw []byte) (uint, bool) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return 0, false
+	}
+
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return 0, false
+		}
+
+		var value json.RawMessage
+		if err = dec.Decode(&value); err != nil {
+			return 0, false
+		}
+
+		if key == IDKey {
+			var id uint
+			if err = json.Unmarshal(value, &id); err != nil {
+				return 0, false
+			}
+			return id, true
+		}
+	}
+
+	return 0, false
+}
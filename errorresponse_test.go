@@ -0,0 +1,123 @@
+package gojsonrpc
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func testErrorResponseFor(t *testing.T, p *Parser, raw string) *Response {
+	_, err := p.ParseIncoming(raw)
+	if err == nil {
+		t.Fatalf("%s should not have parsed", raw)
+	}
+
+	return ErrorResponseFor([]byte(raw), err)
+}
+
+func TestErrorResponseForSyntaxError(t *testing.T) {
+	r := testErrorResponseFor(t, new(Parser), `{"jsonrpc":"2.0", "method":"test", "id":1`)
+	if r.Error().Code() != CodeParseError {
+		t.Errorf("expected code %d got %d", CodeParseError, r.Error().Code())
+	}
+	// The id was complete before the message was cut short.
+	if r.HasNullID() || r.ID() != 1 {
+		t.Error("id should have been recovered")
+	}
+}
+
+func TestErrorResponseForSyntaxErrorBeforeID(t *testing.T) {
+	r := testErrorResponseFor(t, new(Parser), `{"jsonrpc":"2.0", "method":test, "id":1}`)
+	if r.Error().Code() != CodeParseError {
+		t.Errorf("expected code %d got %d", CodeParseError, r.Error().Code())
+	}
+	if !r.HasNullID() {
+		t.Error("id should be null")
+	}
+}
+
+func TestErrorResponseForInvalidRequest(t *testing.T) {
+	raws := []string{
+		`{"jsonrpc":"2.0", "method":"test", "params":"bad", "id":5}`,
+		`{"jsonrpc":"3.0", "method":"test", "id":5}`,
+		`{"jsonrpc":"2.0", "method":1, "id":5}`,
+	}
+
+	for _, raw := range raws {
+		r := testErrorResponseFor(t, new(Parser), raw)
+		if r.Error().Code() != CodeInvalidRequest {
+			t.Errorf("%s: expected code %d got %d", raw, CodeInvalidRequest, r.Error().Code())
+		}
+		if r.HasNullID() || r.ID() != 5 {
+			t.Errorf("%s: id should have been recovered", raw)
+		}
+	}
+}
+
+func TestErrorResponseForUnreadableID(t *testing.T) {
+	raws := []string{
+		`[1, 2]`,
+		`"test"`,
+		`{"jsonrpc":"2.0", "method":"test", "id":"abc"}`,
+		`{"jsonrpc":"2.0", "method":"test", "id":-1}`,
+	}
+
+	for _, raw := range raws {
+		r := testErrorResponseFor(t, new(Parser), raw)
+		if r.Error().Code() != CodeInvalidRequest {
+			t.Errorf("%s: expected code %d got %d", raw, CodeInvalidRequest, r.Error().Code())
+		}
+		if !r.HasNullID() {
+			t.Errorf("%s: id should be null", raw)
+		}
+	}
+}
+
+func TestErrorResponseForParserErrors(t *testing.T) {
+	tests := []struct {
+		parser *Parser
+		raw    string
+		code   int
+	}{
+		{&Parser{Strict: true}, `{"jsonrpc":"2.0", "method":"a", "method":"b", "id":1}`, CodeInvalidRequest},
+		{&Parser{Strict: true}, `{"jsonrpc":"2.0", "method":"\ud800", "id":1}`, CodeParseError},
+		{&Parser{Limits: &Limits{MaxBytes: 10}}, `{"jsonrpc":"2.0", "method":"test", "id":1}`, CodeParseError},
+		{&Parser{Limits: &Limits{MaxDepth: 1}}, `{"jsonrpc":"2.0", "method":"test", "params":[], "id":1}`, CodeInvalidRequest},
+	}
+
+	for _, test := range tests {
+		r := testErrorResponseFor(t, test.parser, test.raw)
+		if r.Error().Code() != test.code {
+			t.Errorf("%s: expected code %d got %d", test.raw, test.code, r.Error().Code())
+		}
+	}
+}
+
+func TestErrorResponseForLimitErrorsHaveNullID(t *testing.T) {
+	for _, err := range []ParseError{MessageTooLarge, NestingTooDeep, TooManyElements, StringTooLong, BatchTooLong} {
+		r := ErrorResponseFor([]byte(`{"jsonrpc":"2.0", "method":"test", "id":1}`), err)
+		if !r.HasNullID() {
+			t.Errorf("%v: id should be null", err)
+		}
+	}
+}
+
+func TestMarshalErrorResponseForWithNullID(t *testing.T) {
+	r := ErrorResponseFor([]byte(`{`), InvalidMessage)
+	jsonResp, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedJSON := `{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request","data":"gojsonrpc: parse error: InvalidMessage"},"id":null}`
+	if string(jsonResp) != expectedJSON {
+		t.Errorf("expected %s, got %s\n", expectedJSON, jsonResp)
+	}
+
+	msg, err := ParseIncoming(string(jsonResp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !msg.(*Response).HasNullID() {
+		t.Error("parsed response should have a null id")
+	}
+}
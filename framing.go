@@ -0,0 +1,166 @@
+package gojsonrpc
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Framing is how messages are delimited on a stream connection.
+type Framing int
+
+const (
+	// NewlineFraming sends each message on its own line (NDJSON). Messages
+	// must not contain literal newlines, which encoding/json never produces.
+	// Blank lines are skipped.
+	NewlineFraming Framing = iota
+	// ContentLengthFraming precedes each message with a Content-Length header
+	// and a blank line, as in the Language Server Protocol. Other headers are
+	// ignored.
+	ContentLengthFraming
+)
+
+// DefaultMaxFrameBytes is the maximum length of a message read by ReadFrame
+// when maxBytes is zero.
+const DefaultMaxFrameBytes = 64 << 20
+
+// maxFrameHeaderLine is the maximum length of a Content-Length frame's header
+// line.
+const maxFrameHeaderLine = 4096
+
+// ErrInvalidFrame is returned when a Content-Length frame's headers can't be
+// read, or a header line is too long. The stream can't be resynchronised after
+// it.
+var ErrInvalidFrame = errors.New("gojsonrpc: invalid frame header")
+
+// ReadFrame reads the next message from r. Messages longer than maxBytes, or
+// DefaultMaxFrameBytes if maxBytes is zero, are skipped and MessageTooLarge is
+// returned, leaving r at the start of the next message.
+func (f Framing) ReadFrame(r *bufio.Reader, maxBytes int) ([]byte, error) {
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxFrameBytes
+	}
+	if f == ContentLengthFraming {
+		return readContentLengthFrame(r, maxBytes)
+	}
+
+	for {
+		line, err := readLine(r, maxBytes)
+		if err != nil {
+			return nil, err
+		}
+		if line = bytes.TrimSpace(line); len(line) != 0 {
+			return line, nil
+		}
+	}
+}
+
+// readLine reads up to the next newline, which is dropped. A last line without
+// a newline is returned as is.
+func readLine(r *bufio.Reader, maxBytes int) ([]byte, error) {
+	var line []byte
+	tooLarge := false
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if !tooLarge {
+			line = append(line, chunk...)
+			if len(bytes.TrimRight(line, "\r\n")) > maxBytes {
+				tooLarge, line = true, nil
+			}
+		}
+
+		switch {
+		case err == bufio.ErrBufferFull:
+			continue
+		case err == io.EOF && (len(line) != 0 || tooLarge):
+		case err != nil:
+			return nil, err
+		}
+
+		if tooLarge {
+			return nil, MessageTooLarge
+		}
+		return bytes.TrimSuffix(line, []byte("\n")), nil
+	}
+}
+
+func readContentLengthFrame(r *bufio.Reader, maxBytes int) ([]byte, error) {
+	length := -1
+	for {
+		line, err := readHeaderLine(r)
+		if err != nil {
+			if err == io.EOF && (line != "" || length >= 0) {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			if length < 0 {
+				// Tolerate blank lines between frames.
+				continue
+			}
+			break
+		}
+
+		colon := strings.IndexByte(line, ':')
+		if colon < 0 {
+			return nil, ErrInvalidFrame
+		}
+		if strings.EqualFold(strings.TrimSpace(line[:colon]), "Content-Length") {
+			n, err := strconv.Atoi(strings.TrimSpace(line[colon+1:]))
+			if err != nil || n < 0 {
+				return nil, ErrInvalidFrame
+			}
+			length = n
+		}
+	}
+
+	if length > maxBytes {
+		if _, err := r.Discard(length); err != nil {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, MessageTooLarge
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+// readHeaderLine is like r.ReadString('\n'), but fails with ErrInvalidFrame
+// once the line is longer than maxFrameHeaderLine.
+func readHeaderLine(r *bufio.Reader) (string, error) {
+	var line []byte
+	for {
+		chunk, err := r.ReadSlice('\n')
+		line = append(line, chunk...)
+		if len(line) > maxFrameHeaderLine {
+			return "", ErrInvalidFrame
+		}
+		if err != bufio.ErrBufferFull {
+			return string(line), err
+		}
+	}
+}
+
+// WriteFrame writes data to w as a single message.
+func (f Framing) WriteFrame(w io.Writer, data []byte) error {
+	var err error
+	if f == ContentLengthFraming {
+		_, err = fmt.Fprintf(w, "Content-Length: %d\r\n\r\n%s", len(data), data)
+	} else {
+		_, err = fmt.Fprintf(w, "%s\n", data)
+	}
+	return err
+}
@@ -0,0 +1,97 @@
+package gojsonrpc
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestFramingRoundTrip(t *testing.T) {
+	messages := []string{`{"a":1}`, `[]`, `"é"`}
+
+	for _, f := range []Framing{NewlineFraming, ContentLengthFraming} {
+		var b bytes.Buffer
+		for _, m := range messages {
+			if err := f.WriteFrame(&b, []byte(m)); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		r := bufio.NewReader(&b)
+		for _, m := range messages {
+			data, err := f.ReadFrame(r, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != m {
+				t.Errorf("framing %d: expected %s got %s", f, m, data)
+			}
+		}
+		if _, err := f.ReadFrame(r, 0); err != io.EOF {
+			t.Errorf("framing %d: expected EOF got %v", f, err)
+		}
+	}
+}
+
+func TestNewlineFraming(t *testing.T) {
+	r := bufio.NewReaderSize(strings.NewReader("\n  \r\n{\"a\":1}\r\n"+strings.Repeat("x", 100)+"\n[]"), 16)
+
+	expected := []struct {
+		data string
+		err  error
+	}{
+		{`{"a":1}`, nil},
+		{``, MessageTooLarge},
+		{`[]`, nil},
+		{``, io.EOF},
+	}
+	for _, e := range expected {
+		data, err := NewlineFraming.ReadFrame(r, 10)
+		if string(data) != e.data || err != e.err {
+			t.Errorf("expected %q %v got %q %v", e.data, e.err, data, err)
+		}
+	}
+}
+
+func TestContentLengthFraming(t *testing.T) {
+	input := "Content-Length: 7\r\nContent-Type: application/json\r\n\r\n{\"a\":1}" +
+		"\r\ncontent-length:20\r\n\r\n" + strings.Repeat("x", 20) +
+		"Content-Length: 2\r\n\r\n[]" +
+		"Content-Length: x\r\n\r\n"
+	r := bufio.NewReader(strings.NewReader(input))
+
+	expected := []struct {
+		data string
+		err  error
+	}{
+		{`{"a":1}`, nil},
+		{``, MessageTooLarge},
+		{`[]`, nil},
+		{``, ErrInvalidFrame},
+	}
+	for _, e := range expected {
+		data, err := ContentLengthFraming.ReadFrame(r, 10)
+		if string(data) != e.data || err != e.err {
+			t.Errorf("expected %q %v got %q %v", e.data, e.err, data, err)
+		}
+	}
+
+	for _, input := range []string{"Content-Length: 5\r\n\r\n[]", "Content-Length: 5\r\n", "no colon\r\n\r\n", "X: " + strings.Repeat("x", 10000)} {
+		_, err := ContentLengthFraming.ReadFrame(bufio.NewReader(strings.NewReader(input)), 0)
+		if err != io.ErrUnexpectedEOF && err != ErrInvalidFrame {
+			t.Errorf("%q: expected an error got %v", input, err)
+		}
+	}
+
+	// Without maxBytes, DefaultMaxFrameBytes applies.
+	r = bufio.NewReader(strings.NewReader("Content-Length: 1000000000000\r\n\r\n"))
+	if _, err := ContentLengthFraming.ReadFrame(r, 0); err != io.ErrUnexpectedEOF {
+		t.Errorf("expected %v got %v", io.ErrUnexpectedEOF, err)
+	}
+	r = bufio.NewReader(strings.NewReader(strings.Repeat("x", DefaultMaxFrameBytes+1) + "\n[]\n"))
+	if _, err := NewlineFraming.ReadFrame(r, 0); err != MessageTooLarge {
+		t.Errorf("expected %v got %v", MessageTooLarge, err)
+	}
+}
@@ -1,31 +1,126 @@
 // Package gojsonrpc provides an interface for dealing with JSON-RPC APIs.
 package gojsonrpc
 
-import (
-	"encoding/json"
-	"reflect"
-)
+import "encoding/json"
+
+// Parser holds the options used when parsing incoming messages. The zero value
+// is ready to use and only accepts JSON-RPC 2.0 messages, exactly like
+// ParseIncoming.
+type Parser struct {
+	// AllowVersion1 enables the JSON-RPC 1.0 dialect. Messages without a
+	// jsonrpc field (or with a jsonrpc field of "1.0", as sent by some
+	// Bitcoin-style clients) are then parsed as 1.0 messages, and the returned
+	// values will marshal back to 1.0. As with 2.0, request ids must be
+	// non-negative integers: 1.0 requests with any other id, such as a
+	// string, are rejected as invalid.
+	AllowVersion1 bool
+
+	// UseNumber causes numbers in params, results and error data to be
+	// decoded as json.Number instead of float64, so that integers above 2^53
+	// keep their exact value and numbers outside float64's range are
+	// accepted.
+	UseNumber bool
+
+	// Strict rejects input that encoding/json would otherwise accept: objects
+	// with duplicate keys at any level (DuplicateKey), invalid UTF-8
+	// (InvalidUTF8) and \u escapes of unpaired UTF-16 surrogates
+	// (LoneSurrogate). Use this when the message may also be read by another
+	// JSON parser, e.g. behind a proxy that authorizes by method.
+	Strict bool
+
+	// Limits, if non-nil, bounds the size and shape of accepted messages. See
+	// Limits for the errors returned when a limit is exceeded.
+	Limits *Limits
+}
 
 // ParseIncoming attempts to parse the supplied message into one of the three
 // relevant types: Notification, Request or Response. Callers must run a type
 // assertion to identify which type was returned.
 func ParseIncoming(message string) (Message, error) {
+	return new(Parser).ParseIncoming(message)
+}
+
+// ParseIncoming behaves like the package level ParseIncoming, using the
+// options set on p.
+func (p *Parser) ParseIncoming(message string) (Message, error) {
+	return p.parse([]byte(message), heapAllocator{})
+}
+
+// parse implements ParseIncoming, using alloc to get the value it returns.
+func (p *Parser) parse(data []byte, alloc allocator) (Message, error) {
+	if p.Strict || p.Limits != nil {
+		if err := scanMessage(data, p.Strict, p.Limits); err != nil {
+			return nil, err
+		}
+	}
+
+	unmarshal := p.unmarshaler()
+	if msg, ok, err := parseCommon(data, alloc, unmarshal); ok {
+		return msg, err
+	}
+
 	var incomingMap map[string]json.RawMessage
-	err := json.Unmarshal([]byte(message), &incomingMap)
+	err := json.Unmarshal(data, &incomingMap)
 	if err != nil {
 		return nil, err
 	}
 
-	// Look for jsonrpc field, return error if not present.
+	return p.parseIncomingMap(data, incomingMap, alloc, unmarshal)
+}
+
+// unmarshaler returns the function used to decode messages: json.Unmarshal,
+// or decodeUseNumber if UseNumber is set. Only params, results and error data
+// are affected, as IDs and error codes are decoded straight into integer
+// types, which reject out of range or fractional values rather than
+// truncating them.
+func (p *Parser) unmarshaler() func(data []byte, v interface{}) error {
+	if p.UseNumber {
+		return decodeUseNumber
+	}
+	return json.Unmarshal
+}
+
+// parseCommon parses the most common messages - JSON-RPC 2.0 requests,
+// notifications and result responses whose members are all known, unescaped
+// and unique - without decoding them into a map first. ok is false for other
+// messages, which are left to parseIncomingMap.
+func parseCommon(data []byte, alloc allocator, unmarshal func([]byte, interface{}) error) (msg Message, ok bool, err error) {
+	var buf [len(messageKeys)]string
+	keys, version, ok := scanMessageKeys(data, &buf)
+	if !ok || string(version) != `"`+Version+`"` {
+		return nil, false, nil
+	}
+
+	switch {
+	case isNotification(keys):
+		msg, err = parseIncomingNotification(data, alloc.notification(), unmarshal)
+	case isRequest(keys):
+		msg, err = parseIncomingRequest(data, alloc.request(), unmarshal)
+	case isResultResponse(keys):
+		msg, err = parseIncomingResponse(data, alloc.response(), unmarshal)
+	default:
+		return nil, false, nil
+	}
+	return msg, true, err
+}
+
+func (p *Parser) parseIncomingMap(data []byte, incomingMap map[string]json.RawMessage, alloc allocator, unmarshal func([]byte, interface{}) error) (Message, error) {
+	// Look for jsonrpc field. Without one, this can only be a 1.0 message.
 	if _, ok := incomingMap[VersionKey]; !ok {
+		if p.AllowVersion1 {
+			return parseIncomingV1(incomingMap, alloc, unmarshal)
+		}
 		return nil, InvalidMessage
 	}
 
 	// Check version is correct.
 	var incomingVersion string
-	err = json.Unmarshal(incomingMap[VersionKey], &incomingVersion)
+	err := json.Unmarshal(incomingMap[VersionKey], &incomingVersion)
 	if err != nil {
 		return nil, err
+	} else if p.AllowVersion1 && incomingVersion == Version1 {
+		delete(incomingMap, VersionKey)
+		return parseIncomingV1(incomingMap, alloc, unmarshal)
 	} else if incomingVersion != Version {
 		return nil, InvalidVersion
 	}
@@ -38,12 +133,12 @@ func ParseIncoming(message string) (Message, error) {
 	}
 
 	if isNotification(keys) {
-		return parseIncomingNotification([]byte(message))
+		return parseIncomingNotification(data, alloc.notification(), unmarshal)
 	} else if isRequest(keys) {
-		return parseIncomingRequest([]byte(message))
+		return parseIncomingRequest(data, alloc.request(), unmarshal)
 	} else if isErrorResponse(keys) {
 		// Check that the error is valid
-		var errorMap map[string]interface{}
+		var errorMap map[string]json.RawMessage
 		if err := json.Unmarshal(incomingMap[ErrorKey], &errorMap); err != nil {
 			return nil, err
 		}
@@ -53,61 +148,48 @@ func ParseIncoming(message string) (Message, error) {
 			errKeys = append(errKeys, k)
 		}
 		if isValidResponseError(errKeys) {
-			return parseIncomingResponse([]byte(message))
+			return parseIncomingResponse(data, alloc.response(), unmarshal)
 		}
 	} else if isResultResponse(keys) {
-		return parseIncomingResponse([]byte(message))
+		return parseIncomingResponse(data, alloc.response(), unmarshal)
 	}
 
 	// If not caught by one of the above, must be an malformed message.
 	return nil, InvalidMessage
 }
 
-func parseIncomingNotification(jsonNotif []byte) (*Notification, error) {
-	notif := new(Notification)
-	if err := json.Unmarshal(jsonNotif, notif); err != nil {
+func parseIncomingNotification(jsonNotif []byte, notif *Notification, unmarshal func([]byte, interface{}) error) (Message, error) {
+	if err := unmarshal(jsonNotif, &notif.notificationData); err != nil {
 		return nil, err
 	}
 
-	if notif.Params() != nil {
-		// Params must be a JSON array or object.
-		value := reflect.ValueOf(notif.Params())
-		kind := value.Kind()
-		if kind != reflect.Slice && kind != reflect.Map {
-			return nil, InvalidMessage
-		}
+	// Params must be a JSON array or object.
+	params, ok := normalizeParams(notif.Params())
+	if !ok {
+		return nil, InvalidMessage
 	}
-
-	// No need to check that the map is of type map[string]interface{} because
-	// the encoding/json package does this for us.
+	notif.notificationData.Params = params
 
 	return notif, nil
 }
 
-func parseIncomingRequest(jsonReq []byte) (*Request, error) {
-	req := new(Request)
-	if err := json.Unmarshal(jsonReq, req); err != nil {
+func parseIncomingRequest(jsonReq []byte, req *Request, unmarshal func([]byte, interface{}) error) (Message, error) {
+	if err := unmarshal(jsonReq, &req.requestData); err != nil {
 		return nil, err
 	}
 
-	if req.Params() != nil {
-		// Params must be a JSON array or object.
-		value := reflect.ValueOf(req.Params())
-		kind := value.Kind()
-		if kind != reflect.Slice && kind != reflect.Map {
-			return nil, InvalidMessage
-		}
+	// Params must be a JSON array or object.
+	params, ok := normalizeParams(req.Params())
+	if !ok {
+		return nil, InvalidMessage
 	}
-
-	// No need to check that the map is of type map[string]interface{} because
-	// the encoding/json package does this for us.
+	req.requestData.Params = params
 
 	return req, nil
 }
 
-func parseIncomingResponse(jsonResp []byte) (*Response, error) {
-	resp := new(Response)
-	if err := json.Unmarshal(jsonResp, resp); err != nil {
+func parseIncomingResponse(jsonResp []byte, resp *Response, unmarshal func([]byte, interface{}) error) (Message, error) {
+	if err := resp.unmarshal(jsonResp, unmarshal); err != nil {
 		return nil, err
 	}
 
@@ -0,0 +1,198 @@
+package gojsonrpc
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Errors returned for GET calls whose query can't be turned into a request.
+var (
+	errInvalidGETParams = errors.New("params must be URL encoded JSON")
+	errInvalidGETID     = errors.New("id must be URL encoded JSON")
+)
+
+// HTTPHandler answers JSON-RPC messages POSTed over HTTP. The body of a POST
+// holds a message or a batch, and the reply is sent as the body of the
+// response, with status 200, or with status 204 if there is nothing to send.
+//
+// If SafeMethods is set, the methods it lists can also be called with GET, so
+// that their responses can be cached by proxies and browsers:
+//
+//	GET /?method=name&params=[1,2]&id=1
+//	GET <PathPrefix>name?params={"a":1}&id=1
+//
+// params must be URL encoded JSON, and may be left out along with id, which
+// defaults to 0. A Signature for the request built from the query can be sent
+// in the SignatureHeader, as with POST. Successful responses carry an ETag and
+// Cache-Control max-age=MaxAge, and requests whose If-None-Match matches the
+// ETag are answered with 304 Not Modified. Error responses aren't cached, and
+// responses vary with the SignatureHeader, so that a cache doesn't hand a
+// signed call's response to an unsigned one.
+type HTTPHandler struct {
+	// Dispatcher handles the messages received.
+	Dispatcher *Dispatcher
+	// SafeMethods lists the methods that may be called with GET. They must
+	// have no side effects.
+	SafeMethods map[string]bool
+	// PathPrefix, if set, enables GET calls naming the method in the path
+	// rather than in the query, e.g. "/rpc/" for /rpc/name.
+	PathPrefix string
+	// MaxAge is how long successful GET responses may be cached. If zero,
+	// they are sent with Cache-Control no-cache, so caches must revalidate
+	// them using their ETag.
+	MaxAge time.Duration
+}
+
+// ServeHTTP implements http.Handler.
+func (h *HTTPHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d := h.Dispatcher
+	if d == nil {
+		d = new(Dispatcher)
+	}
+
+	switch {
+	case r.Method == http.MethodPost:
+		h.post(w, r, d)
+	case (r.Method == http.MethodGet || r.Method == http.MethodHead) && h.SafeMethods != nil:
+		h.get(w, r, d)
+	default:
+		allow := "POST"
+		if h.SafeMethods != nil {
+			allow = "GET, HEAD, POST"
+		}
+		w.Header().Set("Allow", allow)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *HTTPHandler) post(w http.ResponseWriter, r *http.Request, d *Dispatcher) {
+	body := r.Body
+	if d.Parser.Limits != nil && d.Parser.Limits.MaxBytes > 0 {
+		body = http.MaxBytesReader(w, body, int64(d.Parser.Limits.MaxBytes))
+	}
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	ctx, err := contextWithRequestSignature(r.Context(), r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	reply := d.DispatchRaw(ctx, data)
+	if reply == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(reply)
+}
+
+func (h *HTTPHandler) get(w http.ResponseWriter, r *http.Request, d *Dispatcher) {
+	query := r.URL.Query()
+	method := query.Get("method")
+	if h.PathPrefix != "" && strings.HasPrefix(r.URL.Path, h.PathPrefix) {
+		method = strings.TrimPrefix(r.URL.Path, h.PathPrefix)
+	}
+	if !h.SafeMethods[method] {
+		// Unsafe methods must not be reachable by a link.
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method "+strconv.Quote(method)+" can't be called with GET", http.StatusMethodNotAllowed)
+		return
+	}
+
+	message, err := getMessage(method, query.Get("params"), query.Get("id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, err := contextWithRequestSignature(r.Context(), r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	resp := d.Dispatch(ctx, string(message))
+	reply, err := json.Marshal(resp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	header := w.Header()
+	header.Set("Content-Type", "application/json")
+	header.Set("Vary", SignatureHeader)
+	if resp.IsError() {
+		header.Set("Cache-Control", "no-store")
+		w.Write(reply)
+		return
+	}
+
+	sum := sha256.Sum256(reply)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	header.Set("ETag", etag)
+	if h.MaxAge > 0 {
+		header.Set("Cache-Control", "max-age="+strconv.Itoa(int(h.MaxAge/time.Second)))
+	} else {
+		header.Set("Cache-Control", "no-cache")
+	}
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	if r.Method == http.MethodHead {
+		header.Set("Content-Length", strconv.Itoa(len(reply)))
+		return
+	}
+	w.Write(reply)
+}
+
+// getMessage builds the request for a GET call. Whether params and id are
+// valid for a request is left for the Parser to check.
+func getMessage(method, params, id string) ([]byte, error) {
+	if id == "" {
+		id = "0"
+	}
+
+	fields := map[string]json.RawMessage{
+		VersionKey: json.RawMessage(strconv.Quote(Version)),
+		IDKey:      json.RawMessage(id),
+	}
+	name, err := json.Marshal(method)
+	if err != nil {
+		return nil, err
+	}
+	fields[MethodKey] = name
+	if !json.Valid([]byte(id)) {
+		return nil, errInvalidGETID
+	}
+	if params != "" {
+		if !json.Valid([]byte(params)) {
+			return nil, errInvalidGETParams
+		}
+		fields[ParamsKey] = json.RawMessage(params)
+	}
+	return json.Marshal(fields)
+}
+
+// etagMatches tells whether an If-None-Match header matches etag.
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == etag || tag == "*" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,139 @@
+package gojsonrpc
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testHTTPServer(t *testing.T, h *HTTPHandler) *httptest.Server {
+	h.Dispatcher = testDispatcher()
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func testHTTPGet(t *testing.T, u string, header http.Header) (*http.Response, string) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(body)
+}
+
+func TestHTTPHandlerPost(t *testing.T) {
+	srv := testHTTPServer(t, new(HTTPHandler))
+
+	tests := []struct {
+		body   string
+		status int
+		reply  string
+	}{
+		{`{"jsonrpc":"2.0", "method":"echo", "params":[1], "id":1}`, http.StatusOK,
+			`{"jsonrpc":"2.0","result":[1],"id":1}`},
+		{`[{"jsonrpc":"2.0", "method":"echo", "params":[1], "id":1}]`, http.StatusOK,
+			`[{"jsonrpc":"2.0","result":[1],"id":1}]`},
+		{`{"jsonrpc":"2.0", "method":"echo"}`, http.StatusNoContent, ``},
+	}
+	for _, test := range tests {
+		resp, err := http.Post(srv.URL, "application/json", strings.NewReader(test.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != test.status || string(body) != test.reply {
+			t.Errorf("%s: expected %d %s got %d %s", test.body, test.status, test.reply, resp.StatusCode, body)
+		}
+	}
+
+	// GET is only allowed with SafeMethods.
+	if resp, _ := testHTTPGet(t, srv.URL+"?method=echo", nil); resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405 got %s", resp.Status)
+	}
+}
+
+func TestHTTPHandlerGet(t *testing.T) {
+	srv := testHTTPServer(t, &HTTPHandler{
+		SafeMethods: map[string]bool{"echo": true, "fail": true},
+		PathPrefix:  "/rpc/",
+		MaxAge:      time.Minute,
+	})
+
+	tests := []struct {
+		path   string
+		status int
+		reply  string
+	}{
+		{"/?method=echo&params=" + url.QueryEscape(`[1,"a"]`) + "&id=7", http.StatusOK,
+			`{"jsonrpc":"2.0","result":[1,"a"],"id":7}`},
+		{"/rpc/echo?params=" + url.QueryEscape(`{"a":1}`), http.StatusOK,
+			`{"jsonrpc":"2.0","result":{"a":1},"id":0}`},
+		{"/rpc/echo", http.StatusOK,
+			`{"jsonrpc":"2.0","result":null,"id":0}`},
+		{"/rpc/fail?id=2", http.StatusOK,
+			`{"jsonrpc":"2.0","error":{"code":1,"message":"failed"},"id":2}`},
+		{"/rpc/echo?params=1", http.StatusOK,
+			`{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request","data":"gojsonrpc: parse error: InvalidMessage"},"id":0}`},
+		{"/rpc/echo?params=%7B", http.StatusBadRequest, "params must be URL encoded JSON\n"},
+		{"/rpc/echo?id=x", http.StatusBadRequest, "id must be URL encoded JSON\n"},
+		{"/?method=missing", http.StatusMethodNotAllowed, "method \"missing\" can't be called with GET\n"},
+		{"/rpc/missing", http.StatusMethodNotAllowed, "method \"missing\" can't be called with GET\n"},
+	}
+	for _, test := range tests {
+		resp, body := testHTTPGet(t, srv.URL+test.path, nil)
+		if resp.StatusCode != test.status || body != test.reply {
+			t.Errorf("%s: expected %d %s got %d %s", test.path, test.status, test.reply, resp.StatusCode, body)
+		}
+	}
+}
+
+func TestHTTPHandlerGetCaching(t *testing.T) {
+	srv := testHTTPServer(t, &HTTPHandler{SafeMethods: map[string]bool{"echo": true, "fail": true}, MaxAge: time.Minute})
+
+	resp, _ := testHTTPGet(t, srv.URL+"?method=echo&params=[1]&id=1", nil)
+	etag := resp.Header.Get("ETag")
+	if etag == "" || resp.Header.Get("Cache-Control") != "max-age=60" {
+		t.Fatalf("expected caching headers got %v", resp.Header)
+	}
+
+	resp, body := testHTTPGet(t, srv.URL+"?method=echo&params=[1]&id=1", http.Header{"If-None-Match": {`"other", ` + etag}})
+	if resp.StatusCode != http.StatusNotModified || body != "" {
+		t.Errorf("expected 304 got %s %s", resp.Status, body)
+	}
+
+	resp, _ = testHTTPGet(t, srv.URL+"?method=echo&params=[2]&id=1", http.Header{"If-None-Match": {etag}})
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("ETag") == etag {
+		t.Errorf("expected a new response got %s %v", resp.Status, resp.Header)
+	}
+
+	resp, _ = testHTTPGet(t, srv.URL+"?method=fail&id=1", nil)
+	if resp.Header.Get("ETag") != "" || resp.Header.Get("Cache-Control") != "no-store" {
+		t.Errorf("errors must not be cached, got %v", resp.Header)
+	}
+}
+
+func TestHTTPHandlerGetNoMaxAge(t *testing.T) {
+	srv := testHTTPServer(t, &HTTPHandler{SafeMethods: map[string]bool{"echo": true}})
+
+	resp, _ := testHTTPGet(t, srv.URL+"?method=echo&params=[1]&id=1", nil)
+	if resp.Header.Get("ETag") == "" || resp.Header.Get("Cache-Control") != "no-cache" {
+		t.Errorf("expected an ETag and no-cache got %v", resp.Header)
+	}
+}
@@ -0,0 +1,314 @@
+package gojsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultHubQueueSize is the number of notifications queued per connection
+// when Hub.QueueSize is zero.
+const DefaultHubQueueSize = 256
+
+// rawSender is implemented by Peers that can send an encoded message as is,
+// which lets a Hub encode each notification only once.
+type rawSender interface {
+	sendRaw(data []byte) error
+}
+
+// Hub broadcasts notifications to the connections that joined a topic. Each
+// notification is encoded once, whatever the number of connections, and queued
+// for each of them; every connection has its own queue and goroutine, so a
+// slow connection doesn't hold the others up.
+//
+// Connections are removed when they close, when sending to them fails, or,
+// with the DisconnectPeer policy, when their queue overflows. Fields must be
+// set before the Hub is first used. The zero value is ready to use.
+//
+// Connections are told apart by the channel their Done method returns, not by
+// comparing Peers, which needn't be comparable. Done must therefore return the
+// same channel every time, and a different one for each connection.
+type Hub struct {
+	// QueueSize is the number of notifications queued per connection. If
+	// zero, DefaultHubQueueSize is used.
+	QueueSize int
+	// Policy is what happens when a connection's queue is full.
+	// BlockPublisher makes Publish wait, holding up the other connections.
+	Policy SlowPolicy
+
+	mu      sync.Mutex
+	members map[<-chan struct{}]*hubMember
+	topics  map[string]map[*hubMember]struct{}
+
+	published uint64
+	delivered uint64
+	dropped   uint64
+	removed   uint64
+}
+
+// HubStats holds the counters of a Hub.
+type HubStats struct {
+	// Peers and Topics are the numbers of connections and topics joined.
+	Peers, Topics int
+	// Queued is the number of notifications waiting in all queues, and
+	// MaxQueued the length of the longest queue.
+	Queued, MaxQueued int
+	// Published counts calls to Publish, Delivered notifications sent to a
+	// connection, and Dropped notifications lost to full queues.
+	Published, Delivered, Dropped uint64
+	// Removed counts the connections removed because they closed, failed or
+	// were too slow.
+	Removed uint64
+}
+
+// hubMember is a connection that joined at least one topic. key is its Done
+// channel.
+type hubMember struct {
+	peer   Peer
+	key    <-chan struct{}
+	queue  chan hubMessage
+	topics map[string]struct{}
+	done   chan struct{}
+	once   sync.Once
+}
+
+// hubMessage is a notification and its encoding.
+type hubMessage struct {
+	notif *Notification
+	data  []byte
+}
+
+// Join adds peer to topic. Handlers get their peer from PeerFromContext. peer
+// is identified by its Done channel, see Hub.
+func (h *Hub) Join(peer Peer, topic string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	key := peer.Done()
+	m, ok := h.members[key]
+	if !ok {
+		size := h.QueueSize
+		if size <= 0 {
+			size = DefaultHubQueueSize
+		}
+		m = &hubMember{
+			peer:   peer,
+			key:    key,
+			queue:  make(chan hubMessage, size),
+			topics: make(map[string]struct{}),
+			done:   make(chan struct{}),
+		}
+		if h.members == nil {
+			h.members = make(map[<-chan struct{}]*hubMember)
+			h.topics = make(map[string]map[*hubMember]struct{})
+		}
+		h.members[key] = m
+		go h.deliver(m)
+	}
+
+	m.topics[topic] = struct{}{}
+	if h.topics[topic] == nil {
+		h.topics[topic] = make(map[*hubMember]struct{})
+	}
+	h.topics[topic][m] = struct{}{}
+}
+
+// Leave removes peer from topic.
+func (h *Hub) Leave(peer Peer, topic string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	m, ok := h.members[peer.Done()]
+	if !ok {
+		return
+	}
+	h.leaveLocked(m, topic)
+	if len(m.topics) == 0 {
+		h.removeLocked(m)
+	}
+}
+
+func (h *Hub) leaveLocked(m *hubMember, topic string) {
+	delete(m.topics, topic)
+	delete(h.topics[topic], m)
+	if len(h.topics[topic]) == 0 {
+		delete(h.topics, topic)
+	}
+}
+
+func (h *Hub) removeLocked(m *hubMember) {
+	for topic := range m.topics {
+		h.leaveLocked(m, topic)
+	}
+	delete(h.members, m.key)
+	m.once.Do(func() { close(m.done) })
+}
+
+// Remove removes peer from all topics.
+func (h *Hub) Remove(peer Peer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if m, ok := h.members[peer.Done()]; ok {
+		h.removeLocked(m)
+	}
+}
+
+// drop removes m because it closed, failed or was too slow.
+func (h *Hub) drop(m *hubMember) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.members[m.key] == m {
+		h.removeLocked(m)
+		atomic.AddUint64(&h.removed, 1)
+	}
+}
+
+// Publish sends a notification for method with params to the connections
+// that joined topic, returning the number of connections it was queued for.
+func (h *Hub) Publish(topic, method string, params interface{}) (int, error) {
+	notif, err := MakeNotification(method, params)
+	if err != nil {
+		return 0, err
+	}
+	data, err := json.Marshal(notif)
+	if err != nil {
+		return 0, err
+	}
+	msg := hubMessage{notif: notif, data: data}
+	atomic.AddUint64(&h.published, 1)
+
+	h.mu.Lock()
+	members := make([]*hubMember, 0, len(h.topics[topic]))
+	for m := range h.topics[topic] {
+		members = append(members, m)
+	}
+	h.mu.Unlock()
+
+	queued := 0
+	for _, m := range members {
+		if h.enqueue(m, msg) {
+			queued++
+		}
+	}
+	return queued, nil
+}
+
+// enqueue queues msg for m, applying the Policy if its queue is full.
+func (h *Hub) enqueue(m *hubMember, msg hubMessage) bool {
+	if h.Policy == BlockPublisher {
+		select {
+		case m.queue <- msg:
+			return true
+		case <-m.done:
+			return false
+		}
+	}
+
+	select {
+	case m.queue <- msg:
+		return true
+	case <-m.done:
+		return false
+	default:
+	}
+
+	atomic.AddUint64(&h.dropped, 1)
+	if h.Policy == DisconnectPeer {
+		h.drop(m)
+		m.peer.Close()
+	}
+	return false
+}
+
+// deliver sends the notifications queued for m until it is removed or its
+// connection closes.
+func (h *Hub) deliver(m *hubMember) {
+	raw, isRaw := m.peer.(rawSender)
+	for {
+		select {
+		case msg := <-m.queue:
+			var err error
+			if isRaw {
+				err = raw.sendRaw(msg.data)
+			} else {
+				err = m.peer.Send(msg.notif)
+			}
+			if err != nil {
+				h.drop(m)
+				m.peer.Close()
+				return
+			}
+			atomic.AddUint64(&h.delivered, 1)
+		case <-m.peer.Done():
+			h.drop(m)
+			return
+		case <-m.done:
+			return
+		}
+	}
+}
+
+// Stats returns the Hub's counters.
+func (h *Hub) Stats() HubStats {
+	h.mu.Lock()
+	stats := HubStats{Peers: len(h.members), Topics: len(h.topics)}
+	for _, m := range h.members {
+		n := len(m.queue)
+		stats.Queued += n
+		if n > stats.MaxQueued {
+			stats.MaxQueued = n
+		}
+	}
+	h.mu.Unlock()
+
+	stats.Published = atomic.LoadUint64(&h.published)
+	stats.Delivered = atomic.LoadUint64(&h.delivered)
+	stats.Dropped = atomic.LoadUint64(&h.dropped)
+	stats.Removed = atomic.LoadUint64(&h.removed)
+	return stats
+}
+
+// Queued returns the number of notifications queued for peer.
+func (h *Hub) Queued(peer Peer) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if m, ok := h.members[peer.Done()]; ok {
+		return len(m.queue)
+	}
+	return 0
+}
+
+// JoinHandler returns a HandlerFunc adding the caller to the topic given as
+// its only param. Its result is true.
+func (h *Hub) JoinHandler() HandlerFunc {
+	return h.topicHandler(h.Join)
+}
+
+// LeaveHandler returns a HandlerFunc removing the caller from the topic given
+// as its only param. Its result is true.
+func (h *Hub) LeaveHandler() HandlerFunc {
+	return h.topicHandler(h.Leave)
+}
+
+func (h *Hub) topicHandler(fn func(peer Peer, topic string)) HandlerFunc {
+	return func(ctx context.Context, params interface{}) (interface{}, *Error) {
+		list, ok := params.([]interface{})
+		if !ok || len(list) != 1 {
+			return nil, MakeError(CodeInvalidParams, "Invalid params", "expected [topic]")
+		}
+		topic, ok := list[0].(string)
+		if !ok {
+			return nil, MakeError(CodeInvalidParams, "Invalid params", "the topic must be a string")
+		}
+		peer, ok := PeerFromContext(ctx)
+		if !ok {
+			return nil, AsError(ErrNoPeer)
+		}
+		fn(peer, topic)
+		return true, nil
+	}
+}
@@ -0,0 +1,267 @@
+package gojsonrpc
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testHubServer serves "join" and "leave" for hub on a pipe.
+func testHubServer(t *testing.T, hub *Hub) *PipeEnd {
+	d := new(Dispatcher)
+	d.Register("join", hub.JoinHandler())
+	d.Register("leave", hub.LeaveHandler())
+
+	client, server := NewPipe()
+	client.Serialize = true
+	go server.Serve(context.Background(), d)
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// testRawPeer is a Peer recording the encoded messages it is sent.
+type testRawPeer struct {
+	mu   sync.Mutex
+	raw  [][]byte
+	sent chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+func newTestRawPeer() *testRawPeer {
+	return &testRawPeer{sent: make(chan struct{}, 16), done: make(chan struct{})}
+}
+
+func (p *testRawPeer) Send(msg Message) error {
+	panic("Send called on a rawSender")
+}
+
+func (p *testRawPeer) sendRaw(data []byte) error {
+	p.mu.Lock()
+	p.raw = append(p.raw, data)
+	p.mu.Unlock()
+	p.sent <- struct{}{}
+	return nil
+}
+
+func (p *testRawPeer) Close() error {
+	p.once.Do(func() { close(p.done) })
+	return nil
+}
+
+func (p *testRawPeer) Done() <-chan struct{} {
+	return p.done
+}
+
+func (p *testRawPeer) wait(t *testing.T) {
+	select {
+	case <-p.sent:
+	case <-time.After(5 * time.Second):
+		t.Fatal("nothing sent")
+	}
+}
+
+// testWaitHub waits until cond holds for the Hub's stats.
+func testWaitHub(t *testing.T, hub *Hub, cond func(HubStats) bool) HubStats {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		stats := hub.Stats()
+		if cond(stats) {
+			return stats
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("unexpected stats %+v", stats)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestHub(t *testing.T) {
+	hub := new(Hub)
+	a, b := testHubServer(t, hub), testHubServer(t, hub)
+	testCall(t, a, "join", []interface{}{"news"}, 1)
+	testCall(t, a, "join", []interface{}{"sport"}, 2)
+	testCall(t, b, "join", []interface{}{"news"}, 1)
+
+	if stats := hub.Stats(); stats.Peers != 2 || stats.Topics != 2 {
+		t.Errorf("expected 2 peers and 2 topics got %+v", stats)
+	}
+
+	tests := []struct {
+		topic    string
+		expected int
+	}{
+		{"news", 2},
+		{"sport", 1},
+		{"weather", 0},
+	}
+	for _, test := range tests {
+		n, err := hub.Publish(test.topic, "update", []interface{}{test.topic})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != test.expected {
+			t.Errorf("%s: expected %d peers got %d", test.topic, test.expected, n)
+		}
+	}
+
+	for _, expected := range []string{"news", "sport"} {
+		notif, ok := testReceive(t, a).(*Notification)
+		if !ok || notif.Method() != "update" || notif.Params().([]interface{})[0] != expected {
+			t.Errorf("a: expected %s update got %v", expected, notif)
+		}
+	}
+	notif, ok := testReceive(t, b).(*Notification)
+	if !ok || notif.Params().([]interface{})[0] != "news" {
+		t.Errorf("b: expected news update got %v", notif)
+	}
+
+	testCall(t, b, "leave", []interface{}{"news"}, 2)
+	if n, _ := hub.Publish("news", "update", nil); n != 1 {
+		t.Errorf("expected 1 peer after leave got %d", n)
+	}
+	testReceive(t, a)
+
+	stats := testWaitHub(t, hub, func(s HubStats) bool { return s.Delivered == 4 })
+	if stats.Peers != 1 || stats.Published != 4 || stats.Dropped != 0 || stats.Removed != 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestHubEncodesOnce(t *testing.T) {
+	hub := new(Hub)
+	p1, p2 := newTestRawPeer(), newTestRawPeer()
+	hub.Join(p1, "t")
+	hub.Join(p2, "t")
+
+	if _, err := hub.Publish("t", "update", []interface{}{1}); err != nil {
+		t.Fatal(err)
+	}
+	p1.wait(t)
+	p2.wait(t)
+
+	p1.mu.Lock()
+	p2.mu.Lock()
+	defer p1.mu.Unlock()
+	defer p2.mu.Unlock()
+	if string(p1.raw[0]) != `{"jsonrpc":"2.0","method":"update","params":[1]}` {
+		t.Errorf("unexpected encoding %s", p1.raw[0])
+	}
+	if &p1.raw[0][0] != &p2.raw[0][0] {
+		t.Error("the notification should be encoded once")
+	}
+}
+
+func TestHubRemovesClosedPeers(t *testing.T) {
+	hub := new(Hub)
+	peer := newTestRawPeer()
+	hub.Join(peer, "a")
+	hub.Join(peer, "b")
+
+	peer.Close()
+	stats := testWaitHub(t, hub, func(s HubStats) bool { return s.Peers == 0 })
+	if stats.Topics != 0 || stats.Removed != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	if n, _ := hub.Publish("a", "update", nil); n != 0 {
+		t.Errorf("expected no peers got %d", n)
+	}
+
+	hub.Join(peer, "a")
+	hub.Remove(peer)
+	if stats = hub.Stats(); stats.Peers != 0 || stats.Removed != 1 {
+		t.Errorf("Remove: unexpected stats %+v", stats)
+	}
+}
+
+// testValuePeer is a Peer whose type isn't comparable.
+type testValuePeer struct {
+	*testRawPeer
+	tags []string
+}
+
+func TestHubNonComparablePeers(t *testing.T) {
+	hub := new(Hub)
+	raw := newTestRawPeer()
+	peer := testValuePeer{raw, []string{"a"}}
+	hub.Join(peer, "a")
+	hub.Join(testValuePeer{raw, nil}, "b")
+	if stats := hub.Stats(); stats.Peers != 1 || stats.Topics != 2 {
+		t.Errorf("expected 1 peer and 2 topics got %+v", stats)
+	}
+
+	if n, _ := hub.Publish("b", "update", nil); n != 1 {
+		t.Errorf("expected 1 peer got %d", n)
+	}
+	raw.wait(t)
+	if hub.Queued(peer) != 0 {
+		t.Errorf("expected nothing queued got %d", hub.Queued(peer))
+	}
+
+	hub.Leave(peer, "a")
+	hub.Remove(peer)
+	if stats := hub.Stats(); stats.Peers != 0 || stats.Topics != 0 {
+		t.Errorf("Remove: unexpected stats %+v", stats)
+	}
+}
+
+func TestHubSlowPolicies(t *testing.T) {
+	for _, policy := range []SlowPolicy{DropNotifications, DisconnectPeer} {
+		hub := &Hub{QueueSize: 1, Policy: policy}
+		slow, fast := newTestSlowPeer(), newTestRawPeer()
+		hub.Join(slow, "t")
+		hub.Join(fast, "t")
+
+		// One notification may be held by the blocked Send, and one queued.
+		for i := 0; i < 3; i++ {
+			if _, err := hub.Publish("t", "update", []interface{}{i}); err != nil {
+				t.Fatal(err)
+			}
+			fast.wait(t)
+			time.Sleep(5 * time.Millisecond)
+		}
+
+		stats := hub.Stats()
+		if stats.Dropped != 1 {
+			t.Errorf("%d: expected 1 dropped got %+v", policy, stats)
+		}
+		switch policy {
+		case DropNotifications:
+			if stats.Peers != 2 || hub.Queued(slow) != 1 {
+				t.Errorf("drop: the slow peer should stay with a full queue, got %+v", stats)
+			}
+			close(slow.release)
+			testWaitHub(t, hub, func(s HubStats) bool { return s.Queued == 0 })
+		case DisconnectPeer:
+			select {
+			case <-slow.Done():
+			default:
+				t.Error("disconnect: the slow peer should be closed")
+			}
+			if stats.Peers != 1 || stats.Removed != 1 {
+				t.Errorf("disconnect: unexpected stats %+v", stats)
+			}
+		}
+		fast.Close()
+	}
+}
+
+func TestHubHandlerErrors(t *testing.T) {
+	hub := new(Hub)
+	handler := hub.JoinHandler()
+	tests := []struct {
+		params interface{}
+		ctx    context.Context
+		code   int
+	}{
+		{nil, ContextWithPeer(context.Background(), newTestRawPeer()), CodeInvalidParams},
+		{[]interface{}{1}, ContextWithPeer(context.Background(), newTestRawPeer()), CodeInvalidParams},
+		{[]interface{}{"t"}, context.Background(), AsError(ErrNoPeer).Code()},
+	}
+	for _, test := range tests {
+		if _, err := handler(test.ctx, test.params); err == nil || err.Code() != test.code {
+			t.Errorf("%v: expected error %d got %v", test.params, test.code, err)
+		}
+	}
+}
@@ -0,0 +1,307 @@
+package gojsonrpc
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+)
+
+// MessagePackCodec encodes messages using MessagePack. The messages have the
+// same structure as their JSON counterparts: a map with the same keys and
+// values.
+type MessagePackCodec struct {
+	Parser Parser
+}
+
+// Encode converts msg to MessagePack. Integers in params or results that
+// don't fit in 64 bits can't be represented, and cause ErrUnsupportedValue.
+func (c *MessagePackCodec) Encode(msg Message) ([]byte, error) {
+	tree, err := jsonTree(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	return appendMsgpack(nil, tree)
+}
+
+// Decode converts data to JSON and parses it with c.Parser.
+func (c *MessagePackCodec) Decode(data []byte) (Message, error) {
+	r, err := newBinaryReader(data, &c.Parser)
+	if err != nil {
+		return nil, err
+	}
+
+	w := new(jsonWriter)
+	if err = r.msgpackToJSON(w); err != nil {
+		return nil, err
+	}
+	if r.pos != len(r.data) {
+		return nil, InvalidMessage
+	}
+
+	return c.Parser.ParseIncoming(w.String())
+}
+
+func appendMsgpack(dst []byte, v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case nil:
+		return append(dst, 0xc0), nil
+	case bool:
+		if v {
+			return append(dst, 0xc3), nil
+		}
+		return append(dst, 0xc2), nil
+	case json.Number:
+		i, u, f, kind, err := jsonNumber(v)
+		if err != nil {
+			return nil, err
+		}
+		switch kind {
+		case 'i':
+			if i >= 0 {
+				return appendMsgpackUint(dst, uint64(i)), nil
+			}
+			return appendMsgpackInt(dst, i), nil
+		case 'u':
+			return appendMsgpackUint(dst, u), nil
+		case 'f':
+			return appendUint(append(dst, 0xcb), math.Float64bits(f), 8), nil
+		}
+		return nil, ErrUnsupportedValue
+	case string:
+		return append(appendMsgpackHeader(dst, 0xa0, 0xd9, 0xda, 0xdb, 32, len(v)), v...), nil
+	case []interface{}:
+		dst = appendMsgpackHeader(dst, 0x90, 0, 0xdc, 0xdd, 16, len(v))
+		for _, elem := range v {
+			var err error
+			if dst, err = appendMsgpack(dst, elem); err != nil {
+				return nil, err
+			}
+		}
+		return dst, nil
+	case map[string]interface{}:
+		dst = appendMsgpackHeader(dst, 0x80, 0, 0xde, 0xdf, 16, len(v))
+		for _, k := range sortedKeys(v) {
+			dst = append(appendMsgpackHeader(dst, 0xa0, 0xd9, 0xda, 0xdb, 32, len(k)), k...)
+
+			var err error
+			if dst, err = appendMsgpack(dst, v[k]); err != nil {
+				return nil, err
+			}
+		}
+		return dst, nil
+	}
+
+	return nil, ErrUnsupportedValue
+}
+
+// appendMsgpackHeader appends the header of a string, array or map of length
+// n. fix is the fixed format's prefix, used when n < fixMax, and b8, b16 and
+// b32 are the prefixes of the formats with 8, 16 and 32 bit lengths (b8 is 0
+// for arrays and maps, which have no such format).
+func appendMsgpackHeader(dst []byte, fix, b8, b16, b32 byte, fixMax, n int) []byte {
+	switch {
+	case n < fixMax:
+		return append(dst, fix|byte(n))
+	case b8 != 0 && n <= math.MaxUint8:
+		return append(dst, b8, byte(n))
+	case n <= math.MaxUint16:
+		return appendUint(append(dst, b16), uint64(n), 2)
+	}
+
+	return appendUint(append(dst, b32), uint64(n), 4)
+}
+
+func appendMsgpackUint(dst []byte, u uint64) []byte {
+	switch {
+	case u <= 0x7f:
+		return append(dst, byte(u))
+	case u <= math.MaxUint8:
+		return append(dst, 0xcc, byte(u))
+	case u <= math.MaxUint16:
+		return appendUint(append(dst, 0xcd), u, 2)
+	case u <= math.MaxUint32:
+		return appendUint(append(dst, 0xce), u, 4)
+	}
+
+	return appendUint(append(dst, 0xcf), u, 8)
+}
+
+func appendMsgpackInt(dst []byte, i int64) []byte {
+	switch {
+	case i >= -32:
+		return append(dst, byte(i))
+	case i >= math.MinInt8:
+		return append(dst, 0xd0, byte(i))
+	case i >= math.MinInt16:
+		return appendUint(append(dst, 0xd1), uint64(i), 2)
+	case i >= math.MinInt32:
+		return appendUint(append(dst, 0xd2), uint64(i), 4)
+	}
+
+	return appendUint(append(dst, 0xd3), uint64(i), 8)
+}
+
+// msgpackToJSON converts the next MessagePack value to JSON.
+func (r *binaryReader) msgpackToJSON(w *jsonWriter) error {
+	b, err := r.byte()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case b <= 0x7f:
+		w.WriteString(strconv.FormatUint(uint64(b), 10))
+		return nil
+	case b >= 0xe0:
+		w.WriteString(strconv.FormatInt(int64(int8(b)), 10))
+		return nil
+	case b >= 0x80 && b <= 0x8f:
+		return r.msgpackMapToJSON(w, uint64(b&0x0f))
+	case b >= 0x90 && b <= 0x9f:
+		return r.msgpackArrayToJSON(w, uint64(b&0x0f))
+	case b >= 0xa0 && b <= 0xbf:
+		return r.msgpackStrToJSON(w, uint64(b&0x1f))
+	}
+
+	switch b {
+	case 0xc0:
+		w.WriteString("null")
+	case 0xc2:
+		w.WriteString("false")
+	case 0xc3:
+		w.WriteString("true")
+	case 0xc4, 0xc5, 0xc6:
+		n, err := r.uint(1 << (b - 0xc4))
+		if err != nil {
+			return err
+		}
+		bin, err := r.next(n)
+		if err != nil {
+			return err
+		}
+		return w.writeBinary(bin)
+	case 0xca:
+		u, err := r.uint(4)
+		if err != nil {
+			return err
+		}
+		return w.writeFloat(float64(math.Float32frombits(uint32(u))), 32)
+	case 0xcb:
+		u, err := r.uint(8)
+		if err != nil {
+			return err
+		}
+		return w.writeFloat(math.Float64frombits(u), 64)
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		u, err := r.uint(1 << (b - 0xcc))
+		if err != nil {
+			return err
+		}
+		w.WriteString(strconv.FormatUint(u, 10))
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		n := uint64(1) << (b - 0xd0)
+		u, err := r.uint(n)
+		if err != nil {
+			return err
+		}
+		// Sign extend from n bytes.
+		shift := 64 - 8*n
+		w.WriteString(strconv.FormatInt(int64(u<<shift)>>shift, 10))
+	case 0xd9, 0xda, 0xdb:
+		n, err := r.uint(1 << (b - 0xd9))
+		if err != nil {
+			return err
+		}
+		return r.msgpackStrToJSON(w, n)
+	case 0xdc, 0xdd:
+		n, err := r.uint(2 << (b - 0xdc))
+		if err != nil {
+			return err
+		}
+		return r.msgpackArrayToJSON(w, n)
+	case 0xde, 0xdf:
+		n, err := r.uint(2 << (b - 0xde))
+		if err != nil {
+			return err
+		}
+		return r.msgpackMapToJSON(w, n)
+	default:
+		// Extension types and the never used 0xc1.
+		return ErrUnsupportedValue
+	}
+
+	return nil
+}
+
+func (r *binaryReader) msgpackStrToJSON(w *jsonWriter, n uint64) error {
+	s, err := r.next(n)
+	if err != nil {
+		return err
+	}
+
+	w.writeString(s)
+	return nil
+}
+
+func (r *binaryReader) msgpackArrayToJSON(w *jsonWriter, n uint64) error {
+	if err := r.enter(); err != nil {
+		return err
+	}
+
+	w.WriteByte('[')
+	for i := uint64(0); i < n; i++ {
+		if i > 0 {
+			w.WriteByte(',')
+		}
+		if err := r.msgpackToJSON(w); err != nil {
+			return err
+		}
+	}
+	w.WriteByte(']')
+
+	r.leave()
+	return nil
+}
+
+func (r *binaryReader) msgpackMapToJSON(w *jsonWriter, n uint64) error {
+	if err := r.enter(); err != nil {
+		return err
+	}
+
+	w.WriteByte('{')
+	for i := uint64(0); i < n; i++ {
+		if i > 0 {
+			w.WriteByte(',')
+		}
+
+		// Keys must be strings.
+		b, err := r.byte()
+		if err != nil {
+			return err
+		}
+		var keyLen uint64
+		switch {
+		case b >= 0xa0 && b <= 0xbf:
+			keyLen = uint64(b & 0x1f)
+		case b >= 0xd9 && b <= 0xdb:
+			if keyLen, err = r.uint(1 << (b - 0xd9)); err != nil {
+				return err
+			}
+		default:
+			return ErrUnsupportedValue
+		}
+		if err = r.msgpackStrToJSON(w, keyLen); err != nil {
+			return err
+		}
+
+		w.WriteByte(':')
+		if err = r.msgpackToJSON(w); err != nil {
+			return err
+		}
+	}
+	w.WriteByte('}')
+
+	r.leave()
+	return nil
+}
@@ -0,0 +1,446 @@
+package gojsonrpc
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/rpc"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// codeServerError is used for errors returned by net/rpc services that aren't
+// *Errors. It is the first code of the range the specification reserves for
+// implementation-defined server errors.
+const codeServerError = -32000
+
+// ServerCodec is a net/rpc ServerCodec speaking JSON-RPC 2.0, with one
+// message per JSON value on the connection. Use it with rpc.ServeCodec.
+//
+// Request IDs may be numbers, strings or null: they are mapped to net/rpc
+// sequence numbers and restored in the responses. Requests that can't be
+// parsed are answered using ErrorResponseFor, and notifications are run
+// without sending their response.
+//
+// net/rpc only passes on the text of the errors returned by services. Errors
+// whose text is that of an *Error are sent with the Error's code and message,
+// but without its data. Unknown services and methods are sent as
+// CodeMethodNotFound errors, params that can't be decoded as
+// CodeInvalidParams and other errors as server errors (code -32000).
+type ServerCodec struct {
+	// Parser is used to parse requests.
+	Parser Parser
+
+	in     *maxBytesReader
+	dec    *json.Decoder
+	closer io.Closer
+	wmu    sync.Mutex
+	w      *bufio.Writer
+
+	mu      sync.Mutex
+	seq     uint64
+	pending map[uint64]pendingRPC
+	params  interface{}
+}
+
+// pendingRPC is a request that has been read but not answered.
+type pendingRPC struct {
+	id           json.RawMessage
+	notification bool
+}
+
+// NewServerCodec returns a ServerCodec reading requests from and writing
+// responses to conn.
+func NewServerCodec(conn io.ReadWriteCloser) *ServerCodec {
+	in := &maxBytesReader{r: conn, n: -1}
+	return &ServerCodec{
+		in:      in,
+		dec:     json.NewDecoder(in),
+		closer:  conn,
+		w:       bufio.NewWriter(conn),
+		pending: make(map[uint64]pendingRPC),
+	}
+}
+
+// ReadRequestHeader implements rpc.ServerCodec. If the Parser's Limits set
+// MaxBytes, a message that is too long is answered with an error and the
+// connection is closed, as the rest of it can't be skipped.
+func (c *ServerCodec) ReadRequestHeader(r *rpc.Request) error {
+	for {
+		c.in.n = -1
+		if l := c.Parser.Limits; l != nil && l.MaxBytes > 0 {
+			// One more byte for the newline separating messages.
+			c.in.n = l.MaxBytes + 1
+		}
+		var raw json.RawMessage
+		if err := c.dec.Decode(&raw); err != nil {
+			if err == MessageTooLarge {
+				c.write(ErrorResponseFor(nil, err), nil)
+			}
+			return err
+		}
+
+		c.mu.Lock()
+		seq := c.seq
+		c.seq++
+		c.mu.Unlock()
+
+		msg, id, err := c.parse(raw, seq)
+		if err != nil {
+			if err = c.write(ErrorResponseFor(raw, err), id); err != nil {
+				return err
+			}
+			continue
+		}
+
+		switch m := msg.(type) {
+		case *Request:
+			r.ServiceMethod, r.Seq = m.Method(), seq
+			c.params = m.Params()
+			c.setPending(seq, pendingRPC{id: id})
+			return nil
+		case *Notification:
+			r.ServiceMethod, r.Seq = m.Method(), seq
+			c.params = m.Params()
+			c.setPending(seq, pendingRPC{notification: true})
+			return nil
+		}
+		// Responses aren't expected by a server, and are ignored.
+	}
+}
+
+// maxBytesReader fails with MessageTooLarge once n bytes have been read from
+// r, unless n is negative.
+type maxBytesReader struct {
+	r io.Reader
+	n int
+}
+
+func (r *maxBytesReader) Read(p []byte) (int, error) {
+	if r.n < 0 {
+		return r.r.Read(p)
+	}
+	if r.n == 0 {
+		return 0, MessageTooLarge
+	}
+	if len(p) > r.n {
+		p = p[:r.n]
+	}
+	n, err := r.r.Read(p)
+	r.n -= n
+	return n, err
+}
+
+// parse parses raw, replacing its ID with seq so that IDs of any type can be
+// handled by the parser. The original ID is returned, or nil if there wasn't
+// one or raw is a 1.0 notification. Strict and Limits are checked on raw as it
+// was received.
+func (c *ServerCodec) parse(raw json.RawMessage, seq uint64) (Message, json.RawMessage, error) {
+	p := c.Parser
+	if p.Strict || p.Limits != nil {
+		if err := scanMessage(raw, p.Strict, p.Limits); err != nil {
+			return nil, nil, err
+		}
+		// Already checked, and the new ID mustn't count against the limits.
+		p.Strict, p.Limits = false, nil
+	}
+
+	bounds, ok := memberValues(raw, IDKey)
+	if !ok || len(bounds) == 0 {
+		msg, err := p.ParseIncoming(string(raw))
+		return msg, nil, err
+	}
+
+	// As in encoding/json, the last of duplicate members wins.
+	last := bounds[len(bounds)-1]
+	id := raw[last[0]:last[1]]
+
+	// IDs must be strings, numbers or null.
+	var v interface{}
+	if err := json.Unmarshal(id, &v); err != nil {
+		return nil, nil, err
+	}
+	switch v.(type) {
+	case nil:
+		if p.AllowVersion1 && isVersion1Message(raw) {
+			// A 1.0 request with a null id is a notification.
+			msg, err := p.ParseIncoming(string(raw))
+			return msg, nil, err
+		}
+	case string, float64:
+	default:
+		return nil, nil, InvalidMessage
+	}
+
+	replaced := make([]byte, 0, len(raw))
+	prev := 0
+	for _, b := range bounds {
+		replaced = append(replaced, raw[prev:b[0]]...)
+		replaced = strconv.AppendUint(replaced, seq, 10)
+		prev = b[1]
+	}
+	replaced = append(replaced, raw[prev:]...)
+
+	msg, err := p.ParseIncoming(string(replaced))
+	return msg, id, err
+}
+
+// isVersion1Message tells whether raw, an object, has no jsonrpc member or a
+// jsonrpc member of "1.0".
+func isVersion1Message(raw []byte) bool {
+	bounds, _ := memberValues(raw, VersionKey)
+	if len(bounds) == 0 {
+		return true
+	}
+	last := bounds[len(bounds)-1]
+	var version string
+	return json.Unmarshal(raw[last[0]:last[1]], &version) == nil && version == Version1
+}
+
+func (c *ServerCodec) setPending(seq uint64, p pendingRPC) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pending[seq] = p
+}
+
+// ReadRequestBody implements rpc.ServerCodec. Params given by name are
+// decoded into body. Params given by position are decoded into body if it is
+// a slice or array, and otherwise their only element is decoded into body.
+func (c *ServerCodec) ReadRequestBody(body interface{}) error {
+	params := c.params
+	c.params = nil
+	if body == nil || params == nil {
+		return nil
+	}
+
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(raw, body); err == nil {
+		return nil
+	}
+
+	if list, ok := params.([]interface{}); ok && len(list) == 1 {
+		if raw, err = json.Marshal(list[0]); err != nil {
+			return err
+		}
+		err = json.Unmarshal(raw, body)
+	}
+	return err
+}
+
+// WriteResponse implements rpc.ServerCodec.
+func (c *ServerCodec) WriteResponse(r *rpc.Response, body interface{}) error {
+	c.mu.Lock()
+	p, ok := c.pending[r.Seq]
+	delete(c.pending, r.Seq)
+	c.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("gojsonrpc: no pending request with seq %d", r.Seq)
+	}
+	if p.notification {
+		return nil
+	}
+
+	var resp *Response
+	if r.Error != "" {
+		resp, _ = MakeResponseWithError(netRPCError(r.Error), 0)
+	} else {
+		resp = MakeResponseWithResult(body, 0)
+	}
+	return c.write(resp, p.id)
+}
+
+// netRPCError converts the text of an error sent by a net/rpc server.
+func netRPCError(text string) *Error {
+	if e, ok := parseErrorText(text); ok {
+		return e
+	}
+
+	switch {
+	case strings.HasPrefix(text, "rpc: can't find service "), strings.HasPrefix(text, "rpc: can't find method "),
+		strings.HasPrefix(text, "rpc: service/method request ill-formed: "):
+		return MakeError(CodeMethodNotFound, "Method not found", text)
+	case strings.HasPrefix(text, "json: "):
+		// The text of errors returned by ReadRequestBody.
+		return MakeError(CodeInvalidParams, "Invalid params", text)
+	}
+	return MakeError(codeServerError, text, nil)
+}
+
+// parseErrorText recovers the code and message of an Error from the text
+// returned by its Error method.
+func parseErrorText(text string) (*Error, bool) {
+	const prefix = "jsonrpc error "
+	if !strings.HasPrefix(text, prefix) {
+		return nil, false
+	}
+
+	rest := text[len(prefix):]
+	colon := strings.Index(rest, ": ")
+	if colon < 0 {
+		return nil, false
+	}
+	code, err := strconv.Atoi(rest[:colon])
+	if err != nil {
+		return nil, false
+	}
+	return MakeError(code, rest[colon+2:], nil), true
+}
+
+// write sends resp with its ID replaced by id, if id isn't nil.
+func (c *ServerCodec) write(resp *Response, id json.RawMessage) error {
+	raw, err := json.Marshal(resp)
+	if err != nil {
+		resp, _ = MakeResponseWithError(MakeError(CodeInternalError, "Internal error", err.Error()), 0)
+		if raw, err = json.Marshal(resp); err != nil {
+			return err
+		}
+	}
+
+	if id != nil {
+		var outgoingMap map[string]json.RawMessage
+		if err = json.Unmarshal(raw, &outgoingMap); err != nil {
+			return err
+		}
+		outgoingMap[IDKey] = id
+		if raw, err = json.Marshal(outgoingMap); err != nil {
+			return err
+		}
+	}
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	c.w.Write(raw)
+	c.w.WriteByte('\n')
+	return c.w.Flush()
+}
+
+// Close implements rpc.ServerCodec.
+func (c *ServerCodec) Close() error {
+	return c.closer.Close()
+}
+
+// ClientCodec is a net/rpc ClientCodec speaking JSON-RPC 2.0, with one message
+// per JSON value on the connection. Use it with rpc.NewClientWithCodec.
+//
+// The args of a call are sent as the params if they encode to a JSON object or
+// array, and as the only element of an array otherwise. Error responses are
+// returned by net/rpc as rpc.ServerErrors holding the text of the *Error;
+// ErrorFromNetRPC recovers the code and message.
+type ClientCodec struct {
+	// Parser is used to parse responses. Numbers in results are always
+	// decoded as if UseNumber were set.
+	Parser Parser
+
+	dec    *json.Decoder
+	closer io.Closer
+	w      *bufio.Writer
+	resp   *Response
+}
+
+// NewClientCodec returns a ClientCodec writing requests to and reading
+// responses from conn.
+func NewClientCodec(conn io.ReadWriteCloser) *ClientCodec {
+	return &ClientCodec{
+		dec:    json.NewDecoder(conn),
+		closer: conn,
+		w:      bufio.NewWriter(conn),
+	}
+}
+
+// WriteRequest implements rpc.ClientCodec.
+func (c *ClientCodec) WriteRequest(r *rpc.Request, body interface{}) error {
+	params := body
+	if _, ok := normalizeParams(body); !ok {
+		params = []interface{}{body}
+	}
+
+	req, err := MakeRequest(r.ServiceMethod, params, uint(r.Seq))
+	if err != nil {
+		return err
+	}
+	raw, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	c.w.Write(raw)
+	c.w.WriteByte('\n')
+	return c.w.Flush()
+}
+
+// ReadResponseHeader implements rpc.ClientCodec.
+func (c *ClientCodec) ReadResponseHeader(r *rpc.Response) error {
+	p := c.Parser
+	p.UseNumber = true
+
+	for {
+		var raw json.RawMessage
+		if err := c.dec.Decode(&raw); err != nil {
+			return err
+		}
+
+		msg, err := p.ParseIncoming(string(raw))
+		if err != nil {
+			return err
+		}
+		resp, ok := msg.(*Response)
+		if !ok {
+			// Requests and notifications from the server aren't supported by
+			// net/rpc, and are ignored.
+			continue
+		}
+		if resp.HasNullID() {
+			if resp.IsError() {
+				// The server couldn't tell which request this error is
+				// about.
+				return resp.Error()
+			}
+			return ErrUnexpectedResponse
+		}
+
+		c.resp = resp
+		r.Seq = uint64(resp.ID())
+		if resp.IsError() {
+			r.Error = resp.Error().Error()
+		}
+		return nil
+	}
+}
+
+// ReadResponseBody implements rpc.ClientCodec.
+func (c *ClientCodec) ReadResponseBody(body interface{}) error {
+	resp := c.resp
+	c.resp = nil
+	if body == nil || resp == nil || resp.IsError() {
+		return nil
+	}
+
+	raw, err := json.Marshal(resp.Result())
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, body)
+}
+
+// Close implements rpc.ClientCodec.
+func (c *ClientCodec) Close() error {
+	return c.closer.Close()
+}
+
+// ErrorFromNetRPC recovers the code and message of an *Error returned through
+// net/rpc, which only passes on the text of errors. It returns false if err
+// doesn't hold the text of an *Error.
+func ErrorFromNetRPC(err error) (*Error, bool) {
+	var serverErr rpc.ServerError
+	if !errors.As(err, &serverErr) {
+		return nil, false
+	}
+	return parseErrorText(string(serverErr))
+}
@@ -0,0 +1,218 @@
+package gojsonrpc
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/rpc"
+	"strings"
+	"testing"
+)
+
+type testArith int
+
+type ArithArgs struct {
+	A, B int
+}
+
+func (t *testArith) Add(args *ArithArgs, reply *int) error {
+	*reply = args.A + args.B
+	return nil
+}
+
+func (t *testArith) Sum(args []int, reply *int) error {
+	for _, n := range args {
+		*reply += n
+	}
+	return nil
+}
+
+func (t *testArith) Divide(args *ArithArgs, reply *int) error {
+	if args.B == 0 {
+		return MakeError(1, "division by zero", nil)
+	}
+	*reply = args.A / args.B
+	return nil
+}
+
+func (t *testArith) Fail(args *ArithArgs, reply *int) error {
+	return errors.New("plain error")
+}
+
+// testNetRPCServer serves testArith on one end of a pipe, returning the other.
+// parser is used by the ServerCodec.
+func testNetRPCServer(t *testing.T, parser Parser) net.Conn {
+	server := rpc.NewServer()
+	if err := server.RegisterName("Arith", new(testArith)); err != nil {
+		t.Fatal(err)
+	}
+
+	serverConn, clientConn := net.Pipe()
+	codec := NewServerCodec(serverConn)
+	codec.Parser = parser
+	go server.ServeCodec(codec)
+	t.Cleanup(func() { clientConn.Close() })
+	return clientConn
+}
+
+func TestServerCodec(t *testing.T) {
+	conn := testNetRPCServer(t, Parser{Strict: true, Limits: &Limits{MaxStringLength: 16}})
+	r := bufio.NewReader(conn)
+
+	tests := []struct {
+		request, response string
+	}{
+		{`{"jsonrpc":"2.0","method":"Arith.Add","params":{"A":1,"B":2},"id":1}`,
+			`{"id":1,"jsonrpc":"2.0","result":3}`},
+		{`{"jsonrpc":"2.0","method":"Arith.Add","params":[{"A":1,"B":2}],"id":"abc"}`,
+			`{"id":"abc","jsonrpc":"2.0","result":3}`},
+		{`{"jsonrpc":"2.0","method":"Arith.Sum","params":[1,2,3],"id":null}`,
+			`{"id":null,"jsonrpc":"2.0","result":6}`},
+		{`{"jsonrpc":"2.0","method":"Arith.Divide","params":{"A":1,"B":0},"id":"div"}`,
+			`{"error":{"code":1,"message":"division by zero"},"id":"div","jsonrpc":"2.0"}`},
+		{`{"jsonrpc":"2.0","method":"Arith.Fail","params":{},"id":2}`,
+			`{"error":{"code":-32000,"message":"plain error"},"id":2,"jsonrpc":"2.0"}`},
+		{`{"jsonrpc":"2.0","method":"Arith.Missing","id":3}`,
+			`{"error":{"code":-32601,"message":"Method not found","data":"rpc: can't find method Arith.Missing"},"id":3,"jsonrpc":"2.0"}`},
+		{`{"jsonrpc":"2.0","method":"Arith.Add","params":{"A":"x"},"id":4}`,
+			`{"error":{"code":-32602,"message":"Invalid params","data":"json: cannot unmarshal string into Go struct field ArithArgs.A of type int"},"id":4,"jsonrpc":"2.0"}`},
+		{`{"jsonrpc":"2.0","method":"Arith.Add","params":"bad","id":"s"}`,
+			`{"error":{"code":-32600,"message":"Invalid Request","data":"gojsonrpc: parse error: InvalidMessage"},"id":"s","jsonrpc":"2.0"}`},
+		{`{"jsonrpc":"2.0","method":"Arith.Add","id":{}}`,
+			`{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request","data":"gojsonrpc: parse error: InvalidMessage"},"id":null}`},
+		{`{"jsonrpc":"2.0","method":"Arith.Sum","params":[1],"\u0069d":6}`,
+			`{"id":6,"jsonrpc":"2.0","result":1}`},
+		// Strict and Limits apply to the message as received.
+		{`{"jsonrpc":"2.0","method":"Arith.Sum","method":"Arith.Add","params":[1],"id":7}`,
+			`{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request","data":"gojsonrpc: parse error: DuplicateKey"},"id":7}`},
+		{`{"jsonrpc":"2.0","method":"Arith.Sum","params":[1],"id":"a very long request ID"}`,
+			`{"jsonrpc":"2.0","error":{"code":-32600,"message":"Invalid Request","data":"gojsonrpc: parse error: StringTooLong"},"id":null}`},
+		// Notifications are run, but not answered.
+		{`{"jsonrpc":"2.0","method":"Arith.Add","params":{"A":1,"B":2}}` + "\n" +
+			`{"jsonrpc":"2.0","method":"Arith.Add","params":{"A":2,"B":2},"id":5}`,
+			`{"id":5,"jsonrpc":"2.0","result":4}`},
+	}
+
+	for _, test := range tests {
+		if _, err := conn.Write([]byte(test.request + "\n")); err != nil {
+			t.Fatal(err)
+		}
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line != test.response+"\n" {
+			t.Errorf("%s: expected %s got %s", test.request, test.response, line)
+		}
+	}
+}
+
+func TestServerCodecVersion1(t *testing.T) {
+	conn := testNetRPCServer(t, Parser{AllowVersion1: true})
+	r := bufio.NewReader(conn)
+
+	// The notification is run, but not answered.
+	request := `{"method":"Arith.Add","params":[{"A":1,"B":2}],"id":null}` + "\n" +
+		`{"method":"Arith.Add","params":[{"A":2,"B":2}],"id":"curltest"}` + "\n"
+	if _, err := conn.Write([]byte(request)); err != nil {
+		t.Fatal(err)
+	}
+	line, err := r.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := `{"id":"curltest","jsonrpc":"2.0","result":4}` + "\n"; line != expected {
+		t.Errorf("expected %s got %s", expected, line)
+	}
+}
+
+func TestServerCodecMaxBytes(t *testing.T) {
+	conn := testNetRPCServer(t, Parser{Limits: &Limits{MaxBytes: 64}})
+	r := bufio.NewReader(conn)
+
+	go conn.Write([]byte(`{"jsonrpc":"2.0","method":"Arith.Sum","params":[` + strings.Repeat("1,", 1000) + `1],"id":1}` + "\n"))
+	line, err := r.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"jsonrpc":"2.0","error":{"code":-32700,"message":"Parse error","data":"gojsonrpc: parse error: MessageTooLarge"},"id":null}` + "\n"
+	if line != expected {
+		t.Errorf("expected %s got %s", expected, line)
+	}
+	if _, err = r.ReadString('\n'); err != io.EOF {
+		t.Errorf("expected the connection to be closed, got %v", err)
+	}
+}
+
+func TestClientCodec(t *testing.T) {
+	client := rpc.NewClientWithCodec(NewClientCodec(testNetRPCServer(t, Parser{})))
+
+	var reply int
+	if err := client.Call("Arith.Add", &ArithArgs{1, 2}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply != 3 {
+		t.Errorf("expected 3 got %d", reply)
+	}
+
+	reply = 0
+	if err := client.Call("Arith.Sum", []int{1, 2, 3}, &reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply != 6 {
+		t.Errorf("expected 6 got %d", reply)
+	}
+
+	err := client.Call("Arith.Divide", &ArithArgs{1, 0}, &reply)
+	e, ok := ErrorFromNetRPC(err)
+	if !ok || e.Code() != 1 || e.Message() != "division by zero" {
+		t.Errorf("expected the division by zero error, got %v", err)
+	}
+
+	err = client.Call("Arith.Missing", &ArithArgs{}, &reply)
+	if e, ok = ErrorFromNetRPC(err); !ok || e.Code() != CodeMethodNotFound {
+		t.Errorf("expected a method not found error, got %v", err)
+	}
+
+	// Calls can run concurrently.
+	calls := make([]*rpc.Call, 20)
+	for i := range calls {
+		calls[i] = client.Go("Arith.Add", &ArithArgs{i, i}, new(int), nil)
+	}
+	for i, call := range calls {
+		<-call.Done
+		if call.Error != nil || *call.Reply.(*int) != 2*i {
+			t.Errorf("call %d: got %v %d", i, call.Error, *call.Reply.(*int))
+		}
+	}
+}
+
+func TestClientCodecNullID(t *testing.T) {
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	client := rpc.NewClientWithCodec(NewClientCodec(clientConn))
+	defer client.Close()
+
+	go func() {
+		bufio.NewReader(serverConn).ReadString('\n')
+		serverConn.Write([]byte(`{"jsonrpc":"2.0","result":1,"id":null}` + "\n"))
+	}()
+
+	var reply int
+	if err := client.Call("Arith.Add", &ArithArgs{1, 2}, &reply); err != ErrUnexpectedResponse {
+		t.Errorf("expected %v got %v", ErrUnexpectedResponse, err)
+	}
+}
+
+func TestErrorFromNetRPC(t *testing.T) {
+	if _, ok := ErrorFromNetRPC(errors.New("jsonrpc error 1: x")); ok {
+		t.Error("only rpc.ServerErrors should be converted")
+	}
+	if _, ok := ErrorFromNetRPC(rpc.ServerError("other")); ok {
+		t.Error("only the text of Errors should be converted")
+	}
+	if e, ok := ErrorFromNetRPC(rpc.ServerError("jsonrpc error -5: a: b")); !ok || e.Code() != -5 || e.Message() != "a: b" {
+		t.Errorf("unexpected %v %v", e, ok)
+	}
+}
@@ -1,9 +1,6 @@
 package gojsonrpc
 
-import (
-	"encoding/json"
-	"reflect"
-)
+import "encoding/json"
 
 type notificationData struct {
 	Jsonrpc string      `json:"jsonrpc"`
@@ -17,6 +14,11 @@ type Notification struct {
 	notificationData
 }
 
+// Reset clears n, so that it can be reused.
+func (n *Notification) Reset() {
+	n.notificationData = notificationData{}
+}
+
 // JSONRPCVersion returns the version of the protocol being used.
 func (n *Notification) JSONRPCVersion() string {
 	return n.notificationData.Jsonrpc
@@ -41,27 +43,11 @@ var NotificationValidAndExpectedKeys = map[string]bool{"jsonrpc": true, "method"
 
 // MakeNotification is used to create Notification structs - do not try to create
 // Notification's using a struct literal. You may pass nil for the params argument.
-// Else, params MUST be an array/slice or a map with string keys.
+// Else, params MUST marshal to a JSON array or object - see MakeRequest.
 func MakeNotification(method string, params interface{}) (*Notification, error) {
-	if params != nil {
-		// Params must be either an array/slice or a map with string keys.
-		value := reflect.ValueOf(params)
-		kind := value.Kind()
-		if kind != reflect.Array &&
-			kind != reflect.Slice &&
-			kind != reflect.Map &&
-			kind != reflect.Struct &&
-			kind != reflect.Ptr { // could be a pointer to one of the above
-			return nil, InvalidNotificationInvalidParamsType
-		} else if kind == reflect.Map && reflect.TypeOf(params).Key().Kind() != reflect.String { // For maps, we need to make sure the keys are strings.
-			return nil, InvalidNotificationInvalidParamsType
-		} else if kind == reflect.Ptr {
-			elemKind := reflect.TypeOf(params).Elem().Kind()
-			if elemKind != reflect.Array &&
-				elemKind != reflect.Struct {
-				return nil, InvalidNotificationInvalidParamsType
-			}
-		}
+	params, ok := normalizeParams(params)
+	if !ok {
+		return nil, InvalidNotificationInvalidParamsType
 	}
 
 	return &Notification{
@@ -76,6 +62,13 @@ func MakeNotification(method string, params interface{}) (*Notification, error)
 // Do not used this method directly. Instead, call json.Marshal with a
 // Notification as the argument.
 func (n *Notification) MarshalJSON() ([]byte, error) {
+	if n.JSONRPCVersion() == Version1 {
+		return json.Marshal(messageDataV1{
+			Method: n.Method(),
+			Params: paramsV1(n.Params()),
+		})
+	}
+
 	return json.Marshal(n.notificationData)
 }
 
@@ -96,16 +96,21 @@ func TestCreateNotificationWithInvalidParamsTypeString(t *testing.T) {
 	}
 }
 
-func TestCreateNotificationWithInvalidParamsTypeMapWithIntKeys(t *testing.T) {
-	// If params is a map, the keys must be strings.
+func TestCreateNotificationWithParamsTypeMapWithIntKeys(t *testing.T) {
+	// encoding/json marshals maps with integer keys to JSON objects, so these
+	// are valid params.
 	n, err := MakeNotification(testNotificationMethod, map[int]interface{}{1: "test", 2: true})
-	if err == nil {
-		t.Error("should have returned an error")
-	} else if err != InvalidNotificationInvalidParamsType {
-		t.Error("wrong error returned")
+	if err != nil {
+		t.Fatal(err)
 	}
-	if n != nil {
-		t.Error("notification should be nil")
+	jsonNotif, err := json.Marshal(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedJSON := `{"jsonrpc":"2.0","method":"test","params":{"1":"test","2":true}}`
+	if string(jsonNotif) != expectedJSON {
+		t.Errorf("expected %s, got %s\n", expectedJSON, jsonNotif)
 	}
 }
 
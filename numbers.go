@@ -0,0 +1,35 @@
+package gojsonrpc
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// unmarshalUseNumber decodes raw like json.Unmarshal into an interface{}, but
+// numbers are left as json.Number rather than converted to float64.
+func unmarshalUseNumber(raw json.RawMessage) (interface{}, error) {
+	var v interface{}
+	if err := decodeUseNumber(raw, &v); err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// decodeUseNumber behaves like json.Unmarshal, but numbers decoded into
+// interface{} values are left as json.Number. Unlike converting to float64,
+// this never fails, whatever the number's magnitude.
+func decodeUseNumber(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if len(bytes.TrimSpace(data[dec.InputOffset():])) != 0 {
+		// Let encoding/json describe the data after the value.
+		return json.Unmarshal(data, new(json.RawMessage))
+	}
+
+	return nil
+}
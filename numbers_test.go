@@ -0,0 +1,160 @@
+package gojsonrpc
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+var testParserUseNumber = &Parser{UseNumber: true}
+
+func TestParseIncomingUseNumberRequestParams(t *testing.T) {
+	rawMsg := `{"jsonrpc":"2.0", "method":"test", "params":[9007199254740993, {"amount":12345678901234567890}], "id":1}`
+	msg, err := testParserUseNumber.ParseIncoming(rawMsg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	params := msg.(*Request).Params().([]interface{})
+	if n, ok := params[0].(json.Number); !ok || n.String() != "9007199254740993" {
+		t.Errorf("expected json.Number 9007199254740993 got %#v", params[0])
+	}
+	amount := params[1].(map[string]interface{})["amount"]
+	if n, ok := amount.(json.Number); !ok || n.String() != "12345678901234567890" {
+		t.Errorf("expected json.Number 12345678901234567890 got %#v", amount)
+	}
+}
+
+func TestParseIncomingUseNumberNotificationParams(t *testing.T) {
+	rawMsg := `{"jsonrpc":"2.0", "method":"test", "params":{"key":9007199254740993}}`
+	msg, err := testParserUseNumber.ParseIncoming(rawMsg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v := msg.(*Notification).Params().(map[string]interface{})["key"]
+	if n, ok := v.(json.Number); !ok || n.String() != "9007199254740993" {
+		t.Errorf("expected json.Number 9007199254740993 got %#v", v)
+	}
+}
+
+func TestParseIncomingUseNumberResult(t *testing.T) {
+	rawMsg := `{"jsonrpc":"2.0", "result":9007199254740993, "id":1}`
+	msg, err := testParserUseNumber.ParseIncoming(rawMsg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := msg.(*Response)
+	if n, ok := r.Result().(json.Number); !ok || n.String() != "9007199254740993" {
+		t.Errorf("expected json.Number 9007199254740993 got %#v", r.Result())
+	}
+	if !r.IsResult() {
+		t.Error("IsResult should be true")
+	}
+}
+
+func TestParseIncomingUseNumberErrorData(t *testing.T) {
+	rawMsg := `{"jsonrpc":"2.0", "error":{"code":1, "message":"test", "data":[9007199254740993]}, "id":1}`
+	msg, err := testParserUseNumber.ParseIncoming(rawMsg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := msg.(*Response).Error().Data().([]interface{})
+	if n, ok := data[0].(json.Number); !ok || n.String() != "9007199254740993" {
+		t.Errorf("expected json.Number 9007199254740993 got %#v", data[0])
+	}
+}
+
+func TestParseIncomingUseNumberV1(t *testing.T) {
+	p := &Parser{AllowVersion1: true, UseNumber: true}
+	msg, err := p.ParseIncoming(`{"method":"test", "params":[9007199254740993], "id":1}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	params := msg.(*Request).Params().([]interface{})
+	if n, ok := params[0].(json.Number); !ok || n.String() != "9007199254740993" {
+		t.Errorf("expected json.Number 9007199254740993 got %#v", params[0])
+	}
+}
+
+func TestParseIncomingUseNumberOutOfRange(t *testing.T) {
+	tests := []struct {
+		raw  string
+		part func(Message) interface{}
+	}{
+		{`{"jsonrpc":"2.0","method":"m","params":[1e400],"id":1}`,
+			func(m Message) interface{} { return m.(*Request).Params().([]interface{})[0] }},
+		{`{"jsonrpc":"2.0","method":"m","params":{"n":-1e400}}`,
+			func(m Message) interface{} { return m.(*Notification).Params().(map[string]interface{})["n"] }},
+		{`{"jsonrpc":"2.0","result":1e400,"id":1}`,
+			func(m Message) interface{} { return m.(*Response).Result() }},
+		{`{"jsonrpc":"2.0","error":{"code":1,"message":"m","data":1e400},"id":1}`,
+			func(m Message) interface{} { return m.(*Response).Error().Data() }},
+		{`{"method":"m","params":[1e400],"id":1}`,
+			func(m Message) interface{} { return m.(*Request).Params().([]interface{})[0] }},
+		{`{"result":1e400,"error":null,"id":1}`,
+			func(m Message) interface{} { return m.(*Response).Result() }},
+	}
+
+	p := &Parser{UseNumber: true, AllowVersion1: true}
+	for _, test := range tests {
+		msg, err := p.ParseIncoming(test.raw)
+		if err != nil {
+			t.Errorf("%s: %v", test.raw, err)
+			continue
+		}
+		if n, ok := test.part(msg).(json.Number); !ok || (n != "1e400" && n != "-1e400") {
+			t.Errorf("%s: expected the json.Number 1e400 got %#v", test.raw, test.part(msg))
+		}
+	}
+}
+
+func TestMarshalUseNumberRoundTrip(t *testing.T) {
+	rawMsg := `{"jsonrpc":"2.0","method":"test","params":[12345678901234567890],"id":1}`
+	msg, err := testParserUseNumber.ParseIncoming(rawMsg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jsonReq, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(jsonReq) != rawMsg {
+		t.Errorf("expected %s, got %s\n", rawMsg, jsonReq)
+	}
+}
+
+func TestParseIncomingMaxID(t *testing.T) {
+	rawMsg := `{"jsonrpc":"2.0", "method":"test", "id":18446744073709551615}`
+	msg, err := ParseIncoming(rawMsg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if msg.(*Request).ID() != ^uint(0) {
+		t.Errorf("expected id %d got %d", ^uint(0), msg.(*Request).ID())
+	}
+}
+
+func TestParseIncomingRejectsUnrepresentableIDs(t *testing.T) {
+	ids := []string{"18446744073709551616", "-1", "1.5", "1e3"}
+	for _, id := range ids {
+		rawMsg := `{"jsonrpc":"2.0", "method":"test", "id":` + id + `}`
+		if _, err := ParseIncoming(rawMsg); err == nil {
+			t.Errorf("id %s should have been rejected", id)
+		}
+	}
+}
+
+func TestParseIncomingRejectsUnrepresentableErrorCodes(t *testing.T) {
+	codes := []string{"9223372036854775808", "1.5"}
+	for _, code := range codes {
+		rawMsg := `{"jsonrpc":"2.0", "error":{"code":` + code + `, "message":"test"}, "id":1}`
+		if _, err := ParseIncoming(rawMsg); err == nil {
+			t.Errorf("error code %s should have been rejected", code)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package gojsonrpc
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// OpenRPCVersion is the version of the OpenRPC specification that documents
+// returned by Dispatcher.OpenRPC follow.
+const OpenRPCVersion = "1.2.6"
+
+// DiscoverMethod is the method that returns the OpenRPC document of a
+// service, registered by Dispatcher.RegisterDiscover.
+const DiscoverMethod = "rpc.discover"
+
+// OpenRPCDocument is an OpenRPC document describing a service. Only the
+// fields that Dispatcher.OpenRPC fills in, and the schemas in components, are
+// included.
+type OpenRPCDocument struct {
+	OpenRPC    string             `json:"openrpc"`
+	Info       OpenRPCInfo        `json:"info"`
+	Methods    []OpenRPCMethod    `json:"methods"`
+	Components *OpenRPCComponents `json:"components,omitempty"`
+}
+
+// OpenRPCComponents holds definitions shared by a document's methods.
+type OpenRPCComponents struct {
+	// Schemas are referenced as "#/components/schemas/<name>".
+	Schemas map[string]map[string]interface{} `json:"schemas,omitempty"`
+}
+
+// OpenRPCInfo holds the metadata of a service.
+type OpenRPCInfo struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// OpenRPCMethod describes a method.
+type OpenRPCMethod struct {
+	Name           string                     `json:"name"`
+	Summary        string                     `json:"summary,omitempty"`
+	Description    string                     `json:"description,omitempty"`
+	Params         []OpenRPCContentDescriptor `json:"params"`
+	Result         *OpenRPCContentDescriptor  `json:"result,omitempty"`
+	Errors         []*Error                   `json:"errors,omitempty"`
+	ParamStructure string                     `json:"paramStructure,omitempty"`
+}
+
+// OpenRPCContentDescriptor describes a param or result.
+type OpenRPCContentDescriptor struct {
+	Name     string                 `json:"name"`
+	Required bool                   `json:"required,omitempty"`
+	Schema   map[string]interface{} `json:"schema"`
+}
+
+// MethodInfo holds documentation for a method that can't be derived from its
+// handler.
+type MethodInfo struct {
+	Summary     string
+	Description string
+	// Errors lists the errors the method may return.
+	Errors []*Error
+}
+
+// Describe sets the documentation of method, replacing any existing one.
+func (d *Dispatcher) Describe(method string, info MethodInfo) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.info == nil {
+		d.info = make(map[string]MethodInfo)
+	}
+	d.info[method] = info
+}
+
+// OpenRPC returns an OpenRPC document for the registered methods, in order of
+// name. Methods registered with RegisterFunc have their params and result
+// described by schemas derived from their Go types. Other methods are listed
+// without params and with an unconstrained result. Methods whose names start
+// with "rpc." are reserved for the protocol and left out.
+func (d *Dispatcher) OpenRPC(info OpenRPCInfo) *OpenRPCDocument {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	doc := &OpenRPCDocument{
+		OpenRPC: OpenRPCVersion,
+		Info:    info,
+		Methods: []OpenRPCMethod{},
+	}
+
+	names := make([]string, 0, len(d.handlers))
+	for name := range d.handlers {
+		if !strings.HasPrefix(name, "rpc.") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		methodInfo := d.info[name]
+		method := OpenRPCMethod{
+			Name:        name,
+			Summary:     methodInfo.Summary,
+			Description: methodInfo.Description,
+			Params:      []OpenRPCContentDescriptor{},
+			Result:      &OpenRPCContentDescriptor{Name: "result", Schema: map[string]interface{}{}},
+			Errors:      methodInfo.Errors,
+		}
+
+		if m, ok := d.typed[name]; ok {
+			for _, param := range m.params {
+				method.Params = append(method.Params, OpenRPCContentDescriptor{
+					Name:     param.name,
+					Required: param.required,
+					Schema:   typeSchema(param.typ, make(map[reflect.Type]bool)),
+				})
+			}
+			if m.paramsType != nil {
+				method.ParamStructure = "either"
+			}
+			method.Result.Schema = typeSchema(m.resultType, make(map[reflect.Type]bool))
+		}
+
+		doc.Methods = append(doc.Methods, method)
+	}
+
+	return doc
+}
+
+// RegisterDiscover registers DiscoverMethod, which returns the result of
+// OpenRPC(info) at the time it is called.
+func (d *Dispatcher) RegisterDiscover(info OpenRPCInfo) {
+	d.Register(DiscoverMethod, func(ctx context.Context, params interface{}) (interface{}, *Error) {
+		return d.OpenRPC(info), nil
+	})
+}
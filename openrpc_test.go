@@ -0,0 +1,106 @@
+package gojsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+type testOpenRPCNode struct {
+	Value    string             `json:"value"`
+	Children []*testOpenRPCNode `json:"children,omitempty"`
+}
+
+type testOpenRPCParams struct {
+	testOpenRPCEmbedded
+	ID      uint             `json:"id"`
+	Tags    []string         `json:"tags,omitempty"`
+	Labels  map[string]int   `json:"labels"`
+	Blob    []byte           `json:"blob"`
+	Pair    [2]float64       `json:"pair"`
+	When    time.Time        `json:"when"`
+	Raw     json.RawMessage  `json:"raw"`
+	Tree    *testOpenRPCNode `json:"tree"`
+	Any     interface{}      `json:"any"`
+	Ignored string           `json:"-"`
+	private int
+}
+
+type testOpenRPCEmbedded struct {
+	Flag bool
+}
+
+func TestOpenRPC(t *testing.T) {
+	d := testTypedDispatcher(t)
+	if err := d.RegisterFunc("types", func(ctx context.Context, p *testOpenRPCParams) (*testOpenRPCNode, *Error) {
+		return nil, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	d.Register("untyped", func(ctx context.Context, params interface{}) (interface{}, *Error) {
+		return nil, nil
+	})
+	d.Describe("add", MethodInfo{
+		Summary: "Adds two numbers.",
+		Errors:  []*Error{MakeError(1, "Note given", nil)},
+	})
+	d.RegisterDiscover(OpenRPCInfo{Title: "test", Version: "1.0.0"})
+
+	resp := d.Dispatch(context.Background(), `{"jsonrpc":"2.0","method":"rpc.discover","id":1}`)
+	if resp == nil || !resp.IsResult() {
+		t.Fatalf("expected a result, got %v", resp)
+	}
+	got, err := json.Marshal(resp.Result())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"openrpc":"1.2.6","info":{"title":"test","version":"1.0.0"},"methods":[` +
+		`{"name":"add","summary":"Adds two numbers.","params":[` +
+		`{"name":"a","required":true,"schema":{"type":"integer"}},` +
+		`{"name":"b","required":true,"schema":{"type":"integer"}},` +
+		`{"name":"note","schema":{"type":"string"}}],` +
+		`"result":{"name":"result","schema":{"type":"integer"}},` +
+		`"errors":[{"code":1,"message":"Note given"}],"paramStructure":"either"},` +
+		`{"name":"ping","params":[],"result":{"name":"result","schema":{"type":"string"}}},` +
+		`{"name":"types","params":[` +
+		`{"name":"Flag","required":true,"schema":{"type":"boolean"}},` +
+		`{"name":"id","required":true,"schema":{"minimum":0,"type":"integer"}},` +
+		`{"name":"tags","schema":{"items":{"type":"string"},"type":"array"}},` +
+		`{"name":"labels","required":true,"schema":{"additionalProperties":{"type":"integer"},"type":"object"}},` +
+		`{"name":"blob","required":true,"schema":{"contentEncoding":"base64","type":"string"}},` +
+		`{"name":"pair","required":true,"schema":{"items":{"type":"number"},"maxItems":2,"minItems":2,"type":"array"}},` +
+		`{"name":"when","required":true,"schema":{"format":"date-time","type":"string"}},` +
+		`{"name":"raw","required":true,"schema":{}},` +
+		`{"name":"tree","schema":{"properties":{"children":{"items":{},"type":"array"},"value":{"type":"string"}},"required":["value"],"type":"object"}},` +
+		`{"name":"any","required":true,"schema":{}}],` +
+		`"result":{"name":"result","schema":{"properties":{"children":{"items":{},"type":"array"},"value":{"type":"string"}},"required":["value"],"type":"object"}},` +
+		`"paramStructure":"either"},` +
+		`{"name":"untyped","params":[],"result":{"name":"result","schema":{}}}]}`
+	if string(got) != expected {
+		t.Errorf("expected %s\ngot %s", expected, got)
+	}
+}
+
+// The generated schemas must be accepted by CompileSchema and match values of
+// the types they were generated from.
+func TestOpenRPCSchemasValidate(t *testing.T) {
+	d := testTypedDispatcher(t)
+	doc := d.OpenRPC(OpenRPCInfo{})
+
+	method := doc.Methods[0]
+	params := map[string]interface{}{"a": 1, "b": 2}
+	for _, param := range method.Params {
+		raw, _ := json.Marshal(param.Schema)
+		s, err := CompileSchema(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v, ok := params[param.Name]; ok {
+			if violations := s.Validate(v); violations != nil {
+				t.Errorf("%s: %v", param.Name, violations)
+			}
+		}
+	}
+}
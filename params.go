@@ -0,0 +1,63 @@
+package gojsonrpc
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// normalizeParams is the single check used by every constructor and by the
+// parser to decide whether a value is acceptable as params: it must marshal to
+// a JSON array or object. Values that marshal to null (nil, nil pointers, nil
+// slices and maps) are treated as absent, so the returned params are nil and
+// the field is left out when marshalling. ok is false for anything else,
+// including values that can't be marshalled at all.
+//
+// The common types produced by encoding/json are handled directly. Anything
+// else is marshalled, as that is the only way to be sure what a type's JSON
+// will look like (json.Marshaler, named types, []byte, time.Time...).
+func normalizeParams(params interface{}) (normalized interface{}, ok bool) {
+	switch p := params.(type) {
+	case nil:
+		return nil, true
+	case []interface{}:
+		if p == nil {
+			return nil, true
+		}
+		return params, true
+	case map[string]interface{}:
+		if p == nil {
+			return nil, true
+		}
+		return params, true
+	case string, bool, float64, json.Number:
+		return nil, false
+	case json.RawMessage:
+		if len(p) == 0 {
+			return nil, true
+		}
+		return classifyParamsJSON(p, params)
+	}
+
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return nil, false
+	}
+
+	return classifyParamsJSON(raw, params)
+}
+
+func classifyParamsJSON(raw []byte, params interface{}) (interface{}, bool) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 {
+		return nil, false
+	}
+
+	switch raw[0] {
+	case '[', '{':
+		return params, true
+	case 'n':
+		return nil, bytes.Equal(raw, []byte("null"))
+	}
+
+	return nil, false
+}
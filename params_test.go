@@ -0,0 +1,168 @@
+package gojsonrpc
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+type testNamedSlice []int
+
+type testNamedMap map[string]int
+
+type testStructParams struct {
+	Field1 string `json:"key1"`
+}
+
+type testArrayMarshaler struct{}
+
+func (testArrayMarshaler) MarshalJSON() ([]byte, error) {
+	return []byte(`[1, 2]`), nil
+}
+
+type testStringMarshaler struct{}
+
+func (testStringMarshaler) MarshalJSON() ([]byte, error) {
+	return []byte(`"str"`), nil
+}
+
+type testPtrMarshaler struct{}
+
+func (*testPtrMarshaler) MarshalJSON() ([]byte, error) {
+	return []byte(`{}`), nil
+}
+
+type testFailingMarshaler struct{}
+
+func (testFailingMarshaler) MarshalJSON() ([]byte, error) {
+	return nil, errors.New("test")
+}
+
+var (
+	testNilStructPtr *testStructParams
+	testNilSlice     []interface{}
+	testNilMap       map[string]interface{}
+	testArray        = [2]int{1, 2}
+	testSlice        = []int{1, 2}
+)
+
+// testParamsCorpus lists values along with whether they are valid params and,
+// if so, whether they should be treated as absent.
+var testParamsCorpus = []struct {
+	name   string
+	params interface{}
+	valid  bool
+	absent bool
+}{
+	{"nil", nil, true, true},
+	{"[]interface{}", []interface{}{1, "a"}, true, false},
+	{"empty []interface{}", []interface{}{}, true, false},
+	{"nil []interface{}", testNilSlice, true, true},
+	{"map[string]interface{}", map[string]interface{}{"a": 1}, true, false},
+	{"nil map[string]interface{}", testNilMap, true, true},
+	{"[]int", []int{1}, true, false},
+	{"[]string", []string{"a"}, true, false},
+	{"array", [2]int{1, 2}, true, false},
+	{"pointer to array", &testArray, true, false},
+	{"pointer to slice", &testSlice, true, false},
+	{"map[string]int", map[string]int{"a": 1}, true, false},
+	{"map[int]string", map[int]string{1: "a"}, true, false},
+	{"named slice", testNamedSlice{1}, true, false},
+	{"nil named slice", testNamedSlice(nil), true, true},
+	{"named map", testNamedMap{"a": 1}, true, false},
+	{"struct", testStructParams{"a"}, true, false},
+	{"pointer to struct", &testStructParams{"a"}, true, false},
+	{"nil pointer to struct", testNilStructPtr, true, true},
+	{"json.RawMessage array", json.RawMessage(`[1]`), true, false},
+	{"json.RawMessage object", json.RawMessage(` {"a":1}`), true, false},
+	{"json.RawMessage null", json.RawMessage(`null`), true, true},
+	{"empty json.RawMessage", json.RawMessage(nil), true, true},
+	{"json.RawMessage string", json.RawMessage(`"a"`), false, false},
+	{"json.RawMessage number", json.RawMessage(`1`), false, false},
+	{"json.Marshaler to array", testArrayMarshaler{}, true, false},
+	{"json.Marshaler to string", testStringMarshaler{}, false, false},
+	{"pointer json.Marshaler", &testPtrMarshaler{}, true, false},
+	{"failing json.Marshaler", testFailingMarshaler{}, false, false},
+	{"string", "a", false, false},
+	{"pointer to string", new(string), false, false},
+	{"int", 1, false, false},
+	{"float64", 1.5, false, false},
+	{"bool", true, false, false},
+	{"json.Number", json.Number("1"), false, false},
+	{"[]byte", []byte("a"), false, false},
+	{"time.Time", time.Time{}, false, false},
+	{"channel", make(chan int), false, false},
+	{"func", func() {}, false, false},
+}
+
+func TestNormalizeParams(t *testing.T) {
+	for _, test := range testParamsCorpus {
+		normalized, ok := normalizeParams(test.params)
+		if ok != test.valid {
+			t.Errorf("%s: expected valid %v got %v", test.name, test.valid, ok)
+			continue
+		}
+		if ok && (normalized == nil) != test.absent {
+			t.Errorf("%s: expected absent %v got %v", test.name, test.absent, normalized == nil)
+		}
+	}
+}
+
+func TestMakeRequestAndNotificationAgreeOnParams(t *testing.T) {
+	for _, test := range testParamsCorpus {
+		_, reqErr := MakeRequest(testRequestMethod, test.params, testRequestId)
+		_, notifErr := MakeNotification(testNotificationMethod, test.params)
+		if test.valid && (reqErr != nil || notifErr != nil) {
+			t.Errorf("%s: unexpected errors %v, %v", test.name, reqErr, notifErr)
+		} else if !test.valid && (reqErr != InvalidRequestInvalidParamsType || notifErr != InvalidNotificationInvalidParamsType) {
+			t.Errorf("%s: expected params type errors got %v, %v", test.name, reqErr, notifErr)
+		}
+	}
+}
+
+func TestMadeRequestsParseBack(t *testing.T) {
+	for _, test := range testParamsCorpus {
+		if !test.valid {
+			continue
+		}
+
+		r, err := MakeRequest(testRequestMethod, test.params, testRequestId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		jsonReq, err := json.Marshal(r)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		msg, err := ParseIncoming(string(jsonReq))
+		if err != nil {
+			t.Errorf("%s: %s did not parse: %v", test.name, jsonReq, err)
+		} else if (msg.(*Request).Params() == nil) != test.absent {
+			t.Errorf("%s: expected absent %v in %s", test.name, test.absent, jsonReq)
+		}
+	}
+}
+
+func TestParseIncomingParamsTypes(t *testing.T) {
+	tests := map[string]bool{
+		`[]`:     true,
+		`{}`:     true,
+		`null`:   true,
+		`"str"`:  false,
+		`1`:      false,
+		`true`:   false,
+		`[null]`: true,
+	}
+
+	for params, valid := range tests {
+		rawMsg := `{"jsonrpc":"2.0", "method":"test", "params":` + params + `, "id":1}`
+		_, err := ParseIncoming(rawMsg)
+		if valid && err != nil {
+			t.Errorf("%s: unexpected error %v", params, err)
+		} else if !valid && err != InvalidMessage {
+			t.Errorf("%s: expected %v got %v", params, InvalidMessage, err)
+		}
+	}
+}
@@ -4,9 +4,9 @@ package gojsonrpc
 
 import "fmt"
 
-const _ParseError_name = "InvalidVersionInvalidMessage"
+const _ParseError_name = "InvalidVersionInvalidMessageDuplicateKeyInvalidUTF8LoneSurrogateMessageTooLargeNestingTooDeepTooManyElementsStringTooLongBatchTooLong"
 
-var _ParseError_index = [...]uint8{0, 14, 28}
+var _ParseError_index = [...]uint8{0, 14, 28, 40, 51, 64, 79, 93, 108, 121, 133}
 
 func (i ParseError) String() string {
 	if i < 0 || i >= ParseError(len(_ParseError_index)-1) {
@@ -0,0 +1,80 @@
+package gojsonrpc
+
+import (
+	"context"
+	"sync"
+)
+
+// Peer is the other end of the connection a message was received on, as seen
+// by its handler. It lets handlers send messages of their own, such as
+// notifications, to the client. Server, SSEHandler and PipeEnd.Serve provide
+// it through PeerFromContext.
+type Peer interface {
+	// Send sends msg to the peer.
+	Send(msg Message) error
+	// Close closes the connection.
+	Close() error
+	// Done is closed once the connection is closed.
+	Done() <-chan struct{}
+}
+
+type peerContextKey struct{}
+
+// ContextWithPeer returns a copy of ctx carrying peer, for a transport to pass
+// to handlers.
+func ContextWithPeer(ctx context.Context, peer Peer) context.Context {
+	return context.WithValue(ctx, peerContextKey{}, peer)
+}
+
+// PeerFromContext returns the peer stored by ContextWithPeer.
+func PeerFromContext(ctx context.Context) (Peer, bool) {
+	peer, ok := ctx.Value(peerContextKey{}).(Peer)
+	return peer, ok
+}
+
+// replyHooks holds functions to run once the reply to a message has been
+// sent, e.g. to make sure that a client gets the response to a subscribe
+// request before the first notification.
+type replyHooks struct {
+	mu   sync.Mutex
+	fns  []func()
+	done bool
+}
+
+type replyHooksContextKey struct{}
+
+// withReplyHooks returns a copy of ctx to which handlers can add functions
+// with afterReply. The transport must call run once it has sent the reply, or
+// found there was none.
+func withReplyHooks(ctx context.Context) (context.Context, *replyHooks) {
+	hooks := new(replyHooks)
+	return context.WithValue(ctx, replyHooksContextKey{}, hooks), hooks
+}
+
+// afterReply arranges for fn to run once the reply to the message being
+// handled with ctx has been sent. If the transport doesn't support it, or the
+// reply has already been sent, fn is run at once.
+func afterReply(ctx context.Context, fn func()) {
+	hooks, ok := ctx.Value(replyHooksContextKey{}).(*replyHooks)
+	if ok {
+		hooks.mu.Lock()
+		if !hooks.done {
+			hooks.fns = append(hooks.fns, fn)
+			hooks.mu.Unlock()
+			return
+		}
+		hooks.mu.Unlock()
+	}
+	fn()
+}
+
+func (h *replyHooks) run() {
+	h.mu.Lock()
+	fns := h.fns
+	h.fns, h.done = nil, true
+	h.mu.Unlock()
+
+	for _, fn := range fns {
+		fn()
+	}
+}
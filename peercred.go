@@ -0,0 +1,16 @@
+package gojsonrpc
+
+import "errors"
+
+// ErrPeerCredentialsUnsupported is returned by ReadPeerCredentials for
+// connections that aren't Unix domain sockets, or on systems where peer
+// credentials aren't available.
+var ErrPeerCredentialsUnsupported = errors.New("gojsonrpc: peer credentials not supported")
+
+// PeerCredentials identifies the process at the other end of a Unix domain
+// socket, as it was when the connection was made.
+type PeerCredentials struct {
+	PID int
+	UID int
+	GID int
+}
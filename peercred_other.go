@@ -0,0 +1,11 @@
+//go:build !linux
+
+package gojsonrpc
+
+import "net"
+
+// ReadPeerCredentials returns the credentials of the peer of conn. It is only
+// supported on Linux, and returns ErrPeerCredentialsUnsupported elsewhere.
+func ReadPeerCredentials(conn net.Conn) (*PeerCredentials, error) {
+	return nil, ErrPeerCredentialsUnsupported
+}
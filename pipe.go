@@ -0,0 +1,344 @@
+package gojsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// PipeDelivery tells a pipe what to do with a message being sent.
+type PipeDelivery struct {
+	// Drop discards the message.
+	Drop bool
+	// Hold keeps the message back until ReleaseHeld is called on the end it
+	// was sent from.
+	Hold bool
+	// Delay delivers the message after a delay, letting later messages
+	// overtake it.
+	Delay time.Duration
+}
+
+// PipeEnd is one end of an in-memory connection made by NewPipe. Messages sent
+// from one end are received, in order, by the other. The zero value is not
+// usable.
+//
+// A PipeEnd can be used as the Transport of a Client, and can serve a
+// Dispatcher, so that clients and servers can be tested without a network.
+// Its fields must be set before it is used.
+type PipeEnd struct {
+	// Serialize makes the messages sent from this end go through JSON: each is
+	// encoded and parsed again using Parser, so that the receiver never shares
+	// values with the sender and sees exactly what a real transport would carry.
+	// Without it, the receiver gets the very Message that was sent.
+	Serialize bool
+	// Parser parses the messages given to RoundTrip and, with Serialize, the
+	// messages sent.
+	Parser Parser
+	// Intercept, if set, is called for each message sent from this end, to
+	// inject faults.
+	Intercept func(msg Message) PipeDelivery
+	// OnNotification, if set, is called with the notifications received
+	// while RoundTrip waits for responses, in order.
+	OnNotification func(notif *Notification)
+
+	peer  *PipeEnd
+	inbox *pipeQueue
+
+	mu   sync.Mutex
+	held []Message
+
+	// reading is held by the RoundTrip call that is reading responses for all
+	// of them.
+	reading chan struct{}
+	waitMu  sync.Mutex
+	waiting map[uint]chan *Response
+}
+
+// pipeQueue holds the messages delivered to an end, until they are received.
+type pipeQueue struct {
+	mu     sync.Mutex
+	msgs   []Message
+	closed bool
+	ready  chan struct{}
+}
+
+// NewPipe returns the two ends of an in-memory connection.
+func NewPipe() (*PipeEnd, *PipeEnd) {
+	a, b := newPipeEnd(), newPipeEnd()
+	a.peer, b.peer = b, a
+	return a, b
+}
+
+func newPipeEnd() *PipeEnd {
+	return &PipeEnd{
+		inbox:   &pipeQueue{ready: make(chan struct{}, 1)},
+		reading: make(chan struct{}, 1),
+		waiting: make(map[uint]chan *Response),
+	}
+}
+
+func (q *pipeQueue) push(msg Message) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return
+	}
+	q.msgs = append(q.msgs, msg)
+	q.signal()
+}
+
+func (q *pipeQueue) signal() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (q *pipeQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.closed = true
+	q.signal()
+}
+
+// Send sends msg to the other end. It returns io.ErrClosedPipe if either end
+// is closed.
+func (e *PipeEnd) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if e.isClosed() || e.peer.isClosed() {
+		return io.ErrClosedPipe
+	}
+
+	if e.Serialize {
+		raw, err := json.Marshal(msg)
+		if err != nil {
+			return err
+		}
+		if msg, err = e.Parser.ParseIncoming(string(raw)); err != nil {
+			return err
+		}
+	}
+
+	var delivery PipeDelivery
+	if e.Intercept != nil {
+		delivery = e.Intercept(msg)
+	}
+
+	switch {
+	case delivery.Drop:
+	case delivery.Hold:
+		e.mu.Lock()
+		e.held = append(e.held, msg)
+		e.mu.Unlock()
+	case delivery.Delay > 0:
+		time.AfterFunc(delivery.Delay, func() { e.peer.inbox.push(msg) })
+	default:
+		e.peer.inbox.push(msg)
+	}
+	return nil
+}
+
+// ReleaseHeld delivers the messages held back by Intercept, in the order they
+// were sent, and returns how many there were.
+func (e *PipeEnd) ReleaseHeld() int {
+	e.mu.Lock()
+	held := e.held
+	e.held = nil
+	e.mu.Unlock()
+
+	for _, msg := range held {
+		e.peer.inbox.push(msg)
+	}
+	return len(held)
+}
+
+// Receive returns the next message sent by the other end, waiting for one if
+// needed. Once the other end is closed and every message sent before has been
+// received, it returns io.EOF. It returns io.ErrClosedPipe if this end is
+// closed.
+func (e *PipeEnd) Receive(ctx context.Context) (Message, error) {
+	for {
+		q := e.inbox
+		if e.isClosed() {
+			// Wake other receivers up too.
+			q.signal()
+			return nil, io.ErrClosedPipe
+		}
+
+		q.mu.Lock()
+		if len(q.msgs) != 0 {
+			msg := q.msgs[0]
+			q.msgs[0] = nil
+			q.msgs = q.msgs[1:]
+			if len(q.msgs) != 0 {
+				// Let other receivers in.
+				q.signal()
+			}
+			q.mu.Unlock()
+			return msg, nil
+		}
+		peerClosed := e.peer.isClosed()
+		q.mu.Unlock()
+		if peerClosed {
+			q.signal()
+			return nil, io.EOF
+		}
+
+		select {
+		case <-q.ready:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (e *PipeEnd) isClosed() bool {
+	e.inbox.mu.Lock()
+	defer e.inbox.mu.Unlock()
+
+	return e.inbox.closed
+}
+
+// Close closes this end. Messages that haven't been received yet are dropped,
+// and the other end's Receive returns io.EOF once it has received everything
+// sent before.
+func (e *PipeEnd) Close() error {
+	e.inbox.close()
+	e.peer.inbox.signal()
+	return nil
+}
+
+// RoundTrip implements RoundTripper, so that a PipeEnd can be the Transport of
+// a Client. It sends message and, for a Request, waits for the Response with
+// the same ID, returning it encoded. Concurrent calls share the end: whichever
+// is reading passes the other calls their responses. Notifications go to
+// OnNotification, and requests are discarded. Batches aren't supported.
+func (e *PipeEnd) RoundTrip(ctx context.Context, message []byte) ([]byte, error) {
+	msg, err := e.Parser.ParseIncoming(string(message))
+	if err != nil {
+		return nil, err
+	}
+	req, ok := msg.(*Request)
+	if !ok {
+		return nil, e.Send(ctx, msg)
+	}
+
+	id := req.ID()
+	wait := make(chan *Response, 1)
+	e.waitMu.Lock()
+	e.waiting[id] = wait
+	e.waitMu.Unlock()
+	defer func() {
+		e.waitMu.Lock()
+		delete(e.waiting, id)
+		e.waitMu.Unlock()
+	}()
+
+	if err = e.Send(ctx, msg); err != nil {
+		return nil, err
+	}
+
+	for {
+		select {
+		case resp := <-wait:
+			return json.Marshal(resp)
+		case e.reading <- struct{}{}:
+			resp, err := e.receiveResponse(ctx, id)
+			<-e.reading
+			if err != nil {
+				return nil, err
+			}
+			if resp != nil {
+				return json.Marshal(resp)
+			}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// receiveResponse receives one message, returning it if it is the response to
+// request id or has a null ID, and passing it to the RoundTrip waiting for it
+// otherwise.
+func (e *PipeEnd) receiveResponse(ctx context.Context, id uint) (*Response, error) {
+	msg, err := e.Receive(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if notif, ok := msg.(*Notification); ok && e.OnNotification != nil {
+		e.OnNotification(notif)
+	}
+	resp, ok := msg.(*Response)
+	if !ok {
+		return nil, nil
+	}
+	if resp.HasNullID() || resp.ID() == id {
+		return resp, nil
+	}
+
+	e.waitMu.Lock()
+	wait, ok := e.waiting[resp.ID()]
+	e.waitMu.Unlock()
+	if ok {
+		select {
+		case wait <- resp:
+		default:
+		}
+	}
+	return nil, nil
+}
+
+// Serve answers the messages received on e using d, one at a time and in the
+// order they arrive, until the other end is closed or ctx ends. It returns nil
+// once the other end is closed. Handlers can send messages of their own to the
+// other end with PeerFromContext.
+func (e *PipeEnd) Serve(ctx context.Context, d *Dispatcher) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	ctx = ContextWithPeer(ctx, pipePeer{e, ctx})
+
+	for {
+		msg, err := e.Receive(ctx)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		msgCtx, hooks := withReplyHooks(ctx)
+		if resp := d.DispatchMessage(msgCtx, msg); resp != nil {
+			if err = e.Send(ctx, resp); err == io.ErrClosedPipe {
+				return nil
+			} else if err != nil {
+				return err
+			}
+		}
+		hooks.run()
+	}
+}
+
+// pipePeer is the Peer of the messages handled by PipeEnd.Serve. It is done
+// once Serve returns.
+type pipePeer struct {
+	end *PipeEnd
+	ctx context.Context
+}
+
+func (p pipePeer) Send(msg Message) error {
+	return p.end.Send(context.Background(), msg)
+}
+
+func (p pipePeer) Close() error {
+	return p.end.Close()
+}
+
+func (p pipePeer) Done() <-chan struct{} {
+	return p.ctx.Done()
+}
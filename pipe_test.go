@@ -0,0 +1,180 @@
+package gojsonrpc
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestPipe(t *testing.T) {
+	ctx := context.Background()
+	for _, serialize := range []bool{false, true} {
+		a, b := NewPipe()
+		a.Serialize = serialize
+
+		sent := make([]Message, 3)
+		for i := range sent {
+			sent[i], _ = MakeRequest("test", []interface{}{i}, uint(i))
+			if err := a.Send(ctx, sent[i]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for i := range sent {
+			msg, err := b.Receive(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req, ok := msg.(*Request)
+			if !ok || req.ID() != uint(i) {
+				t.Fatalf("expected request %d got %v", i, msg)
+			}
+			if (msg == sent[i]) == serialize {
+				t.Errorf("serialize %v: unexpected sharing of messages", serialize)
+			}
+		}
+	}
+}
+
+func TestPipeClose(t *testing.T) {
+	ctx := context.Background()
+	a, b := NewPipe()
+	notif, _ := MakeNotification("test", nil)
+	a.Send(ctx, notif)
+	a.Close()
+
+	if err := a.Send(ctx, notif); err != io.ErrClosedPipe {
+		t.Errorf("expected ErrClosedPipe got %v", err)
+	}
+	if err := b.Send(ctx, notif); err != io.ErrClosedPipe {
+		t.Errorf("expected ErrClosedPipe got %v", err)
+	}
+	if msg, err := b.Receive(ctx); err != nil || msg != Message(notif) {
+		t.Errorf("expected the notification got %v %v", msg, err)
+	}
+	if _, err := b.Receive(ctx); err != io.EOF {
+		t.Errorf("expected EOF got %v", err)
+	}
+	if _, err := a.Receive(ctx); err != io.ErrClosedPipe {
+		t.Errorf("expected ErrClosedPipe got %v", err)
+	}
+}
+
+func TestPipeReceiveWaits(t *testing.T) {
+	a, b := NewPipe()
+	notif, _ := MakeNotification("test", nil)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		a.Send(context.Background(), notif)
+	}()
+	if msg, err := b.Receive(context.Background()); err != nil || msg != Message(notif) {
+		t.Errorf("expected the notification got %v %v", msg, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := b.Receive(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected DeadlineExceeded got %v", err)
+	}
+}
+
+// testPipeClient serves testDispatcher on a pipe, returning a Client for it
+// and the server's end.
+func testPipeClient(t *testing.T) (*Client, *PipeEnd) {
+	client, server := NewPipe()
+	client.Serialize, server.Serialize = true, true
+	go server.Serve(context.Background(), testDispatcher())
+	t.Cleanup(func() { client.Close() })
+	return &Client{Transport: client}, server
+}
+
+func TestPipeClient(t *testing.T) {
+	c, _ := testPipeClient(t)
+	ctx := context.Background()
+
+	var result []int
+	if err := c.Call(ctx, "echo", []int{1, 2}, &result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 2 || result[0] != 1 || result[1] != 2 {
+		t.Errorf("expected [1 2] got %v", result)
+	}
+	if err := c.Call(ctx, "fail", nil, nil); err == nil || AsError(err).Code() != 1 {
+		t.Errorf("expected error 1 got %v", err)
+	}
+	if err := c.Notify(ctx, "echo", nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPipeDrop(t *testing.T) {
+	c, server := testPipeClient(t)
+	server.Intercept = func(msg Message) PipeDelivery {
+		return PipeDelivery{Drop: true}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := c.Call(ctx, "echo", nil, nil); err != context.DeadlineExceeded {
+		t.Errorf("expected DeadlineExceeded got %v", err)
+	}
+}
+
+func TestPipeReorder(t *testing.T) {
+	c, server := testPipeClient(t)
+	held := make(chan struct{}, 1)
+	server.Intercept = func(msg Message) PipeDelivery {
+		if msg.(*Response).ID() == 1 {
+			held <- struct{}{}
+			return PipeDelivery{Hold: true}
+		}
+		return PipeDelivery{}
+	}
+
+	ctx := context.Background()
+	first := make(chan error, 1)
+	go func() { first <- c.Call(ctx, "echo", []int{1}, nil) }()
+	<-held
+
+	if err := c.Call(ctx, "echo", []int{2}, nil); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-first:
+		t.Fatalf("the first call returned before its response was released: %v", err)
+	default:
+	}
+
+	if n := server.ReleaseHeld(); n != 1 {
+		t.Errorf("expected 1 held message got %d", n)
+	}
+	if err := <-first; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPipeDelay(t *testing.T) {
+	ctx := context.Background()
+	a, b := NewPipe()
+	a.Intercept = func(msg Message) PipeDelivery {
+		if msg.(*Notification).Method() == "slow" {
+			return PipeDelivery{Delay: 20 * time.Millisecond}
+		}
+		return PipeDelivery{}
+	}
+
+	slow, _ := MakeNotification("slow", nil)
+	fast, _ := MakeNotification("fast", nil)
+	a.Send(ctx, slow)
+	a.Send(ctx, fast)
+
+	for _, expected := range []string{"fast", "slow"} {
+		msg, err := b.Receive(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if method := msg.(*Notification).Method(); method != expected {
+			t.Errorf("expected %s got %s", expected, method)
+		}
+	}
+}
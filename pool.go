@@ -0,0 +1,193 @@
+package gojsonrpc
+
+import "sync"
+
+// Parsing with ParseIncomingPooled or ParseInto reuses messages rather than
+// allocating new ones for every call. Messages are taken from a pool with the
+// Acquire functions and must be handed back with the matching Release function
+// once they are no longer needed. A released message, and anything that was
+// read from it, must not be used again: the message is cleared and may be
+// returned by a later Acquire or parse at any time.
+
+var (
+	requestPool      = sync.Pool{New: func() interface{} { return new(Request) }}
+	notificationPool = sync.Pool{New: func() interface{} { return new(Notification) }}
+	responsePool     = sync.Pool{New: func() interface{} { return new(Response) }}
+)
+
+// AcquireRequest returns an empty Request from the pool.
+func AcquireRequest() *Request {
+	return requestPool.Get().(*Request)
+}
+
+// ReleaseRequest resets r and returns it to the pool.
+func ReleaseRequest(r *Request) {
+	r.Reset()
+	requestPool.Put(r)
+}
+
+// AcquireNotification returns an empty Notification from the pool.
+func AcquireNotification() *Notification {
+	return notificationPool.Get().(*Notification)
+}
+
+// ReleaseNotification resets n and returns it to the pool.
+func ReleaseNotification(n *Notification) {
+	n.Reset()
+	notificationPool.Put(n)
+}
+
+// AcquireResponse returns an empty Response from the pool.
+func AcquireResponse() *Response {
+	return responsePool.Get().(*Response)
+}
+
+// ReleaseResponse resets r and returns it to the pool.
+func ReleaseResponse(r *Response) {
+	r.Reset()
+	responsePool.Put(r)
+}
+
+// ReleaseMessage returns msg to the pool for its type. Any other Message is
+// ignored.
+func ReleaseMessage(msg Message) {
+	switch m := msg.(type) {
+	case *Request:
+		ReleaseRequest(m)
+	case *Notification:
+		ReleaseNotification(m)
+	case *Response:
+		ReleaseResponse(m)
+	}
+}
+
+// ParseIncomingPooled is like ParseIncoming, but the message it returns comes
+// from the pool and should be released with ReleaseMessage.
+func (p *Parser) ParseIncomingPooled(data []byte) (Message, error) {
+	alloc := new(poolAllocator)
+	msg, err := p.parse(data, alloc)
+	if err != nil {
+		alloc.release()
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+// ParseInto parses data into msg, which must be a *Request, *Notification or
+// *Response. msg is reset first. If data holds a different kind of message,
+// ParseInto returns InvalidMessage and msg is left empty.
+func (p *Parser) ParseInto(msg Message, data []byte) error {
+	if !resetMessage(msg) {
+		return InvalidMessage
+	}
+
+	alloc := &intoAllocator{msg: msg}
+	parsed, err := p.parse(data, alloc)
+	if err == nil && parsed != msg {
+		err = InvalidMessage
+	}
+	if err != nil {
+		if alloc.other != nil {
+			ReleaseMessage(alloc.other)
+		}
+		// msg may have been partly filled before the error.
+		resetMessage(msg)
+		return err
+	}
+
+	return nil
+}
+
+// resetMessage resets msg, reporting whether it is one of the message types.
+func resetMessage(msg Message) bool {
+	switch m := msg.(type) {
+	case *Request:
+		m.Reset()
+	case *Notification:
+		m.Reset()
+	case *Response:
+		m.Reset()
+	default:
+		return false
+	}
+
+	return true
+}
+
+// allocator provides the values the parser fills in.
+type allocator interface {
+	request() *Request
+	notification() *Notification
+	response() *Response
+}
+
+type heapAllocator struct{}
+
+func (heapAllocator) request() *Request           { return new(Request) }
+func (heapAllocator) notification() *Notification { return new(Notification) }
+func (heapAllocator) response() *Response         { return new(Response) }
+
+// poolAllocator takes values from the pool, remembering the last one so that
+// it can be released if parsing fails.
+type poolAllocator struct {
+	msg Message
+}
+
+func (a *poolAllocator) request() *Request {
+	r := AcquireRequest()
+	a.msg = r
+	return r
+}
+
+func (a *poolAllocator) notification() *Notification {
+	n := AcquireNotification()
+	a.msg = n
+	return n
+}
+
+func (a *poolAllocator) response() *Response {
+	r := AcquireResponse()
+	a.msg = r
+	return r
+}
+
+func (a *poolAllocator) release() {
+	if a.msg != nil {
+		ReleaseMessage(a.msg)
+	}
+}
+
+// intoAllocator hands out msg when the parser asks for a value of its type,
+// and a pooled value otherwise.
+type intoAllocator struct {
+	msg   Message
+	other Message
+}
+
+func (a *intoAllocator) request() *Request {
+	if r, ok := a.msg.(*Request); ok {
+		return r
+	}
+	r := AcquireRequest()
+	a.other = r
+	return r
+}
+
+func (a *intoAllocator) notification() *Notification {
+	if n, ok := a.msg.(*Notification); ok {
+		return n
+	}
+	n := AcquireNotification()
+	a.other = n
+	return n
+}
+
+func (a *intoAllocator) response() *Response {
+	if r, ok := a.msg.(*Response); ok {
+		return r
+	}
+	r := AcquireResponse()
+	a.other = r
+	return r
+}
@@ -0,0 +1,168 @@
+package gojsonrpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestReset(t *testing.T) {
+	req, _ := MakeRequest(testRequestMethod, []interface{}{1}, testRequestId)
+	req.Reset()
+	if *req != (Request{}) {
+		t.Errorf("request not reset: %#v", req)
+	}
+
+	notif, _ := MakeNotification(testNotificationMethod, []interface{}{1})
+	notif.Reset()
+	if *notif != (Notification{}) {
+		t.Errorf("notification not reset: %#v", notif)
+	}
+
+	resp, _ := MakeResponseWithError(MakeError(1, "failed", nil), 1)
+	resp.Reset()
+	if *resp != (Response{}) {
+		t.Errorf("response not reset: %#v", resp)
+	}
+
+	e := MakeError(1, "failed", "data")
+	e.Reset()
+	if *e != (Error{}) {
+		t.Errorf("error not reset: %#v", e)
+	}
+}
+
+func TestParseIncomingPooled(t *testing.T) {
+	p := new(Parser)
+	for _, raw := range testCodecMessages {
+		expected, err := p.ParseIncoming(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Parse twice so that the second parse may reuse the first message.
+		for i := 0; i < 2; i++ {
+			msg, err := p.ParseIncomingPooled([]byte(raw))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			expectedJSON, _ := json.Marshal(expected)
+			got, _ := json.Marshal(msg)
+			if string(expectedJSON) != string(got) {
+				t.Errorf("expected %.80s got %.80s", expectedJSON, got)
+			}
+			ReleaseMessage(msg)
+		}
+	}
+
+	if _, err := p.ParseIncomingPooled([]byte(`{"jsonrpc":"2.0","method":"test","params":1,"id":1}`)); err != InvalidMessage {
+		t.Errorf("expected %v got %v", InvalidMessage, err)
+	}
+}
+
+func TestParseInto(t *testing.T) {
+	req := new(Request)
+	if err := new(Parser).ParseInto(req, []byte(`{"jsonrpc":"2.0","method":"a","params":[1],"id":7}`)); err != nil {
+		t.Fatal(err)
+	}
+	if req.Method() != "a" || req.ID() != 7 || len(req.Params().([]interface{})) != 1 {
+		t.Errorf("unexpected request %#v", req)
+	}
+
+	// Fields missing from the new message must not survive from the old one.
+	if err := new(Parser).ParseInto(req, []byte(`{"jsonrpc":"2.0","method":"b","id":8}`)); err != nil {
+		t.Fatal(err)
+	}
+	if req.Method() != "b" || req.ID() != 8 || req.Params() != nil {
+		t.Errorf("unexpected request %#v", req)
+	}
+
+	if err := new(Parser).ParseInto(req, []byte(`{"jsonrpc":"2.0","method":"c"}`)); err != InvalidMessage {
+		t.Errorf("expected %v got %v", InvalidMessage, err)
+	}
+	if *req != (Request{}) {
+		t.Errorf("request should be reset after an error: %#v", req)
+	}
+
+	resp := new(Response)
+	if err := (&Parser{AllowVersion1: true}).ParseInto(resp, []byte(`{"result":null,"error":{"code":1,"message":"m"},"id":3}`)); err != nil {
+		t.Fatal(err)
+	}
+	if !resp.IsError() || resp.Error().Code() != 1 || resp.ID() != 3 {
+		t.Errorf("unexpected response %#v", resp)
+	}
+
+	if err := new(Parser).ParseInto(nil, []byte(`{"jsonrpc":"2.0","method":"c"}`)); err != InvalidMessage {
+		t.Errorf("expected %v got %v", InvalidMessage, err)
+	}
+}
+
+// Run with -race: every goroutine parses its own values into pooled messages
+// and checks them after other goroutines have released theirs. A message that
+// was still referenced after release would show up as a data race or as
+// another goroutine's values.
+func TestPoolNoAliasing(t *testing.T) {
+	const goroutines, iterations = 8, 500
+
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			p := new(Parser)
+			for i := 0; i < iterations; i++ {
+				method := fmt.Sprintf("m%d.%d", g, i)
+				id := uint(g*iterations + i)
+				raw := fmt.Sprintf(`{"jsonrpc":"2.0","method":%q,"params":{"g":%d},"id":%d}`, method, g, id)
+
+				msg, err := p.ParseIncomingPooled([]byte(raw))
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				req := msg.(*Request)
+				if req.Method() != method || req.ID() != id || req.Params().(map[string]interface{})["g"] != float64(g) {
+					t.Errorf("goroutine %d: unexpected request %#v", g, req)
+				}
+				ReleaseRequest(req)
+
+				resp := AcquireResponse()
+				if resp.Result() != nil || resp.Error() != nil || !resp.HasNullID() {
+					t.Errorf("goroutine %d: acquired a dirty response %#v", g, resp)
+				}
+				if err = p.ParseInto(resp, []byte(fmt.Sprintf(`{"jsonrpc":"2.0","result":%d,"id":%d}`, g, id))); err != nil {
+					t.Error(err)
+				} else if resp.Result() != float64(g) || resp.ID() != id {
+					t.Errorf("goroutine %d: unexpected response %#v", g, resp)
+				}
+				ReleaseResponse(resp)
+			}
+		}(g)
+	}
+	wg.Wait()
+}
+
+func BenchmarkParseIncoming(b *testing.B) {
+	raw := `{"jsonrpc":"2.0","method":"test","params":["a",1,true],"id":1}`
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := ParseIncoming(raw); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParseIncomingPooled(b *testing.B) {
+	raw := []byte(`{"jsonrpc":"2.0","method":"test","params":["a",1,true],"id":1}`)
+	p := new(Parser)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		msg, err := p.ParseIncomingPooled(raw)
+		if err != nil {
+			b.Fatal(err)
+		}
+		ReleaseMessage(msg)
+	}
+}
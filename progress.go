@@ -0,0 +1,198 @@
+package gojsonrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+)
+
+// Progress notifications let a long-running call report on its progress
+// before its response is sent. The client asks for them by putting a progress
+// token in the params of its request, following one of two conventions:
+//
+//   - MCP: params._meta.progressToken, answered with "notifications/progress"
+//     notifications whose params hold progressToken along with the members
+//     of the reported value (e.g. progress, total and message);
+//   - LSP: params.workDoneToken, answered with "$/progress" notifications
+//     whose params are {"token": token, "value": value}.
+//
+// Handlers call ReportProgress, which uses the convention of the request.
+// Tokens are strings or numbers.
+const (
+	MCPProgressMethod = "notifications/progress"
+	LSPProgressMethod = "$/progress"
+)
+
+// Progress errors.
+var (
+	ErrNoProgressToken = errors.New("gojsonrpc: the request has no progress token")
+	ErrProgressParams  = errors.New("gojsonrpc: progress requires params given by name")
+)
+
+// progressToken is the progress token of the request being handled.
+type progressToken struct {
+	token interface{}
+	lsp   bool
+}
+
+type progressContextKey struct{}
+
+// withProgressToken returns a copy of ctx carrying the progress token found in
+// params, if any.
+func withProgressToken(ctx context.Context, params interface{}) context.Context {
+	obj, ok := params.(map[string]interface{})
+	if !ok {
+		return ctx
+	}
+	if meta, ok := obj["_meta"].(map[string]interface{}); ok {
+		if token, ok := meta["progressToken"]; ok && isProgressToken(token) {
+			return context.WithValue(ctx, progressContextKey{}, progressToken{token: token})
+		}
+	}
+	if token, ok := obj["workDoneToken"]; ok && isProgressToken(token) {
+		return context.WithValue(ctx, progressContextKey{}, progressToken{token: token, lsp: true})
+	}
+	return ctx
+}
+
+func isProgressToken(token interface{}) bool {
+	switch token.(type) {
+	case string, float64, json.Number:
+		return true
+	}
+	return false
+}
+
+// ReportProgress sends value to the client as a progress notification for the
+// request being handled with ctx. It returns ErrNoProgressToken if the client
+// didn't ask for progress, which handlers can ignore, and ErrNoPeer if the
+// transport can't send notifications.
+//
+// For MCP clients, value should be an object holding at least progress, e.g.
+// map[string]interface{}{"progress": 50, "total": 100}. Other values are sent
+// as the progress member.
+func ReportProgress(ctx context.Context, value interface{}) error {
+	p, ok := ctx.Value(progressContextKey{}).(progressToken)
+	if !ok {
+		return ErrNoProgressToken
+	}
+	peer, ok := PeerFromContext(ctx)
+	if !ok {
+		return ErrNoPeer
+	}
+
+	var notif *Notification
+	var err error
+	if p.lsp {
+		notif, err = MakeNotification(LSPProgressMethod, map[string]interface{}{"token": p.token, "value": value})
+	} else {
+		params := map[string]interface{}{"progress": value}
+		if obj, err := paramsObject(value); err == nil && value != nil {
+			params = obj
+		}
+		params["progressToken"] = p.token
+		notif, err = MakeNotification(MCPProgressMethod, params)
+	}
+	if err != nil {
+		return err
+	}
+	return peer.Send(notif)
+}
+
+// CallWithProgress is like Call, but asks the server for progress
+// notifications, passing each reported value to onProgress until the call
+// returns. The progress token is added to params as _meta.progressToken, so
+// params must be nil or given by name.
+//
+// The notifications reach the Client through HandleNotification, which must
+// be called by the transport, e.g. from the OnNotification of an SSETransport or
+// a PipeEnd. For MCP notifications, onProgress gets the params without the
+// token; for LSP ones, it gets the value.
+func (c *Client) CallWithProgress(ctx context.Context, method string, params interface{}, result interface{}, onProgress func(value interface{})) error {
+	obj, err := paramsObject(params)
+	if err != nil {
+		return err
+	}
+
+	token := "progress-" + strconv.FormatUint(atomic.AddUint64(&c.lastProgressToken, 1), 10)
+	meta, _ := obj["_meta"].(map[string]interface{})
+	withToken := make(map[string]interface{}, len(meta)+1)
+	for k, v := range meta {
+		withToken[k] = v
+	}
+	withToken["progressToken"] = token
+	obj["_meta"] = withToken
+
+	c.progress.Store(token, onProgress)
+	defer c.progress.Delete(token)
+	return c.Call(ctx, method, obj, result)
+}
+
+// paramsObject returns a copy of params as a JSON object.
+func paramsObject(params interface{}) (map[string]interface{}, error) {
+	obj := make(map[string]interface{})
+	if params == nil {
+		return obj, nil
+	}
+	if m, ok := params.(map[string]interface{}); ok {
+		for k, v := range m {
+			obj[k] = v
+		}
+		return obj, nil
+	}
+
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(bytes.TrimSpace(raw), []byte("{")) {
+		return nil, ErrProgressParams
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err = dec.Decode(&obj); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// HandleNotification passes progress notifications for calls made with
+// CallWithProgress to their callbacks. It reports whether notif was one of
+// them.
+func (c *Client) HandleNotification(notif *Notification) bool {
+	params, ok := notif.Params().(map[string]interface{})
+	if !ok {
+		return false
+	}
+
+	var token, value interface{}
+	switch notif.Method() {
+	case MCPProgressMethod:
+		token = params["progressToken"]
+		rest := make(map[string]interface{}, len(params))
+		for k, v := range params {
+			if k != "progressToken" {
+				rest[k] = v
+			}
+		}
+		value = rest
+	case LSPProgressMethod:
+		token, value = params["token"], params["value"]
+	default:
+		return false
+	}
+	if !isProgressToken(token) {
+		return false
+	}
+
+	fn, ok := c.progress.Load(fmt.Sprint(token))
+	if !ok {
+		return false
+	}
+	fn.(func(interface{}))(value)
+	return true
+}
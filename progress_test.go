@@ -0,0 +1,117 @@
+package gojsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// testProgressDispatcher has a "long" method reporting each of its params as
+// progress before returning "done".
+func testProgressDispatcher() *Dispatcher {
+	d := new(Dispatcher)
+	d.Register("long", func(ctx context.Context, params interface{}) (interface{}, *Error) {
+		for _, v := range params.(map[string]interface{})["steps"].([]interface{}) {
+			if err := ReportProgress(ctx, v); err != nil {
+				return nil, AsError(err)
+			}
+		}
+		return "done", nil
+	})
+	d.Register("quiet", func(ctx context.Context, params interface{}) (interface{}, *Error) {
+		return nil, AsError(ReportProgress(ctx, 1))
+	})
+	return d
+}
+
+func TestCallWithProgress(t *testing.T) {
+	clientEnd, serverEnd := NewPipe()
+	clientEnd.Serialize, serverEnd.Serialize = true, true
+	go serverEnd.Serve(context.Background(), testProgressDispatcher())
+	defer clientEnd.Close()
+
+	c := &Client{Transport: clientEnd}
+	clientEnd.OnNotification = func(n *Notification) { c.HandleNotification(n) }
+
+	var values []interface{}
+	var result string
+	params := map[string]interface{}{"steps": []interface{}{
+		map[string]interface{}{"progress": 1, "total": 2},
+		map[string]interface{}{"progress": 2, "total": 2, "message": "last"},
+		3,
+	}}
+	err := c.CallWithProgress(context.Background(), "long", params, &result, func(v interface{}) {
+		values = append(values, v)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != "done" {
+		t.Errorf("expected done got %s", result)
+	}
+
+	encoded, _ := json.Marshal(values)
+	expected := `[{"progress":1,"total":2},{"message":"last","progress":2,"total":2},{"progress":3}]`
+	if string(encoded) != expected {
+		t.Errorf("expected %s got %s", expected, encoded)
+	}
+	if _, ok := params["_meta"]; ok {
+		t.Error("the caller's params must not be changed")
+	}
+
+	if err = c.CallWithProgress(context.Background(), "long", []int{1}, nil, nil); err != ErrProgressParams {
+		t.Errorf("expected ErrProgressParams got %v", err)
+	}
+	if err = c.Call(context.Background(), "quiet", nil, nil); err == nil || err.(*Error).Data() != ErrNoProgressToken.Error() {
+		t.Errorf("expected ErrNoProgressToken got %v", err)
+	}
+}
+
+func TestReportProgressLSP(t *testing.T) {
+	client, server := NewPipe()
+	client.Serialize = true
+	go server.Serve(context.Background(), testProgressDispatcher())
+	defer client.Close()
+
+	req, _ := MakeRequest("long", map[string]interface{}{"workDoneToken": 7, "steps": []interface{}{"a"}}, 1)
+	client.Send(context.Background(), req)
+
+	notif, ok := testReceive(t, client).(*Notification)
+	if !ok || notif.Method() != LSPProgressMethod {
+		t.Fatalf("expected a progress notification got %v", notif)
+	}
+	if expected := map[string]interface{}{"token": float64(7), "value": "a"}; !reflect.DeepEqual(notif.Params(), expected) {
+		t.Errorf("expected %v got %v", expected, notif.Params())
+	}
+	if resp, ok := testReceive(t, client).(*Response); !ok || resp.Result() != "done" {
+		t.Errorf("expected the response got %v", resp)
+	}
+}
+
+func TestHandleNotification(t *testing.T) {
+	var c Client
+	var got interface{}
+	c.progress.Store("t", func(v interface{}) { got = v })
+
+	tests := []struct {
+		method  string
+		params  interface{}
+		handled bool
+		value   interface{}
+	}{
+		{MCPProgressMethod, map[string]interface{}{"progressToken": "t", "progress": 1.0}, true, map[string]interface{}{"progress": 1.0}},
+		{LSPProgressMethod, map[string]interface{}{"token": "t", "value": "v"}, true, "v"},
+		{LSPProgressMethod, map[string]interface{}{"token": "other", "value": "v"}, false, nil},
+		{LSPProgressMethod, map[string]interface{}{"token": true, "value": "v"}, false, nil},
+		{"other", map[string]interface{}{"token": "t", "value": "v"}, false, nil},
+		{LSPProgressMethod, []interface{}{"t"}, false, nil},
+	}
+	for _, test := range tests {
+		got = nil
+		notif, _ := MakeNotification(test.method, test.params)
+		if handled := c.HandleNotification(notif); handled != test.handled || !reflect.DeepEqual(got, test.value) {
+			t.Errorf("%s %v: expected %v %v got %v %v", test.method, test.params, test.handled, test.value, handled, got)
+		}
+	}
+}
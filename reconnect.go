@@ -0,0 +1,736 @@
+//go:generate stringer -type=ConnState
+
+package gojsonrpc
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Backoff bounds used by ReconnectingClient when MinBackoff or MaxBackoff is
+// zero.
+const (
+	DefaultMinBackoff = 100 * time.Millisecond
+	DefaultMaxBackoff = 30 * time.Second
+)
+
+// DefaultRetryAttempts is the number of times a ReconnectingClient attempts a
+// call under the RetryIdempotent policy when RetryAttempts is zero.
+const DefaultRetryAttempts = 3
+
+// ReconnectingClient errors.
+var (
+	ErrConnectionLost = errors.New("gojsonrpc: connection lost")
+	ErrClientClosed   = errors.New("gojsonrpc: client closed")
+)
+
+// ConnState is the state of a ReconnectingClient's connection.
+type ConnState int
+
+const (
+	// Connecting means that the client is dialing, or waiting to dial again.
+	Connecting ConnState = iota
+	// Connected means that calls are sent on a connection.
+	Connected
+	// Disconnected means that the connection was lost. The client goes back
+	// to Connecting right after.
+	Disconnected
+	// Closed means that Close was called.
+	Closed
+)
+
+// InFlightPolicy is what a ReconnectingClient does with the calls waiting for
+// their response when the connection is lost.
+type InFlightPolicy int
+
+const (
+	// FailInFlight makes the calls return ErrConnectionLost.
+	FailInFlight InFlightPolicy = iota
+	// RetryIdempotent sends the calls to the methods listed in Idempotent
+	// again, with a new ID, once reconnected, following their RetryPolicy
+	// with ErrConnectionLost added to the transport errors it retries. Calls
+	// that still fail after RetryAttempts attempts, unless their policy sets
+	// MaxAttempts, and other calls, fail with ErrConnectionLost.
+	RetryIdempotent
+)
+
+// ReconnectingClient makes calls over a stream connection, such as TCP, which
+// it dials again whenever it is lost. Reconnection attempts are spaced by an
+// exponential backoff, from MinBackoff to MaxBackoff, with jitter.
+//
+// Calls made while disconnected wait for the connection, until their context
+// ends. Subscriptions made with Subscribe are made again on each new
+// connection, before any other call is sent on it; a connection on which one
+// of them isn't answered within MaxBackoff is dropped.
+//
+// Fields must be set before the first call. The connection is dialed on the
+// first call, and the client must be closed with Close.
+type ReconnectingClient struct {
+	// Dial opens a connection to the server. It must return once ctx ends.
+	Dial func(ctx context.Context) (net.Conn, error)
+	// Framing is how messages are delimited on the connection.
+	Framing Framing
+	// Parser parses the messages received.
+	Parser Parser
+	// MinBackoff and MaxBackoff bound the delay between connection attempts,
+	// which doubles after each failure. If zero, DefaultMinBackoff and
+	// DefaultMaxBackoff are used.
+	MinBackoff, MaxBackoff time.Duration
+	// InFlight is what happens to pending calls when the connection is lost.
+	InFlight InFlightPolicy
+	// Idempotent lists the methods that may be called again safely, for the
+	// RetryIdempotent policy.
+	Idempotent map[string]bool
+	// RetryAttempts is the number of times a call is attempted under the
+	// RetryIdempotent policy, including the first, if its RetryPolicy
+	// doesn't set MaxAttempts. If zero, DefaultRetryAttempts is used.
+	RetryAttempts int
+	// Retry holds the RetryPolicy of each method, as in Client. The policy
+	// under "" applies to the methods not listed. Its Transport may retry
+	// ErrConnectionLost, whatever the InFlight policy.
+	Retry map[string]RetryPolicy
+	// OnStateChange, if set, is called, in order, on each change of state,
+	// with the error that caused it if any. It is also called with Connecting
+	// and the error of each failed connection attempt.
+	OnStateChange func(state ConnState, err error)
+	// OnNotification, if set, is called with each notification that isn't
+	// for a subscription or a call made with CallWithProgress, from the
+	// goroutine reading the connection.
+	OnNotification func(notif *Notification)
+
+	client  Client
+	once    sync.Once
+	ctx     context.Context
+	cancel  context.CancelFunc
+	stopped chan struct{}
+
+	mu     sync.Mutex
+	state  ConnState
+	live   *reconnectConn
+	ready  chan struct{}
+	subs   map[*ClientSubscription]struct{}
+	subIDs map[string]*ClientSubscription
+}
+
+// ClientSubscription is a subscription made with ReconnectingClient.Subscribe.
+type ClientSubscription struct {
+	client   *ReconnectingClient
+	method   string
+	params   interface{}
+	onResult func(result interface{})
+	id       string
+	done     chan struct{}
+	err      error
+	once     sync.Once
+}
+
+// reconnectConn is one of the connections of a ReconnectingClient.
+type reconnectConn struct {
+	client *ReconnectingClient
+	conn   net.Conn
+
+	wmu sync.Mutex
+	w   *bufio.Writer
+
+	mu      sync.Mutex
+	waiting map[uint]*reconnectCall
+	done    chan struct{}
+	once    sync.Once
+}
+
+// reconnectCall is a call waiting for its response. hook, if set, is called
+// from the goroutine reading the connection when the response arrives, before
+// the next message is read.
+type reconnectCall struct {
+	resp chan *Response
+	hook func(resp *Response)
+}
+
+func (c *ReconnectingClient) start() {
+	c.once.Do(func() {
+		c.client.Transport = RoundTripperFunc(c.roundTrip)
+		c.client.Parser = c.Parser
+		c.client.Retry = c.retryPolicies()
+		c.ctx, c.cancel = context.WithCancel(context.Background())
+		c.stopped = make(chan struct{})
+		c.ready = make(chan struct{})
+		go c.run()
+	})
+}
+
+// retryPolicies returns the Retry of the inner Client: Retry, with the
+// policies of the Idempotent methods also retrying ErrConnectionLost under the
+// RetryIdempotent policy.
+func (c *ReconnectingClient) retryPolicies() map[string]RetryPolicy {
+	policies := make(map[string]RetryPolicy, len(c.Retry)+len(c.Idempotent))
+	for method, p := range c.Retry {
+		policies[method] = p
+	}
+	if c.InFlight != RetryIdempotent {
+		return policies
+	}
+
+	for method, idempotent := range c.Idempotent {
+		if !idempotent {
+			continue
+		}
+		p, ok := c.Retry[method]
+		if !ok {
+			p = c.Retry[""]
+		}
+		if p.MaxAttempts < 2 {
+			p.MaxAttempts = c.RetryAttempts
+			if p.MaxAttempts <= 0 {
+				p.MaxAttempts = DefaultRetryAttempts
+			}
+		}
+		if p.MinBackoff == 0 && p.MaxBackoff == 0 {
+			p.MinBackoff, p.MaxBackoff = c.MinBackoff, c.MaxBackoff
+		}
+		transport := p.Transport
+		p.Transport = func(err error) bool {
+			return err == ErrConnectionLost || transport != nil && transport(err)
+		}
+		policies[method] = p
+	}
+	return policies
+}
+
+// Use adds interceptors around the requests sent by Call, as Client.Use does.
+// Each attempt of a retried call goes through them.
+func (c *ReconnectingClient) Use(interceptors ...Interceptor) {
+	c.client.Use(interceptors...)
+}
+
+// Call is like Client.Call. If the connection is lost before the response
+// arrives, it returns ErrConnectionLost, or calls method again once
+// reconnected, following the InFlight policy and Retry.
+func (c *ReconnectingClient) Call(ctx context.Context, method string, params interface{}, result interface{}) error {
+	c.start()
+	return c.client.Call(ctx, method, params, result)
+}
+
+// CallWithProgress is like Client.CallWithProgress, following the InFlight
+// policy and Retry as Call does.
+func (c *ReconnectingClient) CallWithProgress(ctx context.Context, method string, params interface{}, result interface{}, onProgress func(value interface{})) error {
+	c.start()
+	return c.client.CallWithProgress(ctx, method, params, result, onProgress)
+}
+
+// Notify sends a notification for method with params.
+func (c *ReconnectingClient) Notify(ctx context.Context, method string, params interface{}) error {
+	c.start()
+	return c.client.Notify(ctx, method, params)
+}
+
+// State returns the state of the connection.
+func (c *ReconnectingClient) State() ConnState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.state
+}
+
+// Close closes the connection and stops reconnecting. Pending calls and
+// subscriptions end with ErrClientClosed.
+func (c *ReconnectingClient) Close() error {
+	c.start()
+	c.cancel()
+	<-c.stopped
+
+	c.mu.Lock()
+	if c.state == Closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.state, c.live = Closed, nil
+	subs := make([]*ClientSubscription, 0, len(c.subs))
+	for sub := range c.subs {
+		subs = append(subs, sub)
+	}
+	c.mu.Unlock()
+
+	for _, sub := range subs {
+		sub.end(ErrClientClosed)
+	}
+	if c.OnStateChange != nil {
+		c.OnStateChange(Closed, nil)
+	}
+	return nil
+}
+
+// run connects, and reconnects whenever the connection is lost, until the
+// client is closed.
+func (c *ReconnectingClient) run() {
+	defer close(c.stopped)
+
+	var backoff time.Duration
+	c.setState(Connecting, nil, nil)
+	for {
+		netConn, err := c.Dial(c.ctx)
+		if c.ctx.Err() != nil {
+			if err == nil {
+				netConn.Close()
+			}
+			return
+		}
+		if err != nil {
+			c.setState(Connecting, nil, err)
+			backoff = c.nextBackoff(backoff)
+			if !c.sleep(jitter(backoff)) {
+				return
+			}
+			continue
+		}
+		backoff = 0
+
+		conn := &reconnectConn{
+			client:  c,
+			conn:    netConn,
+			w:       bufio.NewWriter(netConn),
+			waiting: make(map[uint]*reconnectCall),
+			done:    make(chan struct{}),
+		}
+		lost := make(chan error, 1)
+		go func() { lost <- conn.read() }()
+
+		if c.resubscribe(conn) {
+			c.setState(Connected, conn, nil)
+		}
+		select {
+		case err = <-lost:
+		case <-c.ctx.Done():
+			conn.close()
+			<-lost
+			return
+		}
+		c.setState(Disconnected, nil, err)
+		c.setState(Connecting, nil, nil)
+	}
+}
+
+// setState records state, and conn as the connection to use if state is
+// Connected, then calls OnStateChange.
+func (c *ReconnectingClient) setState(state ConnState, conn *reconnectConn, err error) {
+	c.mu.Lock()
+	c.state = state
+	switch {
+	case conn != nil:
+		c.live = conn
+		close(c.ready)
+	case c.live != nil:
+		c.live = nil
+		c.ready = make(chan struct{})
+	}
+	c.mu.Unlock()
+
+	if c.OnStateChange != nil {
+		c.OnStateChange(state, err)
+	}
+}
+
+// nextBackoff returns the delay to wait after d before the next connection
+// attempt.
+func (c *ReconnectingClient) nextBackoff(d time.Duration) time.Duration {
+	return nextBackoff(d, c.MinBackoff, c.MaxBackoff)
+}
+
+// nextBackoff returns the delay following d in an exponential backoff from
+// min to max, which default to DefaultMinBackoff and DefaultMaxBackoff.
+func nextBackoff(d, min, max time.Duration) time.Duration {
+	if min <= 0 {
+		min = DefaultMinBackoff
+	}
+	if max <= 0 {
+		max = DefaultMaxBackoff
+	}
+
+	if d < min {
+		d = min
+	} else {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
+
+// jitter returns a random duration between d/2 and d, so that clients losing
+// their connections together don't all reconnect at once.
+func jitter(d time.Duration) time.Duration {
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(d-half)+1))
+}
+
+// sleep waits for d, returning false if the client is closed first.
+func (c *ReconnectingClient) sleep(d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return true
+	case <-c.ctx.Done():
+		return false
+	}
+}
+
+// waitConn returns the connection, waiting for it if the client isn't
+// connected.
+func (c *ReconnectingClient) waitConn(ctx context.Context) (*reconnectConn, error) {
+	for {
+		c.mu.Lock()
+		live, ready := c.live, c.ready
+		c.mu.Unlock()
+		if live != nil {
+			return live, nil
+		}
+
+		select {
+		case <-ready:
+		case <-c.stopped:
+			return nil, ErrClientClosed
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// roundTrip is the RoundTripper of the inner Client.
+func (c *ReconnectingClient) roundTrip(ctx context.Context, message []byte) ([]byte, error) {
+	conn, err := c.waitConn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := c.Parser.ParseIncoming(string(message))
+	if err != nil {
+		return nil, err
+	}
+	req, ok := msg.(*Request)
+	if !ok {
+		return nil, conn.send(message)
+	}
+	resp, err := conn.call(ctx, message, req.ID(), nil)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(resp)
+}
+
+// Subscribe calls method with params, which must return the ID of a
+// subscription as a string, as Subscriptions does. Each result then published
+// on the subscription is passed to onResult, from the goroutine reading the
+// connection, so onResult must not block.
+//
+// After a reconnection, method is called again with params, and results
+// published on the new subscription are passed to onResult. If that call
+// fails, the subscription ends with its error.
+func (c *ReconnectingClient) Subscribe(ctx context.Context, method string, params interface{}, onResult func(result interface{})) (*ClientSubscription, error) {
+	c.start()
+	sub := &ClientSubscription{
+		client:   c,
+		method:   method,
+		params:   params,
+		onResult: onResult,
+		done:     make(chan struct{}),
+	}
+
+	for {
+		conn, err := c.waitConn(ctx)
+		if err != nil {
+			return nil, err
+		}
+		err = c.subscribe(ctx, conn, sub)
+		if err == ErrConnectionLost && sub.ID() != "" {
+			// The subscription will be made again on the next connection.
+			return sub, nil
+		}
+		if err != ErrConnectionLost {
+			if err != nil {
+				sub.end(err)
+				return nil, err
+			}
+			return sub, nil
+		}
+	}
+}
+
+// subscribe makes sub on conn. The subscription is registered as soon as the
+// response arrives, so that the notifications following it aren't missed.
+func (c *ReconnectingClient) subscribe(ctx context.Context, conn *reconnectConn, sub *ClientSubscription) error {
+	id := uint(atomic.AddUint64(&c.client.lastID, 1))
+	req, err := MakeRequest(sub.method, sub.params, id)
+	if err != nil {
+		return err
+	}
+	message, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	resp, err := conn.call(ctx, message, id, func(resp *Response) {
+		if subID, ok := resp.Result().(string); ok && !resp.IsError() {
+			c.register(sub, subID)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if resp.IsError() {
+		return resp.Error()
+	}
+	if _, ok := resp.Result().(string); !ok {
+		return ErrUnexpectedResponse
+	}
+	return nil
+}
+
+// register records subID as the ID of sub on the server.
+func (c *ReconnectingClient) register(sub *ClientSubscription, subID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	select {
+	case <-sub.done:
+		return
+	default:
+	}
+	if c.subs == nil {
+		c.subs = make(map[*ClientSubscription]struct{})
+		c.subIDs = make(map[string]*ClientSubscription)
+	}
+	delete(c.subIDs, sub.id)
+	sub.id = subID
+	c.subs[sub] = struct{}{}
+	c.subIDs[subID] = sub
+}
+
+// resubscribe makes the subscriptions again on conn, returning false if conn
+// was lost meanwhile. conn is closed if a subscription isn't answered within
+// MaxBackoff.
+func (c *ReconnectingClient) resubscribe(conn *reconnectConn) bool {
+	c.mu.Lock()
+	subs := make([]*ClientSubscription, 0, len(c.subs))
+	for sub := range c.subs {
+		subs = append(subs, sub)
+	}
+	c.mu.Unlock()
+
+	timeout := c.MaxBackoff
+	if timeout <= 0 {
+		timeout = DefaultMaxBackoff
+	}
+	for _, sub := range subs {
+		ctx, cancel := context.WithTimeout(c.ctx, timeout)
+		err := c.subscribe(ctx, conn, sub)
+		cancel()
+		if err == ErrConnectionLost || c.ctx.Err() != nil {
+			return false
+		}
+		if err == context.DeadlineExceeded {
+			conn.close()
+			return false
+		}
+		if err != nil {
+			sub.end(err)
+		}
+	}
+	return true
+}
+
+// handleNotification passes notif to its subscription, to the call made with
+// CallWithProgress it reports on, or to OnNotification.
+func (c *ReconnectingClient) handleNotification(notif *Notification) {
+	if c.client.HandleNotification(notif) {
+		return
+	}
+	if params, ok := notif.Params().(map[string]interface{}); ok {
+		if id, ok := params["subscription"].(string); ok {
+			c.mu.Lock()
+			sub, ok := c.subIDs[id]
+			c.mu.Unlock()
+			if ok {
+				sub.onResult(params["result"])
+				return
+			}
+		}
+	}
+	if c.OnNotification != nil {
+		c.OnNotification(notif)
+	}
+}
+
+// ID returns the ID of the subscription on the server, which changes after
+// each reconnection.
+func (sub *ClientSubscription) ID() string {
+	sub.client.mu.Lock()
+	defer sub.client.mu.Unlock()
+
+	return sub.id
+}
+
+// Done is closed once the subscription has ended.
+func (sub *ClientSubscription) Done() <-chan struct{} {
+	return sub.done
+}
+
+// Err returns why the subscription ended, once Done is closed.
+func (sub *ClientSubscription) Err() error {
+	return sub.err
+}
+
+// Unsubscribe ends the subscription, then calls method, e.g. eth_unsubscribe,
+// with its ID as only param if the client is connected.
+func (sub *ClientSubscription) Unsubscribe(ctx context.Context, method string) error {
+	c := sub.client
+	c.mu.Lock()
+	id, connected := sub.id, c.live != nil
+	c.mu.Unlock()
+
+	sub.end(ErrSubscriptionClosed)
+	if !connected {
+		return nil
+	}
+	return c.client.Call(ctx, method, []interface{}{id}, nil)
+}
+
+func (sub *ClientSubscription) end(err error) {
+	sub.once.Do(func() {
+		c := sub.client
+		c.mu.Lock()
+		sub.err = err
+		delete(c.subs, sub)
+		if c.subIDs[sub.id] == sub {
+			delete(c.subIDs, sub.id)
+		}
+		c.mu.Unlock()
+		close(sub.done)
+	})
+}
+
+// read passes the messages received to the calls waiting for them, or to
+// handleNotification, until the connection is lost.
+func (conn *reconnectConn) read() error {
+	defer conn.close()
+
+	c := conn.client
+	p := c.Parser
+	p.UseNumber = true
+	maxBytes := 0
+	if p.Limits != nil {
+		maxBytes = p.Limits.MaxBytes
+	}
+
+	r := bufio.NewReader(conn.conn)
+	for {
+		data, err := c.Framing.ReadFrame(r, maxBytes)
+		if err == MessageTooLarge {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		msg, err := p.ParseIncoming(string(data))
+		if err != nil {
+			continue
+		}
+
+		switch m := msg.(type) {
+		case *Notification:
+			c.handleNotification(m)
+		case *Response:
+			var calls []*reconnectCall
+			conn.mu.Lock()
+			if call, ok := conn.waiting[m.ID()]; ok && !m.HasNullID() {
+				calls = append(calls, call)
+			} else if m.HasNullID() && m.IsError() {
+				// The server couldn't parse a message, so the error is the
+				// reply to the only pending call, or to any of them.
+				for _, call := range conn.waiting {
+					calls = append(calls, call)
+				}
+			}
+			conn.mu.Unlock()
+
+			for _, call := range calls {
+				if call.hook != nil {
+					call.hook(m)
+				}
+				select {
+				case call.resp <- m:
+				default:
+				}
+			}
+		}
+	}
+}
+
+// call sends message, a request with the given id, and waits for its
+// response.
+func (conn *reconnectConn) call(ctx context.Context, message []byte, id uint, hook func(*Response)) (*Response, error) {
+	call := &reconnectCall{resp: make(chan *Response, 1), hook: hook}
+	conn.mu.Lock()
+	conn.waiting[id] = call
+	conn.mu.Unlock()
+	defer func() {
+		conn.mu.Lock()
+		delete(conn.waiting, id)
+		conn.mu.Unlock()
+	}()
+
+	if err := conn.send(message); err != nil {
+		return nil, err
+	}
+	select {
+	case resp := <-call.resp:
+		return resp, nil
+	case <-conn.done:
+		select {
+		case resp := <-call.resp:
+			return resp, nil
+		default:
+		}
+		return nil, conn.lostError()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// send writes message on the connection.
+func (conn *reconnectConn) send(message []byte) error {
+	conn.wmu.Lock()
+	defer conn.wmu.Unlock()
+
+	err := conn.client.Framing.WriteFrame(conn.w, message)
+	if err == nil {
+		err = conn.w.Flush()
+	}
+	if err != nil {
+		conn.close()
+		return conn.lostError()
+	}
+	return nil
+}
+
+func (conn *reconnectConn) lostError() error {
+	if conn.client.ctx.Err() != nil {
+		return ErrClientClosed
+	}
+	return ErrConnectionLost
+}
+
+func (conn *reconnectConn) close() {
+	conn.once.Do(func() {
+		close(conn.done)
+		conn.conn.Close()
+	})
+}
@@ -0,0 +1,444 @@
+package gojsonrpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testStates records the states reported by a ReconnectingClient.
+type testStates struct {
+	mu     sync.Mutex
+	states []ConnState
+	errs   []error
+	change chan struct{}
+}
+
+func newTestStates() *testStates {
+	return &testStates{change: make(chan struct{}, 100)}
+}
+
+func (s *testStates) record(state ConnState, err error) {
+	s.mu.Lock()
+	s.states = append(s.states, state)
+	s.errs = append(s.errs, err)
+	s.mu.Unlock()
+	s.change <- struct{}{}
+}
+
+// wait waits until the client has been Connected n times.
+func (s *testStates) wait(t *testing.T, n int) {
+	deadline := time.After(5 * time.Second)
+	for {
+		s.mu.Lock()
+		count := 0
+		for _, state := range s.states {
+			if state == Connected {
+				count++
+			}
+		}
+		s.mu.Unlock()
+		if count >= n {
+			return
+		}
+		select {
+		case <-s.change:
+		case <-deadline:
+			t.Fatalf("expected %d connections", n)
+		}
+	}
+}
+
+func testReconnectingClient(t *testing.T, l net.Listener, configure func(c *ReconnectingClient)) (*ReconnectingClient, *testStates) {
+	states := newTestStates()
+	c := &ReconnectingClient{
+		Dial: func(ctx context.Context) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "tcp", l.Addr().String())
+		},
+		MinBackoff:    time.Millisecond,
+		MaxBackoff:    10 * time.Millisecond,
+		OnStateChange: states.record,
+	}
+	if configure != nil {
+		configure(c)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c, states
+}
+
+// testDropConns closes the server side of all of s's connections.
+func testDropConns(s *Server) {
+	for _, conn := range s.Conns() {
+		conn.Close()
+	}
+}
+
+func TestReconnectingClient(t *testing.T) {
+	s, l, _ := testServer(t, nil, nil)
+	defer s.Close()
+	c, states := testReconnectingClient(t, l, nil)
+
+	var result []int
+	if err := c.Call(context.Background(), "echo", []int{1}, &result); err != nil || len(result) != 1 {
+		t.Fatalf("expected [1] got %v, %v", result, err)
+	}
+	if c.State() != Connected {
+		t.Errorf("expected Connected got %v", c.State())
+	}
+
+	testDropConns(s)
+	states.wait(t, 2)
+	if err := c.Call(context.Background(), "echo", []int{2}, &result); err != nil || result[0] != 2 {
+		t.Fatalf("after reconnection: expected [2] got %v, %v", result, err)
+	}
+	if err := c.Call(context.Background(), "fail", nil, nil); err == nil {
+		t.Error("expected an error")
+	}
+
+	c.Close()
+	states.mu.Lock()
+	expected := []ConnState{Connecting, Connected, Disconnected, Connecting, Connected, Closed}
+	if len(states.states) != len(expected) {
+		t.Fatalf("expected states %v got %v", expected, states.states)
+	}
+	for i, state := range expected {
+		if states.states[i] != state {
+			t.Errorf("expected states %v got %v", expected, states.states)
+			break
+		}
+	}
+	states.mu.Unlock()
+	if err := c.Call(context.Background(), "echo", nil, nil); err != ErrClientClosed {
+		t.Errorf("expected ErrClientClosed got %v", err)
+	}
+}
+
+func TestReconnectingClientInFlight(t *testing.T) {
+	tests := []struct {
+		policy   InFlightPolicy
+		expected error
+	}{
+		{FailInFlight, ErrConnectionLost},
+		{RetryIdempotent, nil},
+	}
+	for _, test := range tests {
+		release := make(chan struct{})
+		s, l, _ := testServer(t, release, nil)
+		c, states := testReconnectingClient(t, l, func(c *ReconnectingClient) {
+			c.InFlight = test.policy
+			c.Idempotent = map[string]bool{"wait": true}
+		})
+
+		called := make(chan error, 1)
+		go func() {
+			var result string
+			err := c.Call(context.Background(), "wait", nil, &result)
+			if err == nil && result != "released" {
+				err = errors.New("unexpected result " + result)
+			}
+			called <- err
+		}()
+		for len(s.Conns()) == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		time.Sleep(10 * time.Millisecond)
+
+		testDropConns(s)
+		states.wait(t, 2)
+		close(release)
+		select {
+		case err := <-called:
+			if err != test.expected {
+				t.Errorf("policy %d: expected %v got %v", test.policy, test.expected, err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("policy %d: the call didn't return", test.policy)
+		}
+		c.Close()
+		s.Close()
+	}
+}
+
+func TestReconnectingClientBackoff(t *testing.T) {
+	dialErr := errors.New("refused")
+	attempts := 0
+	states := newTestStates()
+	server, client := net.Pipe()
+	defer server.Close()
+	go io.Copy(ioutil.Discard, server)
+	c := &ReconnectingClient{
+		Dial: func(ctx context.Context) (net.Conn, error) {
+			if attempts++; attempts < 4 {
+				return nil, dialErr
+			}
+			return client, nil
+		},
+		MinBackoff:    time.Millisecond,
+		OnStateChange: states.record,
+	}
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c.start()
+	states.wait(t, 1)
+	if err := c.Notify(ctx, "ping", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	states.mu.Lock()
+	failures := 0
+	for i, err := range states.errs {
+		if err == dialErr && states.states[i] == Connecting {
+			failures++
+		}
+	}
+	states.mu.Unlock()
+	if failures != 3 {
+		t.Errorf("expected 3 failed attempts got %d", failures)
+	}
+
+	tests := []struct {
+		min, max, d, expected time.Duration
+	}{
+		{0, 0, 0, DefaultMinBackoff},
+		{time.Second, 0, 0, time.Second},
+		{time.Second, 0, time.Second, 2 * time.Second},
+		{time.Second, 3 * time.Second, 2 * time.Second, 3 * time.Second},
+		{0, 0, DefaultMaxBackoff, DefaultMaxBackoff},
+	}
+	for _, test := range tests {
+		c := &ReconnectingClient{MinBackoff: test.min, MaxBackoff: test.max}
+		if d := c.nextBackoff(test.d); d != test.expected {
+			t.Errorf("%v after %v: expected %v got %v", test, test.d, test.expected, d)
+		}
+	}
+	for i := 0; i < 100; i++ {
+		if d := jitter(time.Second); d < time.Second/2 || d > time.Second {
+			t.Fatalf("jitter out of range: %v", d)
+		}
+	}
+}
+
+func TestReconnectingClientResubscribe(t *testing.T) {
+	subs := &Subscriptions{Method: "sub"}
+	created := make(chan *Subscription, 2)
+	d := new(Dispatcher)
+	d.Register("subscribe", func(ctx context.Context, params interface{}) (interface{}, *Error) {
+		sub, err := subs.Subscribe(ctx)
+		if err != nil {
+			return nil, AsError(err)
+		}
+		created <- sub
+		return sub.ID(), nil
+	})
+	d.Register("unsubscribe", subs.UnsubscribeHandler())
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{Dispatcher: d}
+	go s.Serve(l)
+	defer s.Close()
+
+	var notified []string
+	received := make(chan interface{}, 4)
+	c, states := testReconnectingClient(t, l, func(c *ReconnectingClient) {
+		c.OnNotification = func(notif *Notification) { notified = append(notified, notif.Method()) }
+	})
+	sub, err := c.Subscribe(context.Background(), "subscribe", nil, func(result interface{}) { received <- result })
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := sub.ID()
+
+	publish := func(value string) {
+		server := <-created
+		created <- server
+		if err := server.Publish(context.Background(), value); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case result := <-received:
+			if result != value {
+				t.Errorf("expected %s got %v", value, result)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s not received", value)
+		}
+	}
+	publish("before")
+
+	<-created
+	testDropConns(s)
+	states.wait(t, 2)
+	publish("after")
+	if sub.ID() == first {
+		t.Error("the subscription should have a new ID")
+	}
+
+	if err := sub.Unsubscribe(context.Background(), "unsubscribe"); err != nil {
+		t.Fatal(err)
+	}
+	<-sub.Done()
+	if sub.Err() != ErrSubscriptionClosed {
+		t.Errorf("expected ErrSubscriptionClosed got %v", sub.Err())
+	}
+	for deadline := time.Now().Add(5 * time.Second); subs.Len() != 0; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected no subscriptions got %d", subs.Len())
+		}
+	}
+	if len(notified) != 0 {
+		t.Errorf("unexpected notifications %v", notified)
+	}
+}
+
+func TestReconnectingClientRetryAttempts(t *testing.T) {
+	var calls int32
+	d := new(Dispatcher)
+	d.Register("drop", func(ctx context.Context, params interface{}) (interface{}, *Error) {
+		atomic.AddInt32(&calls, 1)
+		peer, _ := PeerFromContext(ctx)
+		peer.Close()
+		return nil, nil
+	})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{Dispatcher: d}
+	go s.Serve(l)
+	defer s.Close()
+
+	c, _ := testReconnectingClient(t, l, func(c *ReconnectingClient) {
+		c.InFlight = RetryIdempotent
+		c.Idempotent = map[string]bool{"drop": true}
+	})
+	if err := c.Call(context.Background(), "drop", nil, nil); err != ErrConnectionLost {
+		t.Errorf("expected ErrConnectionLost got %v", err)
+	}
+	if n := atomic.LoadInt32(&calls); n != DefaultRetryAttempts {
+		t.Errorf("expected %d attempts got %d", DefaultRetryAttempts, n)
+	}
+}
+
+func TestReconnectingClientNullIDError(t *testing.T) {
+	s, l, _ := testServer(t, nil, func(s *Server) {
+		s.Dispatcher.Parser.Limits = &Limits{MaxStringLength: 8}
+	})
+	defer s.Close()
+	c, _ := testReconnectingClient(t, l, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := c.Call(ctx, "echo", []string{"a long string"}, nil)
+	if e := AsError(err); e == nil || e.Code() != CodeInvalidRequest {
+		t.Errorf("expected an invalid request error got %v", err)
+	}
+}
+
+func TestReconnectingClientProgress(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{Dispatcher: testProgressDispatcher()}
+	go s.Serve(l)
+	defer s.Close()
+
+	var notified []*Notification
+	c, _ := testReconnectingClient(t, l, func(c *ReconnectingClient) {
+		c.OnNotification = func(notif *Notification) { notified = append(notified, notif) }
+	})
+	var values []interface{}
+	params := map[string]interface{}{"steps": []interface{}{1, 2}}
+	err = c.CallWithProgress(context.Background(), "long", params, nil, func(v interface{}) {
+		values = append(values, v)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 2 || len(notified) != 0 {
+		t.Errorf("expected 2 progress values got %v, and notifications %v", values, notified)
+	}
+}
+
+func TestReconnectingClientResubscribeTimeout(t *testing.T) {
+	var calls int32
+	d := new(Dispatcher)
+	d.Register("subscribe", func(ctx context.Context, params interface{}) (interface{}, *Error) {
+		n := atomic.AddInt32(&calls, 1)
+		if n == 2 {
+			// The first resubscription is never answered.
+			<-ctx.Done()
+			return nil, nil
+		}
+		return "sub" + strconv.Itoa(int(n)), nil
+	})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{Dispatcher: d}
+	go s.Serve(l)
+	defer s.Close()
+
+	c, states := testReconnectingClient(t, l, nil)
+	sub, err := c.Subscribe(context.Background(), "subscribe", nil, func(interface{}) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testDropConns(s)
+	states.wait(t, 2)
+	if id := sub.ID(); id != "sub3" {
+		t.Errorf("expected the subscription to be made on a third connection, got %s", id)
+	}
+}
+
+func TestReconnectingClientRetryPolicy(t *testing.T) {
+	release := make(chan struct{})
+	s, l, _ := testServer(t, release, nil)
+	defer s.Close()
+	c, states := testReconnectingClient(t, l, func(c *ReconnectingClient) {
+		c.Retry = map[string]RetryPolicy{"wait": {
+			MaxAttempts: 2,
+			MinBackoff:  time.Millisecond,
+			Transport:   func(err error) bool { return err == ErrConnectionLost },
+		}}
+	})
+	var ids []uint
+	c.Use(testRecordIDs(&ids))
+
+	called := make(chan error, 1)
+	go func() { called <- c.Call(context.Background(), "wait", nil, nil) }()
+	for len(s.Conns()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	testDropConns(s)
+	states.wait(t, 2)
+	close(release)
+	select {
+	case err := <-called:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the call didn't return")
+	}
+	if len(ids) != 2 || ids[0] == ids[1] {
+		t.Errorf("expected 2 attempts with different IDs got %v", ids)
+	}
+}
@@ -1,9 +1,6 @@
 package gojsonrpc
 
-import (
-	"encoding/json"
-	"reflect"
-)
+import "encoding/json"
 
 type requestData struct {
 	Jsonrpc string      `json:"jsonrpc"`
@@ -17,6 +14,11 @@ type Request struct {
 	requestData
 }
 
+// Reset clears r, so that it can be reused.
+func (r *Request) Reset() {
+	r.requestData = requestData{}
+}
+
 // JSONRPCVersion returns the version of the protocol being used.
 func (n *Request) JSONRPCVersion() string {
 	return n.requestData.Jsonrpc
@@ -38,6 +40,28 @@ func (r *Request) ID() uint {
 	return r.requestData.ID
 }
 
+// MakeResponseWithResult creates a result Response to r, using the same ID and
+// protocol version as r. Servers should prefer this to the package level
+// function so that JSON-RPC 1.0 clients are answered in their own dialect.
+func (r *Request) MakeResponseWithResult(result interface{}) *Response {
+	resp := MakeResponseWithResult(result, r.ID())
+	resp.responseData.Jsonrpc = r.JSONRPCVersion()
+	return resp
+}
+
+// MakeResponseWithError creates an error Response to r, using the same ID and
+// protocol version as r. Passing nil for the error argument will cause an error
+// to be returned.
+func (r *Request) MakeResponseWithError(err *Error) (*Response, error) {
+	resp, e := MakeResponseWithError(err, r.ID())
+	if e != nil {
+		return nil, e
+	}
+
+	resp.responseData.Jsonrpc = r.JSONRPCVersion()
+	return resp, nil
+}
+
 // RequestValidAndExpectedKeys is a map whose keys are all the possible fields in a
 // request, mapped to whether they are required fields (e.g. params is not a
 // required field for a request, so it maps to false). This mapping is used by
@@ -45,28 +69,14 @@ func (r *Request) ID() uint {
 var RequestValidAndExpectedKeys = map[string]bool{"jsonrpc": true, "method": true, "params": false, "id": true}
 
 // MakeRequest is used to create Request structs - do not try to use a struct
-// literal. You may pass nil for the params argument. Else, params must be an
-// array/slice or a map with string keys.
+// literal. You may pass nil for the params argument. Else, params must be a
+// value that marshals to a JSON array or object (a slice, array, map, struct,
+// a pointer to one of those, a json.Marshaler, a json.RawMessage...). Params
+// that marshal to null, such as a nil pointer, are treated as nil.
 func MakeRequest(method string, params interface{}, id uint) (*Request, error) {
-	if params != nil {
-		// Params must be either an array/slice or a map with string keys.
-		value := reflect.ValueOf(params)
-		kind := value.Kind()
-		if kind != reflect.Array &&
-			kind != reflect.Slice &&
-			kind != reflect.Map &&
-			kind != reflect.Struct &&
-			kind != reflect.Ptr {
-			return nil, InvalidRequestInvalidParamsType
-		} else if kind == reflect.Map && reflect.TypeOf(params).Key().Kind() != reflect.String {
-			return nil, InvalidRequestInvalidParamsType
-		} else if kind == reflect.Ptr {
-			elemKind := reflect.TypeOf(params).Elem().Kind()
-			if elemKind != reflect.Array &&
-				elemKind != reflect.Struct {
-				return nil, InvalidRequestInvalidParamsType
-			}
-		}
+	params, ok := normalizeParams(params)
+	if !ok {
+		return nil, InvalidRequestInvalidParamsType
 	}
 
 	return &Request{
@@ -82,6 +92,14 @@ func MakeRequest(method string, params interface{}, id uint) (*Request, error) {
 // Do not use this method directly. Instead, use json.Marshal with a Request
 // as the argument.
 func (r *Request) MarshalJSON() ([]byte, error) {
+	if r.JSONRPCVersion() == Version1 {
+		return json.Marshal(messageDataV1{
+			Method: r.Method(),
+			Params: paramsV1(r.Params()),
+			ID:     &r.requestData.ID,
+		})
+	}
+
 	return json.Marshal(r.requestData)
 }
 
@@ -135,15 +135,21 @@ func TestCreateRequestWithInvalidParamsTypeString(t *testing.T) {
 	}
 }
 
-func TestCreateRequestWithInvalidParamsTypeMapWithIntKeys(t *testing.T) {
+func TestCreateRequestWithParamsTypeMapWithIntKeys(t *testing.T) {
+	// encoding/json marshals maps with integer keys to JSON objects, so these
+	// are valid params.
 	r, err := MakeRequest(testRequestMethod, map[int]interface{}{1: "test", 2: true}, testRequestId)
-	if err == nil {
-		t.Error("should have returned an error")
-	} else if err != InvalidRequestInvalidParamsType {
-		t.Error("wrong error returned")
+	if err != nil {
+		t.Fatal(err)
 	}
-	if r != nil {
-		t.Error("request should be nil")
+	jsonReq, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedJSON := `{"jsonrpc":"2.0","method":"test","params":{"1":"test","2":true},"id":1}`
+	if string(jsonReq) != expectedJSON {
+		t.Errorf("expected %s, got %s\n", expectedJSON, jsonReq)
 	}
 }
 
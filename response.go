@@ -13,7 +13,7 @@ type responseData struct {
 	Jsonrpc string      `json:"jsonrpc"`
 	Result  interface{} `json:"result,omitempty"`
 	Err     *Error      `json:"error,omitempty"`
-	ID      uint        `json:"id"`
+	ID      *uint       `json:"id"`
 	_type   responseType
 }
 
@@ -23,6 +23,12 @@ type Response struct {
 	responseData
 }
 
+// Reset clears r, so that it can be reused. The Error it held, if any, is not
+// modified.
+func (r *Response) Reset() {
+	r.responseData = responseData{}
+}
+
 func (r *Response) JSONRPCVersion() string {
 	return r.responseData.Jsonrpc
 }
@@ -37,9 +43,20 @@ func (r *Response) Error() *Error {
 	return r.responseData.Err
 }
 
-// ID returns the response's ID.
+// ID returns the response's ID. This is 0 if the ID is null - see HasNullID.
 func (r *Response) ID() uint {
-	return r.responseData.ID
+	if r.responseData.ID == nil {
+		return 0
+	}
+
+	return *r.responseData.ID
+}
+
+// HasNullID reports whether the response's ID is null. Servers send a null ID
+// when they could not read the ID of the request they are answering (see
+// ErrorResponseFor).
+func (r *Response) HasNullID() bool {
+	return r.responseData.ID == nil
 }
 
 // IsResult is a helper method for determining if a Response is an error or
@@ -72,7 +89,7 @@ func makeResponse(result interface{}, err *Error, id uint, _type responseType) *
 			Jsonrpc: Version,
 			Result:  result,
 			Err:     err,
-			ID:      id,
+			ID:      &id,
 			_type:   _type,
 		},
 	}
@@ -98,6 +115,14 @@ func MakeResponseWithError(err *Error, id uint) (*Response, error) {
 // Do not use this method directly. Instead use json.Marshal with a Response
 // as the argument.
 func (r *Response) MarshalJSON() ([]byte, error) {
+	if r.JSONRPCVersion() == Version1 {
+		return json.Marshal(responseDataV1{
+			Result: r.Result(),
+			Err:    r.Error(),
+			ID:     r.responseData.ID,
+		})
+	}
+
 	// Result is allowed to be nil, which marshals to JSON's null.
 	// Using an unnamed struct here because I don't see that we'll ever use a
 	// struct like this anywhere else.
@@ -105,11 +130,11 @@ func (r *Response) MarshalJSON() ([]byte, error) {
 		return json.Marshal(struct {
 			Jsonrpc string      `json:"jsonrpc"`
 			Result  interface{} `json:"result"`
-			ID      uint        `json:"id"`
+			ID      *uint       `json:"id"`
 		}{
 			Jsonrpc: r.JSONRPCVersion(),
 			Result:  nil,
-			ID:      r.ID(),
+			ID:      r.responseData.ID,
 		})
 	}
 
@@ -119,10 +144,27 @@ func (r *Response) MarshalJSON() ([]byte, error) {
 // Do not use this method directly. Instead use ParseIncoming and type assert
 // the returned value to a Response.
 func (r *Response) UnmarshalJSON(data []byte) error {
-	err := json.Unmarshal(data, &(r.responseData))
+	return r.unmarshal(data, json.Unmarshal)
+}
+
+// unmarshal implements UnmarshalJSON, decoding data with unmarshal.
+func (r *Response) unmarshal(data []byte, unmarshal func([]byte, interface{}) error) error {
+	// The error is decoded as errorData, as Error's UnmarshalJSON would decode
+	// its data with json.Unmarshal.
+	var wire struct {
+		Jsonrpc string      `json:"jsonrpc"`
+		Result  interface{} `json:"result"`
+		Err     *errorData  `json:"error"`
+		ID      *uint       `json:"id"`
+	}
+	err := unmarshal(data, &wire)
 	if err != nil {
 		return err
 	}
+	r.responseData = responseData{Jsonrpc: wire.Jsonrpc, Result: wire.Result, ID: wire.ID}
+	if wire.Err != nil {
+		r.responseData.Err = &Error{*wire.Err}
+	}
 
 	if r.Error() != nil && r.Result() == nil {
 		r.responseData._type = responseTypeError
@@ -134,7 +176,7 @@ func (r *Response) UnmarshalJSON(data []byte) error {
 		// see if the result field exists in the raw data.
 		// If we were at least able to unmarshal into r.responseData, we should be
 		// able to unmarshal into a map with string keys.
-		var tmp map[string]interface{}
+		var tmp map[string]json.RawMessage
 		if err = json.Unmarshal(data, &tmp); err != nil {
 			return err
 		}
@@ -0,0 +1,122 @@
+package gojsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// RetryPolicy is how a Client retries the failed calls to a method. Only
+// idempotent methods should be retried, since a call whose response was lost
+// may have been handled.
+//
+// Retries stop at the deadline of the call's context: Call returns the last
+// error rather than wait past it.
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts, including the first. If it is
+	// less than 2, calls aren't retried.
+	MaxAttempts int
+	// MinBackoff and MaxBackoff bound the delay between attempts, which
+	// doubles after each one, with jitter. If zero, DefaultMinBackoff and
+	// DefaultMaxBackoff are used.
+	MinBackoff, MaxBackoff time.Duration
+	// Codes lists the codes of the server errors to retry, e.g. -32000. If
+	// such an error's data is an object with a retryAfter member, the number
+	// of seconds it holds is waited instead of the backoff, up to MaxBackoff.
+	Codes map[int]bool
+	// Transport, if set, tells whether an error returned by the transport,
+	// such as ErrConnectionLost from a ReconnectingClient, should be retried.
+	// Context errors never are.
+	Transport func(err error) bool
+}
+
+// retryable tells whether the call may be attempted again after err.
+func (p *RetryPolicy) retryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return p.Codes[e.Code()]
+	}
+	return p.Transport != nil && p.Transport(err)
+}
+
+// retryPolicy returns the RetryPolicy for method.
+func (c *Client) retryPolicy(method string) (RetryPolicy, bool) {
+	if p, ok := c.Retry[method]; ok {
+		return p, true
+	}
+	p, ok := c.Retry[""]
+	return p, ok
+}
+
+// callWithRetry calls method until it succeeds or its RetryPolicy gives up.
+func (c *Client) callWithRetry(ctx context.Context, method string, params interface{}) (*Response, error) {
+	policy, ok := c.retryPolicy(method)
+	var delay time.Duration
+	for attempt := 1; ; attempt++ {
+		resp, err := c.call(ctx, method, params)
+		if err == nil {
+			return resp, nil
+		}
+		if !ok || attempt >= policy.MaxAttempts || !policy.retryable(err) {
+			return nil, err
+		}
+
+		delay = nextBackoff(delay, policy.MinBackoff, policy.MaxBackoff)
+		wait := jitter(delay)
+		var e *Error
+		if errors.As(err, &e) {
+			if d, ok := retryAfter(e, policy.MaxBackoff); ok {
+				wait = d
+			}
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return nil, err
+		}
+
+		t := time.NewTimer(wait)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// retryAfter returns the delay asked for by the retryAfter member of e's data,
+// in seconds, capped to max, or DefaultMaxBackoff if max is zero.
+func retryAfter(e *Error, max time.Duration) (time.Duration, bool) {
+	data, ok := e.Data().(map[string]interface{})
+	if !ok {
+		return 0, false
+	}
+
+	var seconds float64
+	switch v := data["retryAfter"].(type) {
+	case float64:
+		seconds = v
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return 0, false
+		}
+		seconds = f
+	default:
+		return 0, false
+	}
+	if seconds < 0 {
+		return 0, false
+	}
+	if max <= 0 {
+		max = DefaultMaxBackoff
+	}
+	// Compare as floats, as converting a huge value to a Duration overflows.
+	if seconds*float64(time.Second) > float64(max) {
+		return max, true
+	}
+	return time.Duration(seconds * float64(time.Second)), true
+}
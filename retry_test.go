@@ -0,0 +1,197 @@
+package gojsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testFlakyDispatcher serves "flaky", which fails with err the first failures
+// times it is called, then returns "ok".
+func testFlakyDispatcher(failures int, err *Error) *Dispatcher {
+	var mu sync.Mutex
+	d := new(Dispatcher)
+	d.Register("flaky", func(ctx context.Context, params interface{}) (interface{}, *Error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if failures > 0 {
+			failures--
+			return nil, err
+		}
+		return "ok", nil
+	})
+	return d
+}
+
+// testRecordIDs returns an Interceptor appending the ID of each request to ids.
+func testRecordIDs(ids *[]uint) Interceptor {
+	return func(next CallHandler) CallHandler {
+		return func(ctx context.Context, req *Request) (*Response, error) {
+			*ids = append(*ids, req.ID())
+			return next(ctx, req)
+		}
+	}
+}
+
+func TestClientRetry(t *testing.T) {
+	serverErr := MakeError(-32000, "busy", nil)
+	policy := RetryPolicy{MaxAttempts: 3, MinBackoff: time.Millisecond, Codes: map[int]bool{-32000: true}}
+	tests := []struct {
+		name     string
+		retry    map[string]RetryPolicy
+		failures int
+		err      *Error
+		attempts int
+		success  bool
+	}{
+		{"succeeds", map[string]RetryPolicy{"flaky": policy}, 2, serverErr, 3, true},
+		{"gives up", map[string]RetryPolicy{"flaky": policy}, 3, serverErr, 3, false},
+		{"other code", map[string]RetryPolicy{"flaky": policy}, 1, MakeError(1, "failed", nil), 1, false},
+		{"other method", map[string]RetryPolicy{"other": policy}, 1, serverErr, 1, false},
+		{"default", map[string]RetryPolicy{"": policy}, 1, serverErr, 2, true},
+		{"no retries", map[string]RetryPolicy{"flaky": {Codes: policy.Codes}}, 1, serverErr, 1, false},
+	}
+	for _, test := range tests {
+		c := testClient(testFlakyDispatcher(test.failures, test.err))
+		c.Retry = test.retry
+		var ids []uint
+		c.Use(testRecordIDs(&ids))
+
+		var result string
+		err := c.Call(context.Background(), "flaky", nil, &result)
+		if test.success && (err != nil || result != "ok") {
+			t.Errorf("%s: expected ok got %q, %v", test.name, result, err)
+		}
+		var rpcErr *Error
+		if !test.success && (!errors.As(err, &rpcErr) || rpcErr.Code() != test.err.Code()) {
+			t.Errorf("%s: expected %v got %v", test.name, test.err, err)
+		}
+		if len(ids) != test.attempts {
+			t.Errorf("%s: expected %d attempts got %d", test.name, test.attempts, len(ids))
+		}
+		for i := 1; i < len(ids); i++ {
+			if ids[i] == ids[i-1] {
+				t.Errorf("%s: retries must use new IDs, got %v", test.name, ids)
+			}
+		}
+	}
+}
+
+func TestClientRetryAfter(t *testing.T) {
+	busy := MakeError(-32000, "busy", map[string]interface{}{"retryAfter": 0.05})
+	policy := RetryPolicy{MaxAttempts: 2, MinBackoff: time.Millisecond, Codes: map[int]bool{-32000: true}}
+
+	c := testClient(testFlakyDispatcher(1, busy))
+	c.Retry = map[string]RetryPolicy{"flaky": policy}
+	start := time.Now()
+	if err := c.Call(context.Background(), "flaky", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("expected to wait for retryAfter, waited %v", elapsed)
+	}
+
+	// Waiting would go past the deadline, so the error is returned at once.
+	c = testClient(testFlakyDispatcher(1, busy))
+	c.Retry = map[string]RetryPolicy{"flaky": policy}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := c.Call(ctx, "flaky", nil, nil)
+	var rpcErr *Error
+	if !errors.As(err, &rpcErr) || rpcErr.Code() != -32000 {
+		t.Errorf("expected the server's error got %v", err)
+	}
+	if ctx.Err() != nil {
+		t.Error("the deadline should not have been reached")
+	}
+
+	tests := []struct {
+		data     interface{}
+		max      time.Duration
+		expected time.Duration
+		ok       bool
+	}{
+		{map[string]interface{}{"retryAfter": 2.0}, 0, 2 * time.Second, true},
+		{map[string]interface{}{"retryAfter": 2.0}, time.Second, time.Second, true},
+		{map[string]interface{}{"retryAfter": 3600.0}, 0, DefaultMaxBackoff, true},
+		{map[string]interface{}{"retryAfter": 1e300}, 0, DefaultMaxBackoff, true},
+		{map[string]interface{}{"retryAfter": json.Number("1e300")}, time.Minute, time.Minute, true},
+		{map[string]interface{}{"retryAfter": "1.5"}, 0, 0, false},
+		{map[string]interface{}{"retryAfter": -1.0}, 0, 0, false},
+		{map[string]interface{}{}, 0, 0, false},
+		{"retry later", 0, 0, false},
+	}
+	for _, test := range tests {
+		d, ok := retryAfter(MakeError(-32000, "busy", test.data), test.max)
+		if d != test.expected || ok != test.ok {
+			t.Errorf("%v: expected %v, %t got %v, %t", test.data, test.expected, test.ok, d, ok)
+		}
+	}
+}
+
+func TestClientRetryTransport(t *testing.T) {
+	errTransient := errors.New("transient")
+	d := testDispatcher()
+	inner := testClient(d).Transport
+	attempts := 0
+	c := &Client{Transport: RoundTripperFunc(func(ctx context.Context, message []byte) ([]byte, error) {
+		if attempts++; attempts == 1 {
+			return nil, errTransient
+		}
+		return inner.RoundTrip(ctx, message)
+	})}
+
+	policy := RetryPolicy{MaxAttempts: 2, MinBackoff: time.Millisecond}
+	c.Retry = map[string]RetryPolicy{"echo": policy}
+	if err := c.Call(context.Background(), "echo", nil, nil); err != errTransient {
+		t.Errorf("expected %v without Transport got %v", errTransient, err)
+	}
+
+	attempts = 0
+	policy.Transport = func(err error) bool { return err == errTransient }
+	c.Retry = map[string]RetryPolicy{"echo": policy}
+	if err := c.Call(context.Background(), "echo", nil, nil); err != nil || attempts != 2 {
+		t.Errorf("expected a retry got %d attempts, %v", attempts, err)
+	}
+
+	if policy.retryable(context.DeadlineExceeded) {
+		t.Error("context errors must not be retried")
+	}
+}
+
+func TestClientInterceptors(t *testing.T) {
+	c := testClient(testDispatcher())
+	var order []string
+	for _, name := range []string{"outer", "inner"} {
+		name := name
+		c.Use(func(next CallHandler) CallHandler {
+			return func(ctx context.Context, req *Request) (*Response, error) {
+				order = append(order, name)
+				return next(ctx, req)
+			}
+		})
+	}
+	if err := c.Call(context.Background(), "echo", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(order) != 2 || order[0] != "outer" || order[1] != "inner" {
+		t.Errorf("expected [outer inner] got %v", order)
+	}
+
+	errBlocked := errors.New("blocked")
+	c.Use(func(next CallHandler) CallHandler {
+		return func(ctx context.Context, req *Request) (*Response, error) {
+			if req.Method() == "fail" {
+				return nil, errBlocked
+			}
+			return next(ctx, req)
+		}
+	})
+	if err := c.Call(context.Background(), "fail", nil, nil); err != errBlocked {
+		t.Errorf("expected %v got %v", errBlocked, err)
+	}
+}
@@ -0,0 +1,492 @@
+package gojsonrpc
+
+import (
+	"bytes"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Limits bounds the size and shape of messages accepted by a Parser. A zero
+// field means no limit. Limits are checked on the raw message, before
+// encoding/json allocates anything for it.
+type Limits struct {
+	// MaxBytes is the maximum length of the whole message (MessageTooLarge).
+	MaxBytes int
+	// MaxDepth is the maximum nesting of arrays and objects, counting the
+	// message itself as depth 1 (NestingTooDeep).
+	MaxDepth int
+	// MaxElements is the maximum number of elements in any single array or
+	// members in any single object (TooManyElements).
+	MaxElements int
+	// MaxStringLength is the maximum length in bytes of any string, including
+	// object keys, as it appears in the message (StringTooLong).
+	MaxStringLength int
+	// MaxBatchLength is the maximum number of messages in a batch
+	// (BatchTooLong).
+	MaxBatchLength int
+}
+
+// DefaultLimits is a reasonable starting point for endpoints exposed to
+// untrusted clients.
+var DefaultLimits = Limits{
+	MaxBytes:        1 << 20,
+	MaxDepth:        32,
+	MaxElements:     10000,
+	MaxStringLength: 1 << 16,
+	MaxBatchLength:  1000,
+}
+
+// scanner walks a raw JSON message without decoding it, looking for input that
+// encoding/json would silently accept but that the Parser rejects because of
+// Strict or Limits. Syntax errors are not reported by the scanner - it simply
+// stops, leaving encoding/json to produce its usual error.
+type scanner struct {
+	data   []byte
+	pos    int
+	strict bool
+	limits Limits
+	depth  int
+}
+
+// scanMessage reports the first duplicate key, invalid UTF-8 sequence or lone
+// UTF-16 surrogate escape found in data if strict is set, and the first limit
+// exceeded by data if limits is non-nil.
+func scanMessage(data []byte, strict bool, limits *Limits) error {
+	s := &scanner{data: data, strict: strict}
+	if limits != nil {
+		s.limits = *limits
+	}
+
+	if s.limits.MaxBytes > 0 && len(data) > s.limits.MaxBytes {
+		return MessageTooLarge
+	}
+	if strict && !utf8.Valid(data) {
+		return InvalidUTF8
+	}
+
+	_, err := s.value()
+	return err
+}
+
+// messageKeys are the members a JSON-RPC 2.0 message may have.
+var messageKeys = [...]string{VersionKey, MethodKey, ParamsKey, IDKey, ResultKey, ErrorKey}
+
+// scanMessageKeys lists the members of the top level object in data, storing
+// them in buf, and returns the raw value of its jsonrpc member, without
+// allocating. ok is false unless data is an object whose keys are all known,
+// unescaped and unique, in which case keys are those encoding/json would
+// find. The values aren't checked.
+func scanMessageKeys(data []byte, buf *[len(messageKeys)]string) (keys []string, version []byte, ok bool) {
+	s := scanner{data: data}
+	keys = buf[:0]
+
+	s.skipSpace()
+	if s.pos >= len(data) || data[s.pos] != '{' {
+		return nil, nil, false
+	}
+	s.pos++
+	s.skipSpace()
+	closed := s.pos < len(data) && data[s.pos] == '}'
+	if closed {
+		s.pos++
+	}
+
+	for !closed {
+		s.skipSpace()
+		if s.pos >= len(data) || data[s.pos] != '"' {
+			return nil, nil, false
+		}
+		end := bytes.IndexByte(data[s.pos+1:], '"')
+		if end < 0 {
+			return nil, nil, false
+		}
+		key, ok := knownKey(data[s.pos+1:s.pos+1+end], keys)
+		if !ok {
+			return nil, nil, false
+		}
+		keys = append(keys, key)
+		s.pos += end + 2
+
+		s.skipSpace()
+		if s.pos >= len(data) || data[s.pos] != ':' {
+			return nil, nil, false
+		}
+		s.pos++
+		s.skipSpace()
+		start := s.pos
+		if ok, _ := s.value(); !ok {
+			return nil, nil, false
+		}
+		if key == VersionKey {
+			version = data[start:s.pos]
+		}
+
+		s.skipSpace()
+		if s.pos >= len(data) {
+			return nil, nil, false
+		}
+		switch data[s.pos] {
+		case ',':
+		case '}':
+			closed = true
+		default:
+			return nil, nil, false
+		}
+		s.pos++
+	}
+
+	s.skipSpace()
+	if s.pos != len(data) {
+		return nil, nil, false
+	}
+	return keys, version, true
+}
+
+// memberValues returns the bounds of the values of the members of the top
+// level object in data whose key, unescaped as encoding/json would, is key.
+// ok is false if data isn't an object or has a syntax error.
+func memberValues(data []byte, key string) (bounds [][2]int, ok bool) {
+	s := scanner{data: data}
+
+	s.skipSpace()
+	if s.pos >= len(data) || data[s.pos] != '{' {
+		return nil, false
+	}
+	s.pos++
+	s.skipSpace()
+	if s.pos < len(data) && data[s.pos] == '}' {
+		return nil, true
+	}
+
+	for {
+		s.skipSpace()
+		if s.pos >= len(data) || data[s.pos] != '"' {
+			return nil, false
+		}
+		k, ok, _ := s.str(true)
+		if !ok {
+			return nil, false
+		}
+
+		s.skipSpace()
+		if s.pos >= len(data) || data[s.pos] != ':' {
+			return nil, false
+		}
+		s.pos++
+		s.skipSpace()
+		start := s.pos
+		if ok, _ := s.value(); !ok {
+			return nil, false
+		}
+		if k == key {
+			bounds = append(bounds, [2]int{start, s.pos})
+		}
+
+		s.skipSpace()
+		if s.pos >= len(data) {
+			return nil, false
+		}
+		switch data[s.pos] {
+		case ',':
+			s.pos++
+		case '}':
+			return bounds, true
+		default:
+			return nil, false
+		}
+	}
+}
+
+// knownKey returns the member of messageKeys spelled by raw, if it isn't in
+// seen. Keys with escapes are never matched.
+func knownKey(raw []byte, seen []string) (string, bool) {
+	for _, k := range messageKeys {
+		if string(raw) != k {
+			continue
+		}
+		for _, s := range seen {
+			if s == k {
+				return "", false
+			}
+		}
+		return k, true
+	}
+
+	return "", false
+}
+
+// enter is called at the start of every array and object.
+func (s *scanner) enter() error {
+	s.depth++
+	if s.limits.MaxDepth > 0 && s.depth > s.limits.MaxDepth {
+		return NestingTooDeep
+	}
+
+	return nil
+}
+
+// element is called with the number of elements seen so far in the current
+// array or object.
+func (s *scanner) element(n int) error {
+	if s.limits.MaxElements > 0 && n > s.limits.MaxElements {
+		return TooManyElements
+	}
+
+	return nil
+}
+
+// The scanner methods return ok == false when they meet a syntax error.
+
+func (s *scanner) skipSpace() {
+	for s.pos < len(s.data) {
+		switch s.data[s.pos] {
+		case ' ', '\t', '\n', '\r':
+			s.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (s *scanner) value() (ok bool, err error) {
+	s.skipSpace()
+	if s.pos >= len(s.data) {
+		return false, nil
+	}
+
+	switch c := s.data[s.pos]; {
+	case c == '{':
+		return s.object()
+	case c == '[':
+		return s.array()
+	case c == '"':
+		_, ok, err = s.str(false)
+		return ok, err
+	default:
+		// Numbers and literals can't hide anything Strict cares about.
+		for s.pos < len(s.data) {
+			switch s.data[s.pos] {
+			case ',', ']', '}', ' ', '\t', '\n', '\r':
+				return true, nil
+			}
+			s.pos++
+		}
+		return true, nil
+	}
+}
+
+func (s *scanner) object() (bool, error) {
+	s.pos++ // skip '{'
+	if err := s.enter(); err != nil {
+		return false, err
+	}
+
+	var keys map[string]struct{}
+	if s.strict {
+		keys = make(map[string]struct{})
+	}
+
+	s.skipSpace()
+	if s.pos < len(s.data) && s.data[s.pos] == '}' {
+		s.pos++
+		s.depth--
+		return true, nil
+	}
+
+	for n := 1; ; n++ {
+		if err := s.element(n); err != nil {
+			return false, err
+		}
+
+		s.skipSpace()
+		if s.pos >= len(s.data) || s.data[s.pos] != '"' {
+			return false, nil
+		}
+		key, ok, err := s.str(s.strict)
+		if !ok || err != nil {
+			return ok, err
+		}
+		if s.strict {
+			if _, dup := keys[key]; dup {
+				return false, DuplicateKey
+			}
+			keys[key] = struct{}{}
+		}
+
+		s.skipSpace()
+		if s.pos >= len(s.data) || s.data[s.pos] != ':' {
+			return false, nil
+		}
+		s.pos++
+
+		if ok, err = s.value(); !ok || err != nil {
+			return ok, err
+		}
+
+		s.skipSpace()
+		if s.pos >= len(s.data) {
+			return false, nil
+		}
+		switch s.data[s.pos] {
+		case ',':
+			s.pos++
+		case '}':
+			s.pos++
+			s.depth--
+			return true, nil
+		default:
+			return false, nil
+		}
+	}
+}
+
+func (s *scanner) array() (bool, error) {
+	s.pos++ // skip '['
+	if err := s.enter(); err != nil {
+		return false, err
+	}
+
+	s.skipSpace()
+	if s.pos < len(s.data) && s.data[s.pos] == ']' {
+		s.pos++
+		s.depth--
+		return true, nil
+	}
+
+	for n := 1; ; n++ {
+		if err := s.element(n); err != nil {
+			return false, err
+		}
+		if s.depth == 1 && s.limits.MaxBatchLength > 0 && n > s.limits.MaxBatchLength {
+			// A top level array is a batch.
+			return false, BatchTooLong
+		}
+
+		if ok, err := s.value(); !ok || err != nil {
+			return ok, err
+		}
+
+		s.skipSpace()
+		if s.pos >= len(s.data) {
+			return false, nil
+		}
+		switch s.data[s.pos] {
+		case ',':
+			s.pos++
+		case ']':
+			s.pos++
+			s.depth--
+			return true, nil
+		default:
+			return false, nil
+		}
+	}
+}
+
+// str scans a string, checking that every \u escape in the surrogate range is
+// part of a valid pair. If decode is true the unescaped string is returned, so
+// that keys which differ only in their escaping compare equal.
+func (s *scanner) str(decode bool) (string, bool, error) {
+	s.pos++ // skip opening quote
+	start := s.pos
+	var buf []byte
+
+	for s.pos < len(s.data) {
+		if s.limits.MaxStringLength > 0 && s.pos-start > s.limits.MaxStringLength {
+			return "", false, StringTooLong
+		}
+
+		c := s.data[s.pos]
+		switch {
+		case c == '"':
+			s.pos++
+			return string(buf), true, nil
+		case c == '\\':
+			if s.pos+1 >= len(s.data) {
+				return "", false, nil
+			}
+			if s.data[s.pos+1] != 'u' {
+				if decode {
+					buf = append(buf, unescapeByte(s.data[s.pos+1]))
+				}
+				s.pos += 2
+				continue
+			}
+
+			r, ok := s.hex4(s.pos + 2)
+			if !ok {
+				return "", false, nil
+			}
+			s.pos += 6
+
+			if utf16.IsSurrogate(r) {
+				// Must be a high surrogate followed by an escaped low surrogate.
+				r2, ok := rune(-1), false
+				if r < 0xdc00 && s.pos+1 < len(s.data) && s.data[s.pos] == '\\' && s.data[s.pos+1] == 'u' {
+					r2, ok = s.hex4(s.pos + 2)
+				}
+				if !ok || utf16.DecodeRune(r, r2) == utf8.RuneError {
+					if !s.strict {
+						// Only Strict cares, and encoding/json accepts it.
+						continue
+					}
+					return "", false, LoneSurrogate
+				}
+				s.pos += 6
+				r = utf16.DecodeRune(r, r2)
+			}
+			if decode {
+				buf = utf8.AppendRune(buf, r)
+			}
+		default:
+			if decode {
+				buf = append(buf, c)
+			}
+			s.pos++
+		}
+	}
+
+	return "", false, nil
+}
+
+func (s *scanner) hex4(at int) (rune, bool) {
+	if at+4 > len(s.data) {
+		return 0, false
+	}
+
+	var r rune
+	for _, c := range s.data[at : at+4] {
+		r <<= 4
+		switch {
+		case '0' <= c && c <= '9':
+			r |= rune(c - '0')
+		case 'a' <= c && c <= 'f':
+			r |= rune(c - 'a' + 10)
+		case 'A' <= c && c <= 'F':
+			r |= rune(c - 'A' + 10)
+		default:
+			return 0, false
+		}
+	}
+
+	return r, true
+}
+
+func unescapeByte(c byte) byte {
+	switch c {
+	case 'b':
+		return '\b'
+	case 'f':
+		return '\f'
+	case 'n':
+		return '\n'
+	case 'r':
+		return '\r'
+	case 't':
+		return '\t'
+	}
+
+	// '"', '\\' and '/' stand for themselves. Anything else is a syntax error
+	// that encoding/json will report.
+	return c
+}
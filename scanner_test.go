@@ -0,0 +1,175 @@
+package gojsonrpc
+
+import "testing"
+
+var testParserStrict = &Parser{Strict: true}
+
+func TestParseIncomingStrictAcceptsValidMessages(t *testing.T) {
+	rawMsgs := []string{
+		`{"jsonrpc":"2.0", "method":"test", "id":1}`,
+		`{"jsonrpc":"2.0", "method":"tést", "params":{"a":1, "b":[{"a":1}, {"a":2}]}, "id":1}`,
+		`{"jsonrpc":"2.0", "method":"test", "params":["😀", "😀", "\"\\\/\b\f\n\r\t"]}`,
+		`{"jsonrpc":"2.0", "result":{}, "id":1}`,
+		`{"jsonrpc":"2.0", "error":{"code":1, "message":"test", "data":[[], {}, null, true, -1.5e3]}, "id":1}`,
+	}
+
+	for _, rawMsg := range rawMsgs {
+		if _, err := testParserStrict.ParseIncoming(rawMsg); err != nil {
+			t.Errorf("%s: unexpected error %v", rawMsg, err)
+		}
+	}
+}
+
+func TestParseIncomingStrictDuplicateKeys(t *testing.T) {
+	rawMsgs := []string{
+		`{"jsonrpc":"2.0", "method":"a", "method":"b", "id":1}`,
+		`{"jsonrpc":"2.0", "method":"a", "\u006dethod":"b", "id":1}`,
+		`{"jsonrpc":"2.0", "method":"a", "params":{"k":1, "k":2}, "id":1}`,
+		`{"jsonrpc":"2.0", "method":"a", "params":[{"k":1}, {"x":{"k":1, "k":2}}], "id":1}`,
+		`{"jsonrpc":"2.0", "error":{"code":1, "code":2, "message":"test"}, "id":1}`,
+	}
+
+	for _, rawMsg := range rawMsgs {
+		if _, err := testParserStrict.ParseIncoming(rawMsg); err != DuplicateKey {
+			t.Errorf("%s: expected %v got %v", rawMsg, DuplicateKey, err)
+		}
+	}
+
+	// Without Strict, the last value wins.
+	msg, err := ParseIncoming(rawMsgs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.(*Request).Method() != "b" {
+		t.Error("expected non-strict parse to keep the last method")
+	}
+}
+
+func TestParseIncomingStrictInvalidUTF8(t *testing.T) {
+	rawMsg := "{\"jsonrpc\":\"2.0\", \"method\":\"te\xffst\", \"id\":1}"
+	if _, err := testParserStrict.ParseIncoming(rawMsg); err != InvalidUTF8 {
+		t.Errorf("expected %v got %v", InvalidUTF8, err)
+	}
+}
+
+func TestParseIncomingStrictLoneSurrogates(t *testing.T) {
+	rawMsgs := []string{
+		`{"jsonrpc":"2.0", "method":"\ud800", "id":1}`,
+		`{"jsonrpc":"2.0", "method":"\udc00", "id":1}`,
+		`{"jsonrpc":"2.0", "method":"\ud800A", "id":1}`,
+		`{"jsonrpc":"2.0", "method":"test", "params":{"\ud800x":1}, "id":1}`,
+	}
+
+	for _, rawMsg := range rawMsgs {
+		if _, err := testParserStrict.ParseIncoming(rawMsg); err != LoneSurrogate {
+			t.Errorf("%s: expected %v got %v", rawMsg, LoneSurrogate, err)
+		}
+	}
+}
+
+func TestParseIncomingStrictSyntaxError(t *testing.T) {
+	rawMsg := `{"jsonrpc":"2.0", "method":"test", "id":1`
+	_, err := testParserStrict.ParseIncoming(rawMsg)
+	if err == nil {
+		t.Fatal("should have returned an error")
+	}
+	if _, ok := err.(ParseError); ok {
+		t.Errorf("expected a syntax error from encoding/json got %v", err)
+	}
+}
+
+func TestParseErrorStrictStrings(t *testing.T) {
+	errs := map[ParseError]string{
+		DuplicateKey:  "gojsonrpc: parse error: DuplicateKey",
+		InvalidUTF8:   "gojsonrpc: parse error: InvalidUTF8",
+		LoneSurrogate: "gojsonrpc: parse error: LoneSurrogate",
+	}
+
+	for e, expected := range errs {
+		if e.Error() != expected {
+			t.Errorf("expected %q got %q", expected, e.Error())
+		}
+	}
+}
+
+func TestParseIncomingLimitsAcceptsMessagesWithinLimits(t *testing.T) {
+	p := &Parser{Limits: &Limits{MaxBytes: 100, MaxDepth: 3, MaxElements: 4, MaxStringLength: 7, MaxBatchLength: 1}}
+	rawMsg := `{"jsonrpc":"2.0", "method":"test", "params":[[1, 2], "abcdefg"], "id":1}`
+	if _, err := p.ParseIncoming(rawMsg); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestParseIncomingLimitsExceeded(t *testing.T) {
+	tests := []struct {
+		limits   Limits
+		rawMsg   string
+		expected ParseError
+	}{
+		{Limits{MaxBytes: 10}, `{"jsonrpc":"2.0", "method":"test", "id":1}`, MessageTooLarge},
+		{Limits{MaxDepth: 2}, `{"jsonrpc":"2.0", "method":"test", "params":[[1]], "id":1}`, NestingTooDeep},
+		{Limits{MaxDepth: 2}, `{"jsonrpc":"2.0", "method":"test", "params":[{}], "id":1}`, NestingTooDeep},
+		{Limits{MaxElements: 3}, `{"jsonrpc":"2.0", "method":"test", "params":[1, 2, 3, 4], "id":1}`, TooManyElements},
+		{Limits{MaxElements: 3}, `{"jsonrpc":"2.0", "method":"test", "params":{"a":1}, "id":1}`, TooManyElements},
+		{Limits{MaxStringLength: 7}, `{"jsonrpc":"2.0", "method":"testtest", "id":1}`, StringTooLong},
+		{Limits{MaxStringLength: 7}, `{"jsonrpc":"2.0", "method":"test", "params":{"abcdefgh":1}, "id":1}`, StringTooLong},
+		{Limits{MaxBatchLength: 2}, `[{"jsonrpc":"2.0", "method":"a"}, {"jsonrpc":"2.0", "method":"b"}, {"jsonrpc":"2.0", "method":"c"}]`, BatchTooLong},
+	}
+
+	for _, test := range tests {
+		limits := test.limits
+		p := &Parser{Limits: &limits}
+		if _, err := p.ParseIncoming(test.rawMsg); err != test.expected {
+			t.Errorf("%s: expected %v got %v", test.rawMsg, test.expected, err)
+		}
+	}
+}
+
+func TestParseIncomingLimitsDoNotEnableStrict(t *testing.T) {
+	p := &Parser{Limits: &DefaultLimits}
+	rawMsg := `{"jsonrpc":"2.0", "method":"\ud800", "params":{"k":1, "k":2}, "id":1}`
+	if _, err := p.ParseIncoming(rawMsg); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestParseIncomingDefaultLimitsDeepNesting(t *testing.T) {
+	p := &Parser{Limits: &DefaultLimits}
+	params := ""
+	for i := 0; i < 100; i++ {
+		params += "["
+	}
+	rawMsg := `{"jsonrpc":"2.0", "method":"test", "params":` + params + `}`
+	if _, err := p.ParseIncoming(rawMsg); err != NestingTooDeep {
+		t.Errorf("expected %v got %v", NestingTooDeep, err)
+	}
+}
+
+func TestScanMessageKeys(t *testing.T) {
+	tests := []struct {
+		rawMsg  string
+		keys    int
+		version string
+		ok      bool
+	}{
+		{`{"jsonrpc":"2.0","method":"test","params":[1,{"id":2}],"id":1}`, 4, `"2.0"`, true},
+		{` { "jsonrpc" : "1.0" , "result" : null } `, 2, `"1.0"`, true},
+		{`{}`, 0, "", true},
+		{`{"jsonrpc":"2.0","method":"a","method":"b"}`, 0, "", false},
+		{`{"jsonrpc":"2.0","\u006dethod":"a"}`, 0, "", false},
+		{`{"jsonrpc":"2.0","Method":"a"}`, 0, "", false},
+		{`{"jsonrpc":"2.0","other":1}`, 0, "", false},
+		{`{"jsonrpc":"2.0"} {}`, 0, "", false},
+		{`{"jsonrpc":"2.0",}`, 0, "", false},
+		{`{"jsonrpc":"2.0"`, 0, "", false},
+		{`[]`, 0, "", false},
+	}
+
+	for _, test := range tests {
+		var buf [len(messageKeys)]string
+		keys, version, ok := scanMessageKeys([]byte(test.rawMsg), &buf)
+		if ok != test.ok || len(keys) != test.keys || string(version) != test.version {
+			t.Errorf("%s: expected %d keys, %s, %t got %v, %s, %t", test.rawMsg, test.keys, test.version, test.ok, keys, version, ok)
+		}
+	}
+}
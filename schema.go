@@ -0,0 +1,623 @@
+package gojsonrpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Schema is a compiled JSON Schema. The following draft 2020-12 keywords are
+// supported:
+//
+//   - type, enum, const;
+//   - multipleOf, maximum, exclusiveMaximum, minimum, exclusiveMinimum;
+//   - maxLength, minLength, pattern (using Go's regexp syntax);
+//   - prefixItems, items, maxItems, minItems, uniqueItems;
+//   - properties, patternProperties, additionalProperties, required,
+//     maxProperties, minProperties;
+//   - allOf, anyOf, oneOf, not;
+//   - $ref to "#" followed by a JSON pointer within the same document, e.g.
+//     "#/$defs/name".
+//
+// Other keywords, such as title, description and format, are ignored.
+type Schema struct {
+	always *bool // Set for the boolean schemas true and false.
+
+	types    []string
+	enum     []interface{}
+	constVal interface{}
+	hasConst bool
+
+	multipleOf, maximum, exclusiveMaximum, minimum, exclusiveMinimum *big.Rat
+
+	maxLength, minLength int
+	pattern              *regexp.Regexp
+
+	prefixItems        []*Schema
+	items              *Schema
+	maxItems, minItems int
+	uniqueItems        bool
+
+	properties           map[string]*Schema
+	patternProperties    map[string]*Schema
+	patternRegexps       map[string]*regexp.Regexp
+	additionalProperties *Schema
+	required             []string
+	maxProperties        int
+	minProperties        int
+
+	allOf, anyOf, oneOf []*Schema
+	not                 *Schema
+
+	ref       string
+	refSchema *Schema
+}
+
+// SchemaViolation describes one way in which a value doesn't match a Schema.
+type SchemaViolation struct {
+	// InstanceLocation is a JSON pointer to the part of the value that
+	// doesn't match, "" for the value itself.
+	InstanceLocation string `json:"instanceLocation"`
+	// KeywordLocation is a JSON pointer to the schema keyword that failed.
+	KeywordLocation string `json:"keywordLocation"`
+	Message         string `json:"message"`
+}
+
+// CompileSchema parses a JSON Schema. References that loop back to a schema
+// without descending into the value, such as {"$ref":"#"}, are rejected, as
+// validation would never end.
+func CompileSchema(data []byte) (*Schema, error) {
+	root, err := unmarshalUseNumber(data)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &schemaCompiler{byPointer: make(map[string]*Schema)}
+	s, err := c.compile(root, "")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range c.refs {
+		if !strings.HasPrefix(r.ref, "#") {
+			return nil, fmt.Errorf("schema $ref %q: only local references are supported", r.ref)
+		}
+		pointer, err := url.PathUnescape(r.ref[1:])
+		if err != nil {
+			return nil, fmt.Errorf("schema $ref %q: %v", r.ref, err)
+		}
+		if r.refSchema = c.byPointer[pointer]; r.refSchema == nil {
+			return nil, fmt.Errorf("schema $ref %q: no schema at that location", r.ref)
+		}
+	}
+
+	done := make(map[*Schema]bool)
+	for _, r := range c.refs {
+		if inPlaceCycle(r, make(map[*Schema]bool), done) {
+			return nil, fmt.Errorf("schema $ref %q: the reference loops back without descending into the value", r.ref)
+		}
+	}
+
+	return s, nil
+}
+
+type schemaCompiler struct {
+	byPointer map[string]*Schema
+	refs      []*Schema
+}
+
+// inPlaceCycle reports whether s can be reached again from s through $ref,
+// allOf, anyOf, oneOf and not, which apply to the same value, so that
+// validating it would never end. Schemas in done are known not to loop.
+func inPlaceCycle(s *Schema, visiting, done map[*Schema]bool) bool {
+	if done[s] {
+		return false
+	}
+	if visiting[s] {
+		return true
+	}
+	visiting[s] = true
+
+	subs := append(append(append([]*Schema{s.refSchema, s.not}, s.allOf...), s.anyOf...), s.oneOf...)
+	for _, sub := range subs {
+		if sub != nil && inPlaceCycle(sub, visiting, done) {
+			return true
+		}
+	}
+
+	done[s] = true
+	return false
+}
+
+func (c *schemaCompiler) compile(node interface{}, pointer string) (*Schema, error) {
+	s := &Schema{maxLength: -1, maxItems: -1, maxProperties: -1}
+	c.byPointer[pointer] = s
+
+	if b, ok := node.(bool); ok {
+		s.always = &b
+		return s, nil
+	}
+	m, ok := node.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("schema at %q: must be an object or a boolean", pointer)
+	}
+
+	var err error
+	fail := func(keyword, reason string) error {
+		return fmt.Errorf("schema at %q: %s %s", pointer+"/"+keyword, keyword, reason)
+	}
+	sub := func(keyword string, v interface{}) (*Schema, error) {
+		return c.compile(v, pointer+"/"+escapeJSONPointer(keyword))
+	}
+	subList := func(keyword string, v interface{}) ([]*Schema, error) {
+		list, ok := v.([]interface{})
+		if !ok || len(list) == 0 {
+			return nil, fail(keyword, "must be a non-empty array")
+		}
+		schemas := make([]*Schema, len(list))
+		for i, elem := range list {
+			p := pointer + "/" + escapeJSONPointer(keyword) + "/" + strconv.Itoa(i)
+			if schemas[i], err = c.compile(elem, p); err != nil {
+				return nil, err
+			}
+		}
+		return schemas, nil
+	}
+	subMap := func(keyword string, v interface{}) (map[string]*Schema, error) {
+		members, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fail(keyword, "must be an object")
+		}
+		schemas := make(map[string]*Schema, len(members))
+		for name, elem := range members {
+			p := pointer + "/" + escapeJSONPointer(keyword) + "/" + escapeJSONPointer(name)
+			if schemas[name], err = c.compile(elem, p); err != nil {
+				return nil, err
+			}
+		}
+		return schemas, nil
+	}
+	number := func(keyword string, v interface{}) (*big.Rat, error) {
+		if n, ok := v.(json.Number); ok {
+			if r, ok := new(big.Rat).SetString(string(n)); ok {
+				return r, nil
+			}
+		}
+		return nil, fail(keyword, "must be a number")
+	}
+	count := func(keyword string, v interface{}) (int, error) {
+		r, err := number(keyword, v)
+		if err != nil || !r.IsInt() || r.Sign() < 0 || !r.Num().IsInt64() {
+			return 0, fail(keyword, "must be a non-negative integer")
+		}
+		return int(r.Num().Int64()), nil
+	}
+
+	// Compile keywords in a fixed order, so that errors are deterministic.
+	for _, keyword := range sortedKeys(m) {
+		v := m[keyword]
+		switch keyword {
+		case "type":
+			switch t := v.(type) {
+			case string:
+				s.types = []string{t}
+			case []interface{}:
+				for _, elem := range t {
+					name, ok := elem.(string)
+					if !ok {
+						return nil, fail(keyword, "must be a string or an array of strings")
+					}
+					s.types = append(s.types, name)
+				}
+			default:
+				return nil, fail(keyword, "must be a string or an array of strings")
+			}
+			for _, name := range s.types {
+				switch name {
+				case "null", "boolean", "object", "array", "number", "integer", "string":
+				default:
+					return nil, fail(keyword, fmt.Sprintf("has unknown type %q", name))
+				}
+			}
+		case "enum":
+			list, ok := v.([]interface{})
+			if !ok {
+				return nil, fail(keyword, "must be an array")
+			}
+			s.enum = list
+		case "const":
+			s.constVal, s.hasConst = v, true
+		case "multipleOf":
+			s.multipleOf, err = number(keyword, v)
+			if err == nil && s.multipleOf.Sign() <= 0 {
+				err = fail(keyword, "must be greater than 0")
+			}
+		case "maximum":
+			s.maximum, err = number(keyword, v)
+		case "exclusiveMaximum":
+			s.exclusiveMaximum, err = number(keyword, v)
+		case "minimum":
+			s.minimum, err = number(keyword, v)
+		case "exclusiveMinimum":
+			s.exclusiveMinimum, err = number(keyword, v)
+		case "maxLength":
+			s.maxLength, err = count(keyword, v)
+		case "minLength":
+			s.minLength, err = count(keyword, v)
+		case "pattern":
+			pattern, ok := v.(string)
+			if !ok {
+				return nil, fail(keyword, "must be a string")
+			}
+			if s.pattern, err = regexp.Compile(pattern); err != nil {
+				return nil, fail(keyword, err.Error())
+			}
+		case "prefixItems":
+			s.prefixItems, err = subList(keyword, v)
+		case "items":
+			s.items, err = sub(keyword, v)
+		case "maxItems":
+			s.maxItems, err = count(keyword, v)
+		case "minItems":
+			s.minItems, err = count(keyword, v)
+		case "uniqueItems":
+			s.uniqueItems, ok = v.(bool)
+			if !ok {
+				err = fail(keyword, "must be a boolean")
+			}
+		case "properties":
+			s.properties, err = subMap(keyword, v)
+		case "patternProperties":
+			if s.patternProperties, err = subMap(keyword, v); err != nil {
+				break
+			}
+			s.patternRegexps = make(map[string]*regexp.Regexp, len(s.patternProperties))
+			for pattern := range s.patternProperties {
+				if s.patternRegexps[pattern], err = regexp.Compile(pattern); err != nil {
+					return nil, fail(keyword, err.Error())
+				}
+			}
+		case "additionalProperties":
+			s.additionalProperties, err = sub(keyword, v)
+		case "required":
+			list, ok := v.([]interface{})
+			if !ok {
+				return nil, fail(keyword, "must be an array of strings")
+			}
+			for _, elem := range list {
+				name, ok := elem.(string)
+				if !ok {
+					return nil, fail(keyword, "must be an array of strings")
+				}
+				s.required = append(s.required, name)
+			}
+		case "maxProperties":
+			s.maxProperties, err = count(keyword, v)
+		case "minProperties":
+			s.minProperties, err = count(keyword, v)
+		case "allOf":
+			s.allOf, err = subList(keyword, v)
+		case "anyOf":
+			s.anyOf, err = subList(keyword, v)
+		case "oneOf":
+			s.oneOf, err = subList(keyword, v)
+		case "not":
+			s.not, err = sub(keyword, v)
+		case "$ref":
+			if s.ref, ok = v.(string); !ok {
+				return nil, fail(keyword, "must be a string")
+			}
+			c.refs = append(c.refs, s)
+		case "$defs":
+			_, err = subMap(keyword, v)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+func escapeJSONPointer(s string) string {
+	return strings.Replace(strings.Replace(s, "~", "~0", -1), "/", "~1", -1)
+}
+
+// Validate checks v against s. v is first converted to its JSON
+// representation, so any value that json.Marshal accepts can be validated. It
+// returns nil if v matches.
+func (s *Schema) Validate(v interface{}) []SchemaViolation {
+	raw, err := json.Marshal(v)
+	if err == nil {
+		v, err = unmarshalUseNumber(raw)
+	}
+	if err != nil {
+		return []SchemaViolation{{Message: err.Error()}}
+	}
+
+	var violations []SchemaViolation
+	s.validate(v, "", "", &violations)
+	return violations
+}
+
+// matches reports whether v, which must already be in its JSON
+// representation, matches s.
+func (s *Schema) matches(v interface{}) bool {
+	var violations []SchemaViolation
+	s.validate(v, "", "", &violations)
+	return len(violations) == 0
+}
+
+func (s *Schema) validate(v interface{}, instance, keyword string, violations *[]SchemaViolation) {
+	fail := func(name, format string, args ...interface{}) {
+		*violations = append(*violations, SchemaViolation{
+			InstanceLocation: instance,
+			KeywordLocation:  keyword + "/" + name,
+			Message:          fmt.Sprintf(format, args...),
+		})
+	}
+
+	if s.always != nil {
+		if !*s.always {
+			*violations = append(*violations, SchemaViolation{
+				InstanceLocation: instance,
+				KeywordLocation:  keyword,
+				Message:          "no value is allowed",
+			})
+		}
+		return
+	}
+
+	if s.refSchema != nil {
+		s.refSchema.validate(v, instance, keyword+"/$ref", violations)
+	}
+
+	if len(s.types) > 0 && !jsonTypeMatches(v, s.types) {
+		fail("type", "expected %s, got %s", strings.Join(s.types, " or "), jsonType(v))
+	}
+	if s.enum != nil {
+		found := false
+		for _, allowed := range s.enum {
+			if jsonEqual(v, allowed) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fail("enum", "value is not one of the allowed values")
+		}
+	}
+	if s.hasConst && !jsonEqual(v, s.constVal) {
+		fail("const", "value is not the allowed value")
+	}
+
+	switch v := v.(type) {
+	case json.Number:
+		s.validateNumber(v, fail)
+	case string:
+		n := utf8.RuneCountInString(v)
+		if s.maxLength >= 0 && n > s.maxLength {
+			fail("maxLength", "string is longer than %d characters", s.maxLength)
+		}
+		if n < s.minLength {
+			fail("minLength", "string is shorter than %d characters", s.minLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			fail("pattern", "string doesn't match %q", s.pattern)
+		}
+	case []interface{}:
+		s.validateArray(v, instance, keyword, violations, fail)
+	case map[string]interface{}:
+		s.validateObject(v, instance, keyword, violations, fail)
+	}
+
+	for i, sub := range s.allOf {
+		sub.validate(v, instance, keyword+"/allOf/"+strconv.Itoa(i), violations)
+	}
+	if s.anyOf != nil {
+		matched := false
+		for _, sub := range s.anyOf {
+			if sub.matches(v) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			fail("anyOf", "value doesn't match any of the schemas")
+		}
+	}
+	if s.oneOf != nil {
+		matched := 0
+		for _, sub := range s.oneOf {
+			if sub.matches(v) {
+				matched++
+			}
+		}
+		if matched != 1 {
+			fail("oneOf", "value matches %d of the schemas, expected exactly 1", matched)
+		}
+	}
+	if s.not != nil && s.not.matches(v) {
+		fail("not", "value matches a schema it must not match")
+	}
+}
+
+func (s *Schema) validateNumber(n json.Number, fail func(string, string, ...interface{})) {
+	r, ok := new(big.Rat).SetString(string(n))
+	if !ok {
+		fail("type", "invalid number %s", n)
+		return
+	}
+
+	if s.multipleOf != nil && !new(big.Rat).Quo(r, s.multipleOf).IsInt() {
+		fail("multipleOf", "%s is not a multiple of %s", n, s.multipleOf.RatString())
+	}
+	if s.maximum != nil && r.Cmp(s.maximum) > 0 {
+		fail("maximum", "%s is greater than %s", n, s.maximum.RatString())
+	}
+	if s.exclusiveMaximum != nil && r.Cmp(s.exclusiveMaximum) >= 0 {
+		fail("exclusiveMaximum", "%s is not less than %s", n, s.exclusiveMaximum.RatString())
+	}
+	if s.minimum != nil && r.Cmp(s.minimum) < 0 {
+		fail("minimum", "%s is less than %s", n, s.minimum.RatString())
+	}
+	if s.exclusiveMinimum != nil && r.Cmp(s.exclusiveMinimum) <= 0 {
+		fail("exclusiveMinimum", "%s is not greater than %s", n, s.exclusiveMinimum.RatString())
+	}
+}
+
+func (s *Schema) validateArray(a []interface{}, instance, keyword string, violations *[]SchemaViolation, fail func(string, string, ...interface{})) {
+	if s.maxItems >= 0 && len(a) > s.maxItems {
+		fail("maxItems", "array has more than %d items", s.maxItems)
+	}
+	if len(a) < s.minItems {
+		fail("minItems", "array has fewer than %d items", s.minItems)
+	}
+	if s.uniqueItems {
+	unique:
+		for i := range a {
+			for j := i + 1; j < len(a); j++ {
+				if jsonEqual(a[i], a[j]) {
+					fail("uniqueItems", "items %d and %d are equal", i, j)
+					break unique
+				}
+			}
+		}
+	}
+
+	for i, elem := range a {
+		location := instance + "/" + strconv.Itoa(i)
+		if i < len(s.prefixItems) {
+			s.prefixItems[i].validate(elem, location, keyword+"/prefixItems/"+strconv.Itoa(i), violations)
+		} else if s.items != nil {
+			s.items.validate(elem, location, keyword+"/items", violations)
+		}
+	}
+}
+
+func (s *Schema) validateObject(o map[string]interface{}, instance, keyword string, violations *[]SchemaViolation, fail func(string, string, ...interface{})) {
+	if s.maxProperties >= 0 && len(o) > s.maxProperties {
+		fail("maxProperties", "object has more than %d properties", s.maxProperties)
+	}
+	if len(o) < s.minProperties {
+		fail("minProperties", "object has fewer than %d properties", s.minProperties)
+	}
+	for _, name := range s.required {
+		if _, ok := o[name]; !ok {
+			fail("required", "missing property %q", name)
+		}
+	}
+
+	// Visit properties and patterns in order, so that violations are
+	// deterministic.
+	patterns := make([]string, 0, len(s.patternRegexps))
+	for pattern := range s.patternRegexps {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+
+	for _, name := range sortedKeys(o) {
+		location := instance + "/" + escapeJSONPointer(name)
+		matched := false
+
+		if sub, ok := s.properties[name]; ok {
+			matched = true
+			sub.validate(o[name], location, keyword+"/properties/"+escapeJSONPointer(name), violations)
+		}
+
+		for _, pattern := range patterns {
+			if s.patternRegexps[pattern].MatchString(name) {
+				matched = true
+				s.patternProperties[pattern].validate(o[name], location, keyword+"/patternProperties/"+escapeJSONPointer(pattern), violations)
+			}
+		}
+
+		if !matched && s.additionalProperties != nil {
+			s.additionalProperties.validate(o[name], location, keyword+"/additionalProperties", violations)
+		}
+	}
+}
+
+// jsonType returns the JSON Schema type of v, which must be in its JSON
+// representation.
+func jsonType(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+
+	return fmt.Sprintf("%T", v)
+}
+
+func jsonTypeMatches(v interface{}, types []string) bool {
+	actual := jsonType(v)
+	for _, t := range types {
+		if t == actual {
+			return true
+		}
+		if t == "integer" && actual == "number" {
+			// Any number with a zero fractional part, including 1.0.
+			if r, ok := new(big.Rat).SetString(string(v.(json.Number))); ok && r.IsInt() {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// jsonEqual reports whether a and b, which must be in their JSON
+// representation, are equal. Numbers are compared by value.
+func jsonEqual(a, b interface{}) bool {
+	switch a := a.(type) {
+	case json.Number:
+		bn, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		ar, aok := new(big.Rat).SetString(string(a))
+		br, bok := new(big.Rat).SetString(string(bn))
+		return aok && bok && ar.Cmp(br) == 0
+	case []interface{}:
+		ba, ok := b.([]interface{})
+		if !ok || len(a) != len(ba) {
+			return false
+		}
+		for i := range a {
+			if !jsonEqual(a[i], ba[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		bm, ok := b.(map[string]interface{})
+		if !ok || len(a) != len(bm) {
+			return false
+		}
+		for k, av := range a {
+			bv, ok := bm[k]
+			if !ok || !jsonEqual(av, bv) {
+				return false
+			}
+		}
+		return true
+	}
+
+	return a == b
+}
@@ -0,0 +1,160 @@
+package gojsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func testCompileSchema(t *testing.T, schema string) *Schema {
+	s, err := CompileSchema([]byte(schema))
+	if err != nil {
+		t.Fatalf("%s: %v", schema, err)
+	}
+	return s
+}
+
+func TestSchemaValidate(t *testing.T) {
+	tests := []struct {
+		schema  string
+		valid   []string
+		invalid []string
+	}{
+		{`true`, []string{`null`, `1`, `{}`}, nil},
+		{`false`, nil, []string{`null`, `1`, `{}`}},
+		{`{}`, []string{`null`, `"a"`, `[1]`}, nil},
+		{`{"type":"integer"}`, []string{`1`, `1.0`, `-5`, `1e3`}, []string{`1.5`, `"1"`, `null`}},
+		{`{"type":["string","null"]}`, []string{`"a"`, `null`}, []string{`1`, `false`}},
+		{`{"enum":[1,"a",[true]]}`, []string{`1.0`, `"a"`, `[true]`}, []string{`2`, `"b"`, `[false]`}},
+		{`{"const":{"a":1}}`, []string{`{"a":1}`, `{"a":1.00}`}, []string{`{"a":2}`, `{}`}},
+		{`{"minimum":1,"exclusiveMaximum":3}`, []string{`1`, `2.9`, `"x"`}, []string{`0.9`, `3`}},
+		{`{"exclusiveMinimum":0,"maximum":1}`, []string{`0.1`, `1`}, []string{`0`, `1.1`}},
+		{`{"multipleOf":0.1}`, []string{`0.3`, `10`}, []string{`0.35`}},
+		{`{"minLength":2,"maxLength":3}`, []string{`"ab"`, `"éé"`, `"abc"`}, []string{`"a"`, `"abcd"`}},
+		{`{"pattern":"^a+$"}`, []string{`"aaa"`, `1`}, []string{`"ab"`}},
+		{`{"prefixItems":[{"type":"string"}],"items":{"type":"integer"}}`, []string{`[]`, `["a"]`, `["a",1,2]`}, []string{`[1]`, `["a","b"]`}},
+		{`{"items":false,"prefixItems":[true]}`, []string{`[1]`}, []string{`[1,2]`}},
+		{`{"minItems":1,"maxItems":2,"uniqueItems":true}`, []string{`[1]`, `[1,"1"]`}, []string{`[]`, `[1,2,3]`, `[1,1.0]`, `[{"a":[1]},{"a":[1]}]`}},
+		{`{"properties":{"a":{"type":"string"}},"required":["a"]}`, []string{`{"a":"x"}`, `{"a":"x","b":1}`, `[]`}, []string{`{}`, `{"a":1}`}},
+		{`{"properties":{"a":true},"patternProperties":{"^x-":{"type":"integer"}},"additionalProperties":false}`, []string{`{"a":1,"x-b":2}`}, []string{`{"b":1}`, `{"x-b":"c"}`}},
+		{`{"minProperties":1,"maxProperties":1}`, []string{`{"a":1}`}, []string{`{}`, `{"a":1,"b":2}`}},
+		{`{"allOf":[{"type":"number"},{"minimum":2}]}`, []string{`2`}, []string{`1`, `"a"`}},
+		{`{"anyOf":[{"type":"string"},{"minimum":2}]}`, []string{`"a"`, `3`}, []string{`1`}},
+		{`{"oneOf":[{"type":"integer"},{"minimum":2}]}`, []string{`1`, `2.5`}, []string{`3`, `1.5`}},
+		{`{"not":{"type":"null"}}`, []string{`1`}, []string{`null`}},
+		{`{"$defs":{"pos":{"minimum":0}},"items":{"$ref":"#/$defs/pos"}}`, []string{`[0,1]`}, []string{`[-1]`}},
+		{`{"type":"object","properties":{"next":{"$ref":"#"}},"additionalProperties":false}`, []string{`{"next":{"next":{}}}`}, []string{`{"next":{"x":1}}`, `{"next":1}`}},
+		{`{"$defs":{"a":{"$ref":"#/$defs/b"},"b":{"minimum":0}},"allOf":[{"$ref":"#/$defs/a"},{"$ref":"#/$defs/b"}]}`, []string{`0`}, []string{`-1`}},
+		{`{"$defs":{"a/b":{"type":"string"}},"$ref":"#/$defs/a~1b","title":"ignored","format":"email"}`, []string{`"x"`}, []string{`1`}},
+	}
+
+	for _, test := range tests {
+		s := testCompileSchema(t, test.schema)
+		for _, v := range test.valid {
+			if violations := s.Validate(json.RawMessage(v)); violations != nil {
+				t.Errorf("%s: %s should be valid, got %v", test.schema, v, violations)
+			}
+		}
+		for _, v := range test.invalid {
+			if violations := s.Validate(json.RawMessage(v)); violations == nil {
+				t.Errorf("%s: %s should be invalid", test.schema, v)
+			}
+		}
+	}
+}
+
+func TestSchemaViolations(t *testing.T) {
+	s := testCompileSchema(t, `{
+		"type": "object",
+		"properties": {
+			"name": {"type": "string"},
+			"tags": {"items": {"maxLength": 3}}
+		},
+		"required": ["name", "age"]
+	}`)
+
+	violations := s.Validate(map[string]interface{}{
+		"name": 1,
+		"tags": []string{"ok", "too long"},
+	})
+	expected := []SchemaViolation{
+		{"", "/required", `missing property "age"`},
+		{"/name", "/properties/name/type", "expected string, got number"},
+		{"/tags/1", "/properties/tags/items/maxLength", "string is longer than 3 characters"},
+	}
+	if !reflect.DeepEqual(violations, expected) {
+		t.Errorf("expected %v got %v", expected, violations)
+	}
+}
+
+func TestCompileSchemaErrors(t *testing.T) {
+	schemas := []string{
+		`{`,
+		`1`,
+		`{"type":"float"}`,
+		`{"type":1}`,
+		`{"minLength":-1}`,
+		`{"maxItems":1.5}`,
+		`{"multipleOf":0}`,
+		`{"minimum":"1"}`,
+		`{"pattern":"("}`,
+		`{"properties":[]}`,
+		`{"allOf":[]}`,
+		`{"items":1}`,
+		`{"required":[1]}`,
+		`{"$ref":"#/$defs/missing"}`,
+		`{"$ref":"other.json"}`,
+		`{"$ref":"#"}`,
+		`{"anyOf":[{"type":"string"},{"not":{"$ref":"#"}}]}`,
+		`{"$defs":{"a":{"$ref":"#/$defs/b"},"b":{"allOf":[{"$ref":"#/$defs/a"}]}},"items":{"$ref":"#/$defs/a"}}`,
+	}
+
+	for _, schema := range schemas {
+		if _, err := CompileSchema([]byte(schema)); err == nil {
+			t.Errorf("%s should have failed to compile", schema)
+		}
+	}
+}
+
+func TestDispatcherSchema(t *testing.T) {
+	d := testDispatcher()
+	d.RegisterSchema("echo", MethodSchema{
+		Params: testCompileSchema(t, `{"type":"array","prefixItems":[{"type":"integer"}],"maxItems":1}`),
+		Result: testCompileSchema(t, `{"type":"array","items":{"minimum":0}}`),
+	})
+
+	testDispatch(t, d,
+		`{"jsonrpc":"2.0", "method":"echo", "params":[-1], "id":1}`,
+		`{"jsonrpc":"2.0","result":[-1],"id":1}`)
+	testDispatch(t, d,
+		`{"jsonrpc":"2.0", "method":"echo", "params":["a", 2], "id":2}`,
+		`{"jsonrpc":"2.0","error":{"code":-32602,"message":"Invalid params","data":[`+
+			`{"instanceLocation":"","keywordLocation":"/maxItems","message":"array has more than 1 items"},`+
+			`{"instanceLocation":"/0","keywordLocation":"/prefixItems/0/type","message":"expected integer, got string"}]},"id":2}`)
+	testDispatch(t, d,
+		`{"jsonrpc":"2.0", "method":"echo", "id":3}`,
+		`{"jsonrpc":"2.0","error":{"code":-32602,"message":"Invalid params","data":[`+
+			`{"instanceLocation":"","keywordLocation":"/type","message":"expected array, got null"}]},"id":3}`)
+
+	d.ValidateResults = true
+	testDispatch(t, d,
+		`{"jsonrpc":"2.0", "method":"echo", "params":[-1], "id":4}`,
+		`{"jsonrpc":"2.0","error":{"code":-32603,"message":"Invalid result","data":[`+
+			`{"instanceLocation":"/0","keywordLocation":"/items/minimum","message":"-1 is less than 0"}]},"id":4}`)
+
+	called := false
+	d.Register("notify", func(ctx context.Context, params interface{}) (interface{}, *Error) {
+		called = true
+		return nil, nil
+	})
+	d.RegisterSchema("notify", MethodSchema{Params: testCompileSchema(t, `{"type":"object"}`)})
+	testDispatch(t, d, `{"jsonrpc":"2.0", "method":"notify", "params":[]}`, "")
+	if called {
+		t.Error("notification with invalid params should not reach the handler")
+	}
+	testDispatch(t, d, `{"jsonrpc":"2.0", "method":"notify", "params":{}}`, "")
+	if !called {
+		t.Error("notification with valid params should reach the handler")
+	}
+}
@@ -0,0 +1,399 @@
+package gojsonrpc
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// ErrServerClosed is returned by Server.Serve after Shutdown or Close.
+var ErrServerClosed = errors.New("gojsonrpc: server closed")
+
+// DefaultMaxHandlers is the number of messages a Server handles at once on
+// each connection when Server.MaxHandlers is zero.
+const DefaultMaxHandlers = 64
+
+// DefaultWriteTimeout is how long a Server waits for a message to be written
+// to a connection when Server.WriteTimeout is zero.
+const DefaultWriteTimeout = 30 * time.Second
+
+// Server answers JSON-RPC messages received on stream connections, such as
+// TCP or Unix domain sockets, using a Dispatcher. Each message, or batch, is
+// handled in its own goroutine, so replies may be sent out of order. Handlers
+// can send messages of their own on the connection with PeerFromContext.
+//
+// A handler that panics is answered with a CodeInternalError error, and
+// doesn't bring the server down.
+type Server struct {
+	// Dispatcher handles the messages received.
+	Dispatcher *Dispatcher
+	// Framing is how messages are delimited on the connections.
+	Framing Framing
+	// MaxHandlers is the number of messages handled at once on each
+	// connection. Once it is reached, the connection isn't read until a
+	// handler returns. If zero, DefaultMaxHandlers is used.
+	MaxHandlers int
+	// WriteTimeout is how long writing a message to a connection may take.
+	// A connection that times out, such as a client that stopped reading, is
+	// closed. If zero, DefaultWriteTimeout is used; if negative, writes never
+	// time out.
+	WriteTimeout time.Duration
+	// OnConnect, if set, is called for each connection accepted, before any
+	// message is read from it.
+	OnConnect func(conn net.Conn)
+	// OnDisconnect, if set, is called for each connection once it is closed
+	// and all of its handlers have returned. err is the error that ended the
+	// connection, or nil if it was closed by the client or by Shutdown.
+	OnDisconnect func(conn net.Conn, err error)
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[*serverConn]struct{}
+	closed    bool
+}
+
+// Serve accepts connections on l and answers them using d, until l fails.
+func Serve(l net.Listener, d *Dispatcher) error {
+	s := &Server{Dispatcher: d}
+	return s.Serve(l)
+}
+
+type connContextKey struct{}
+
+// ConnFromContext returns the connection a message was received on, from the
+// context passed to handlers by a Server.
+func ConnFromContext(ctx context.Context) (net.Conn, bool) {
+	conn, ok := ctx.Value(connContextKey{}).(net.Conn)
+	return conn, ok
+}
+
+// serverConn is a connection accepted by a Server. It is the Peer of the
+// messages received on it.
+type serverConn struct {
+	conn         net.Conn
+	framing      Framing
+	writeTimeout time.Duration
+	ctx          context.Context
+	cancel       context.CancelFunc
+
+	wmu sync.Mutex
+	w   *bufio.Writer
+}
+
+// Serve accepts connections on l, serving each in its own goroutine. It always
+// returns a non-nil error, which is ErrServerClosed after Shutdown or Close.
+func (s *Server) Serve(l net.Listener) error {
+	if !s.trackListener(l, true) {
+		return ErrServerClosed
+	}
+	defer s.trackListener(l, false)
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if s.isClosed() {
+				return ErrServerClosed
+			}
+			return err
+		}
+
+		c := s.newConn(conn)
+		if c == nil {
+			conn.Close()
+			return ErrServerClosed
+		}
+		go s.serveConn(c)
+	}
+}
+
+// ServeConn serves a single connection, returning once it is closed. It can
+// be used for connections that don't come from a listener.
+func (s *Server) ServeConn(conn net.Conn) {
+	c := s.newConn(conn)
+	if c == nil {
+		conn.Close()
+		return
+	}
+	s.serveConn(c)
+}
+
+func (s *Server) trackListener(l net.Listener, add bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !add {
+		delete(s.listeners, l)
+		return true
+	}
+	if s.closed {
+		return false
+	}
+	if s.listeners == nil {
+		s.listeners = make(map[net.Listener]struct{})
+	}
+	s.listeners[l] = struct{}{}
+	return true
+}
+
+func (s *Server) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.closed
+}
+
+// newConn registers conn, returning nil if the server is closed.
+func (s *Server) newConn(conn net.Conn) *serverConn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil
+	}
+
+	c := &serverConn{conn: conn, framing: s.Framing, writeTimeout: s.WriteTimeout, w: bufio.NewWriter(conn)}
+	if c.writeTimeout == 0 {
+		c.writeTimeout = DefaultWriteTimeout
+	}
+	c.ctx, c.cancel = context.WithCancel(ContextWithPeer(context.WithValue(context.Background(), connContextKey{}, conn), c))
+	if s.conns == nil {
+		s.conns = make(map[*serverConn]struct{})
+	}
+	s.conns[c] = struct{}{}
+	return c
+}
+
+func (s *Server) serveConn(c *serverConn) {
+	if s.OnConnect != nil {
+		s.OnConnect(c.conn)
+	}
+
+	d := s.Dispatcher
+	if d == nil {
+		d = new(Dispatcher)
+	}
+
+	maxBytes := 0
+	if d.Parser.Limits != nil {
+		maxBytes = d.Parser.Limits.MaxBytes
+	}
+
+	maxHandlers := s.MaxHandlers
+	if maxHandlers <= 0 {
+		maxHandlers = DefaultMaxHandlers
+	}
+	running := make(chan struct{}, maxHandlers)
+
+	var handlers sync.WaitGroup
+	r := bufio.NewReader(c.conn)
+	var err error
+	for {
+		var data []byte
+		data, err = s.Framing.ReadFrame(r, maxBytes)
+		if err == MessageTooLarge {
+			// The message was skipped, so the connection can still be used.
+			c.write(encodeReply(ErrorResponseFor(nil, err)))
+			continue
+		}
+		if err != nil {
+			break
+		}
+
+		running <- struct{}{}
+		handlers.Add(1)
+		go func() {
+			defer handlers.Done()
+			defer func() { <-running }()
+			defer func() {
+				if recover() == nil {
+					return
+				}
+				if reply := panicReply(d, data); reply != nil {
+					c.write(reply)
+				}
+			}()
+
+			ctx, hooks := withReplyHooks(c.ctx)
+			if reply := d.DispatchRaw(ctx, data); reply != nil {
+				c.write(reply)
+			}
+			hooks.run()
+		}()
+	}
+
+	var timeout net.Error
+	closing := s.isClosed() && errors.As(err, &timeout) && timeout.Timeout()
+	if !closing {
+		// The client is gone or the connection failed: handlers waiting on
+		// their context or the Peer's Done must not wait for it forever.
+		c.cancel()
+	}
+	handlers.Wait()
+	c.cancel()
+	c.conn.Close()
+
+	s.mu.Lock()
+	delete(s.conns, c)
+	closed := s.closed
+	s.mu.Unlock()
+
+	if closed || isClosedConnError(err) {
+		err = nil
+	}
+	if s.OnDisconnect != nil {
+		s.OnDisconnect(c.conn, err)
+	}
+}
+
+// panicReply returns the reply to data when its handler panicked: a
+// CodeInternalError error, with the ID of the request if data holds a single
+// one. Nothing is sent for notifications.
+func panicReply(d *Dispatcher, data []byte) []byte {
+	internal := MakeError(CodeInternalError, "Internal error", nil)
+	msg, _ := d.Parser.ParseIncoming(string(data))
+	switch m := msg.(type) {
+	case *Request:
+		resp, _ := m.MakeResponseWithError(internal)
+		return encodeReply(resp)
+	case *Notification, *Response:
+		return nil
+	}
+
+	// A batch, whose responses are lost.
+	resp := makeResponse(nil, internal, 0, responseTypeError)
+	resp.responseData.ID = nil
+	return encodeReply(resp)
+}
+
+// write sends data, closing the connection if it can't be written in time, as
+// the stream can't be used after a partial write.
+func (c *serverConn) write(data []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	if c.writeTimeout > 0 {
+		c.conn.SetWriteDeadline(time.Now().Add(c.writeTimeout))
+	}
+	err := c.framing.WriteFrame(c.w, data)
+	if err == nil {
+		err = c.w.Flush()
+	}
+	var timeout net.Error
+	if errors.As(err, &timeout) && timeout.Timeout() {
+		c.conn.Close()
+	}
+	return err
+}
+
+// Send implements Peer.
+func (c *serverConn) Send(msg Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return c.write(data)
+}
+
+// sendRaw implements rawSender.
+func (c *serverConn) sendRaw(data []byte) error {
+	return c.write(data)
+}
+
+// Close implements Peer.
+func (c *serverConn) Close() error {
+	return c.conn.Close()
+}
+
+// Done implements Peer. The connection's context is canceled as soon as the
+// client disconnects or the connection fails, and after Shutdown once its
+// handlers have returned.
+func (c *serverConn) Done() <-chan struct{} {
+	return c.ctx.Done()
+}
+
+// isClosedConnError tells whether err means that the other end closed the
+// connection.
+func isClosedConnError(err error) bool {
+	return err == nil || errors.Is(err, net.ErrClosed) || errors.Is(err, io.EOF)
+}
+
+// shutdownPollInterval is how often Shutdown checks whether all connections
+// are done.
+const shutdownPollInterval = 10 * time.Millisecond
+
+// Shutdown stops the server gracefully: it closes the listeners, stops
+// reading new messages, and waits for the handlers of messages already read to
+// return and their replies to be sent before closing the connections. If ctx
+// ends first, the remaining connections are closed, their handlers' contexts
+// canceled, and ctx's error returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.closed = true
+	s.closeListenersLocked()
+	for c := range s.conns {
+		// Wake readers up; they stop at the deadline and wait for their
+		// handlers.
+		c.conn.SetReadDeadline(time.Now())
+	}
+	s.mu.Unlock()
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for {
+		s.mu.Lock()
+		n := len(s.conns)
+		s.mu.Unlock()
+		if n == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			s.Close()
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Close stops the server immediately, closing the listeners and connections
+// and canceling the contexts of running handlers.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	err := s.closeListenersLocked()
+	for c := range s.conns {
+		c.cancel()
+		c.conn.Close()
+	}
+	return err
+}
+
+func (s *Server) closeListenersLocked() error {
+	var err error
+	for l := range s.listeners {
+		if cerr := l.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// Conns returns the connections being served.
+func (s *Server) Conns() []net.Conn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	conns := make([]net.Conn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c.conn)
+	}
+	return conns
+}
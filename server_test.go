@@ -0,0 +1,354 @@
+package gojsonrpc
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// testServer serves testDispatcher, plus a "wait" method returning once
+// release is closed, on a TCP listener. configure, if not nil, is called before
+// the server starts.
+func testServer(t *testing.T, release chan struct{}, configure func(s *Server)) (*Server, net.Listener, chan error) {
+	d := testDispatcher()
+	d.Register("wait", func(ctx context.Context, params interface{}) (interface{}, *Error) {
+		select {
+		case <-release:
+			return "released", nil
+		case <-ctx.Done():
+			return nil, MakeError(2, "canceled", nil)
+		}
+	})
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{Dispatcher: d}
+	if configure != nil {
+		configure(s)
+	}
+	served := make(chan error, 1)
+	go func() { served <- s.Serve(l) }()
+	return s, l, served
+}
+
+func testExchange(t *testing.T, f Framing, conn net.Conn, r *bufio.Reader, message, expected string) {
+	if err := f.WriteFrame(conn, []byte(message)); err != nil {
+		t.Fatal(err)
+	}
+	reply, err := f.ReadFrame(r, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(reply) != expected {
+		t.Errorf("%s: expected %s got %s", message, expected, reply)
+	}
+}
+
+func TestServer(t *testing.T) {
+	for _, f := range []Framing{NewlineFraming, ContentLengthFraming} {
+		connected, disconnected := make(chan net.Conn, 1), make(chan error, 1)
+		s, l, served := testServer(t, nil, func(s *Server) {
+			s.Framing = f
+			s.OnConnect = func(conn net.Conn) { connected <- conn }
+			s.OnDisconnect = func(conn net.Conn, err error) { disconnected <- err }
+		})
+
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := bufio.NewReader(conn)
+		testExchange(t, f, conn, r,
+			`{"jsonrpc":"2.0", "method":"echo", "params":[1], "id":1}`,
+			`{"jsonrpc":"2.0","result":[1],"id":1}`)
+		testExchange(t, f, conn, r,
+			`[{"jsonrpc":"2.0", "method":"echo", "params":[1]}, {"jsonrpc":"2.0", "method":"fail", "id":2}]`,
+			`[{"jsonrpc":"2.0","error":{"code":1,"message":"failed"},"id":2}]`)
+		testExchange(t, f, conn, r,
+			`{"jsonrpc":"2.0", "method":"echo", "id":`,
+			`{"jsonrpc":"2.0","error":{"code":-32700,"message":"Parse error","data":"unexpected end of JSON input"},"id":null}`)
+
+		if c := <-connected; c.RemoteAddr().String() != conn.LocalAddr().String() {
+			t.Errorf("expected connection from %s got %s", conn.LocalAddr(), c.RemoteAddr())
+		}
+		if conns := s.Conns(); len(conns) != 1 {
+			t.Errorf("expected 1 connection got %d", len(conns))
+		}
+
+		conn.Close()
+		if err = <-disconnected; err != nil {
+			t.Errorf("expected a clean disconnection got %v", err)
+		}
+
+		if err = s.Shutdown(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if err = <-served; err != ErrServerClosed {
+			t.Errorf("expected ErrServerClosed got %v", err)
+		}
+	}
+}
+
+func TestServerMessageTooLarge(t *testing.T) {
+	s, l, _ := testServer(t, nil, func(s *Server) {
+		s.Dispatcher.Parser.Limits = &Limits{MaxBytes: 64}
+	})
+	defer s.Close()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	testExchange(t, NewlineFraming, conn, r,
+		`{"jsonrpc":"2.0", "method":"echo", "params":["`+string(make([]byte, 64))+`"], "id":1}`,
+		`{"jsonrpc":"2.0","error":{"code":-32700,"message":"Parse error","data":"gojsonrpc: parse error: MessageTooLarge"},"id":null}`)
+	testExchange(t, NewlineFraming, conn, r,
+		`{"jsonrpc":"2.0", "method":"echo", "id":1}`,
+		`{"jsonrpc":"2.0","result":null,"id":1}`)
+}
+
+func TestServerPanic(t *testing.T) {
+	s, l, _ := testServer(t, nil, func(s *Server) {
+		s.Dispatcher.Register("panic", func(ctx context.Context, params interface{}) (interface{}, *Error) {
+			panic("handler bug")
+		})
+	})
+	defer s.Close()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	internal := `"error":{"code":-32603,"message":"Internal error"}`
+	testExchange(t, NewlineFraming, conn, r,
+		`{"jsonrpc":"2.0", "method":"panic", "id":1}`,
+		`{"jsonrpc":"2.0",`+internal+`,"id":1}`)
+	testExchange(t, NewlineFraming, conn, r,
+		`[{"jsonrpc":"2.0", "method":"echo", "id":2}, {"jsonrpc":"2.0", "method":"panic", "id":3}]`,
+		`{"jsonrpc":"2.0",`+internal+`,"id":null}`)
+	// The panic of a notification isn't answered.
+	testExchange(t, NewlineFraming, conn, r,
+		`{"jsonrpc":"2.0", "method":"panic"}`+"\n"+`{"jsonrpc":"2.0", "method":"echo", "id":4}`,
+		`{"jsonrpc":"2.0","result":null,"id":4}`)
+}
+
+func TestServerMaxHandlers(t *testing.T) {
+	release := make(chan struct{})
+	s, l, _ := testServer(t, release, func(s *Server) { s.MaxHandlers = 1 })
+	defer s.Close()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	conn.Write([]byte(`{"jsonrpc":"2.0", "method":"wait", "id":1}` + "\n" + `{"jsonrpc":"2.0", "method":"echo", "id":2}` + "\n"))
+	replies := make(chan string, 2)
+	go func() {
+		for {
+			reply, err := NewlineFraming.ReadFrame(r, 0)
+			if err != nil {
+				return
+			}
+			replies <- string(reply)
+		}
+	}()
+
+	select {
+	case reply := <-replies:
+		t.Fatalf("the second message should wait for the first handler, got %s", reply)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	for _, expected := range []string{
+		`{"jsonrpc":"2.0","result":"released","id":1}`,
+		`{"jsonrpc":"2.0","result":null,"id":2}`,
+	} {
+		if reply := <-replies; reply != expected {
+			t.Errorf("expected %s got %s", expected, reply)
+		}
+	}
+}
+
+func TestServerClientDisconnect(t *testing.T) {
+	disconnected := make(chan error, 1)
+	s, l, _ := testServer(t, nil, func(s *Server) {
+		s.OnDisconnect = func(conn net.Conn, err error) { disconnected <- err }
+	})
+	defer s.Close()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Write([]byte(`{"jsonrpc":"2.0", "method":"wait", "id":1}` + "\n"))
+	time.Sleep(20 * time.Millisecond)
+	conn.Close()
+
+	// The handler returns once its context is canceled.
+	select {
+	case err := <-disconnected:
+		if err != nil {
+			t.Errorf("expected a clean disconnect got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the handler wasn't canceled when the client disconnected")
+	}
+}
+
+func TestServerWriteTimeout(t *testing.T) {
+	s := &Server{Dispatcher: testDispatcher(), WriteTimeout: 20 * time.Millisecond}
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+	done := make(chan struct{})
+	go func() {
+		s.ServeConn(serverConn)
+		close(done)
+	}()
+
+	// The reply is never read.
+	clientConn.Write([]byte(`{"jsonrpc":"2.0", "method":"echo", "params":[1], "id":1}` + "\n"))
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the connection should be closed once the write times out")
+	}
+}
+
+func TestServerShutdownWaitsForHandlers(t *testing.T) {
+	release := make(chan struct{})
+	s, l, served := testServer(t, release, nil)
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	NewlineFraming.WriteFrame(conn, []byte(`{"jsonrpc":"2.0", "method":"wait", "id":1}`))
+	for len(s.Conns()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	// Give the server time to read the request.
+	time.Sleep(50 * time.Millisecond)
+
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- s.Shutdown(context.Background()) }()
+	if err = <-served; err != ErrServerClosed {
+		t.Errorf("expected ErrServerClosed got %v", err)
+	}
+	select {
+	case err = <-shutdown:
+		t.Fatalf("Shutdown returned before the handler: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	if err = <-shutdown; err != nil {
+		t.Fatal(err)
+	}
+	reply, err := NewlineFraming.ReadFrame(bufio.NewReader(conn), 0)
+	if expected := `{"jsonrpc":"2.0","result":"released","id":1}`; string(reply) != expected {
+		t.Errorf("expected %s got %s %v", expected, reply, err)
+	}
+	if _, err = net.Dial("tcp", l.Addr().String()); err == nil {
+		t.Error("the listener should be closed")
+	}
+}
+
+func TestServerShutdownDeadline(t *testing.T) {
+	s, l, _ := testServer(t, nil, nil)
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	NewlineFraming.WriteFrame(conn, []byte(`{"jsonrpc":"2.0", "method":"wait", "id":1}`))
+	for len(s.Conns()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err = s.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected DeadlineExceeded got %v", err)
+	}
+	if _, err = bufio.NewReader(conn).ReadByte(); err == nil {
+		t.Error("the connection should be closed")
+	}
+}
+
+func TestServerUnixSocket(t *testing.T) {
+	dir, err := os.MkdirTemp("", "gojsonrpc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	l, err := net.Listen("unix", filepath.Join(dir, "sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := new(Dispatcher)
+	d.Register("whoami", func(ctx context.Context, params interface{}) (interface{}, *Error) {
+		conn, ok := ConnFromContext(ctx)
+		if !ok {
+			return nil, MakeError(1, "no connection", nil)
+		}
+		cred, err := ReadPeerCredentials(conn)
+		if err != nil {
+			return nil, MakeError(2, err.Error(), nil)
+		}
+		return []int{cred.PID, cred.UID}, nil
+	})
+	s := &Server{Dispatcher: d}
+	go s.Serve(l)
+	defer s.Close()
+
+	conn, err := net.Dial("unix", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	expected := `{"jsonrpc":"2.0","error":{"code":2,"message":"gojsonrpc: peer credentials not supported"},"id":1}`
+	if runtime.GOOS == "linux" {
+		expected = `{"jsonrpc":"2.0","result":[` + strconv.Itoa(os.Getpid()) + `,` + strconv.Itoa(os.Getuid()) + `],"id":1}`
+	}
+	testExchange(t, NewlineFraming, conn, bufio.NewReader(conn), `{"jsonrpc":"2.0", "method":"whoami", "id":1}`, expected)
+}
+
+func TestReadPeerCredentialsNotUnix(t *testing.T) {
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+	if _, err := ReadPeerCredentials(a); err != ErrPeerCredentialsUnsupported {
+		t.Errorf("expected ErrPeerCredentialsUnsupported got %v", err)
+	}
+}
+
+// newTestFrameReader returns a function reading newline framed messages from
+// conn.
+func newTestFrameReader(conn net.Conn) func() ([]byte, error) {
+	r := bufio.NewReader(conn)
+	return func() ([]byte, error) {
+		return NewlineFraming.ReadFrame(r, 0)
+	}
+}
@@ -0,0 +1,360 @@
+package gojsonrpc
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Signature algorithms.
+const (
+	SignatureHMACSHA256 = "HS256"
+	SignatureEd25519    = "EdDSA"
+)
+
+// SignatureHeader is the HTTP header carrying the Signature of a message POSTed
+// to an HTTPHandler or SSEHandler, or of the request made by a GET call to an
+// HTTPHandler, encoded with Signature.String. A signature covers a single
+// message, so batches can't be signed.
+const SignatureHeader = "Jsonrpc-Signature"
+
+// DefaultSignatureWindow is how far a signature's timestamp may be from the
+// current time when Verifier.Window isn't set.
+const DefaultSignatureWindow = 5 * time.Minute
+
+var (
+	// ErrUnsupportedKey is returned when a key isn't a []byte (HMAC-SHA256)
+	// or an ed25519 key, or doesn't match the signature's algorithm.
+	ErrUnsupportedKey = errors.New("unsupported signing key")
+	// ErrMissingSignature is returned when a message has no signature.
+	ErrMissingSignature = errors.New("missing signature")
+	// ErrInvalidSignature is returned when a signature is malformed or
+	// doesn't match the message.
+	ErrInvalidSignature = errors.New("invalid signature")
+	// ErrSignatureExpired is returned when a signature's timestamp is outside
+	// the Verifier's window.
+	ErrSignatureExpired = errors.New("signature timestamp outside window")
+	// ErrReplayedSignature is returned when a nonce has already been seen
+	// within the Verifier's window.
+	ErrReplayedSignature = errors.New("signature nonce already used")
+)
+
+// Signature is a detached signature over the canonical JSON (see
+// CanonicalJSON) of a Request or Notification, along with the key ID,
+// algorithm, nonce and timestamp it covers. It is sent alongside the message,
+// e.g. in a transport header using String and ParseSignature, as messages
+// can't carry extra fields.
+type Signature struct {
+	KeyID     string
+	Algorithm string
+	Nonce     string
+	Timestamp int64 // Unix seconds.
+	Value     []byte
+}
+
+// String encodes s for use in a header, as URL encoded form values.
+func (s *Signature) String() string {
+	return url.Values{
+		"kid":   {s.KeyID},
+		"alg":   {s.Algorithm},
+		"nonce": {s.Nonce},
+		"ts":    {strconv.FormatInt(s.Timestamp, 10)},
+		"sig":   {base64.RawURLEncoding.EncodeToString(s.Value)},
+	}.Encode()
+}
+
+// ParseSignature decodes a signature encoded by Signature.String.
+func ParseSignature(header string) (*Signature, error) {
+	values, err := url.ParseQuery(header)
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+
+	ts, err := strconv.ParseInt(values.Get("ts"), 10, 64)
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+	value, err := base64.RawURLEncoding.DecodeString(values.Get("sig"))
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+
+	return &Signature{
+		KeyID:     values.Get("kid"),
+		Algorithm: values.Get("alg"),
+		Nonce:     values.Get("nonce"),
+		Timestamp: ts,
+		Value:     value,
+	}, nil
+}
+
+type signatureContextKey struct{}
+
+// ContextWithSignature returns a copy of ctx carrying sig, for a transport to
+// pass the signature it received to Verifier.Middleware.
+func ContextWithSignature(ctx context.Context, sig *Signature) context.Context {
+	return context.WithValue(ctx, signatureContextKey{}, sig)
+}
+
+// SignatureFromContext returns the signature stored by ContextWithSignature.
+func SignatureFromContext(ctx context.Context) (*Signature, bool) {
+	sig, ok := ctx.Value(signatureContextKey{}).(*Signature)
+	return sig, ok && sig != nil
+}
+
+// contextWithRequestSignature returns a copy of ctx carrying the signature in
+// the SignatureHeader of r, if it has one.
+func contextWithRequestSignature(ctx context.Context, r *http.Request) (context.Context, error) {
+	header := r.Header.Get(SignatureHeader)
+	if header == "" {
+		return ctx, nil
+	}
+	sig, err := ParseSignature(header)
+	if err != nil {
+		return nil, err
+	}
+	return ContextWithSignature(ctx, sig), nil
+}
+
+// signingInput returns the bytes that are signed: the canonical JSON of an
+// object holding the message and the signature's other fields.
+func signingInput(msg Message, sig *Signature) ([]byte, error) {
+	canonical, err := canonicalJSON(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Members in RFC 8785 order.
+	b := []byte(`{"alg":`)
+	b = appendCanonicalString(b, sig.Algorithm)
+	b = append(b, `,"kid":`...)
+	b = appendCanonicalString(b, sig.KeyID)
+	b = append(b, `,"message":`...)
+	b = append(b, canonical...)
+	b = append(b, `,"nonce":`...)
+	b = appendCanonicalString(b, sig.Nonce)
+	b = append(b, `,"ts":`...)
+	b = strconv.AppendInt(b, sig.Timestamp, 10)
+	return append(b, '}'), nil
+}
+
+func signatureAlgorithm(key interface{}) (string, error) {
+	switch key.(type) {
+	case []byte:
+		return SignatureHMACSHA256, nil
+	case ed25519.PrivateKey, ed25519.PublicKey:
+		return SignatureEd25519, nil
+	}
+
+	return "", ErrUnsupportedKey
+}
+
+// Signer signs outgoing messages.
+type Signer struct {
+	// KeyID identifies Key to the Verifier.
+	KeyID string
+	// Key is a []byte secret for HMAC-SHA256 or an ed25519.PrivateKey.
+	Key interface{}
+
+	now func() time.Time
+}
+
+// Sign returns a signature over msg with a new random nonce and the current
+// time.
+func (s *Signer) Sign(msg Message) (*Signature, error) {
+	alg, err := signatureAlgorithm(s.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, 16)
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	now := time.Now
+	if s.now != nil {
+		now = s.now
+	}
+
+	sig := &Signature{
+		KeyID:     s.KeyID,
+		Algorithm: alg,
+		Nonce:     hex.EncodeToString(nonce),
+		Timestamp: now().Unix(),
+	}
+
+	input, err := signingInput(msg, sig)
+	if err != nil {
+		return nil, err
+	}
+
+	switch key := s.Key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, key)
+		mac.Write(input)
+		sig.Value = mac.Sum(nil)
+	case ed25519.PrivateKey:
+		sig.Value = ed25519.Sign(key, input)
+	default:
+		return nil, ErrUnsupportedKey
+	}
+
+	return sig, nil
+}
+
+// Transport returns a RoundTripper signing each message before passing it to
+// next, with the signature in the context given to next (see
+// SignatureFromContext). Transports such as SSETransport send it in the
+// SignatureHeader. Only single Requests and Notifications can be signed.
+func (s *Signer) Transport(next RoundTripper) RoundTripper {
+	return RoundTripperFunc(func(ctx context.Context, message []byte) ([]byte, error) {
+		p := Parser{UseNumber: true}
+		msg, err := p.ParseIncoming(string(message))
+		if err != nil {
+			return nil, err
+		}
+		sig, err := s.Sign(msg)
+		if err != nil {
+			return nil, err
+		}
+		return next.RoundTrip(ContextWithSignature(ctx, sig), message)
+	})
+}
+
+// Verifier checks the signatures of incoming messages and rejects replays.
+type Verifier struct {
+	// Keys returns the key for a key ID: a []byte secret for HMAC-SHA256 or
+	// an ed25519.PublicKey.
+	Keys func(keyID string) (interface{}, error)
+	// Window is how far a signature's timestamp may be from the current
+	// time. Nonces are remembered for twice this long. Zero means
+	// DefaultSignatureWindow.
+	Window time.Duration
+	// ErrorCode is the code of the error Response sent by Middleware when
+	// verification fails. Zero means CodeInvalidRequest.
+	ErrorCode int
+
+	now func() time.Time
+
+	mu        sync.Mutex
+	nonces    map[string]time.Time
+	lastPrune time.Time
+}
+
+// Verify checks that sig is a valid signature over msg from a known key, that
+// its timestamp is within the window and that its nonce hasn't been used
+// before.
+func (v *Verifier) Verify(msg Message, sig *Signature) error {
+	if sig == nil {
+		return ErrMissingSignature
+	}
+
+	now := time.Now()
+	if v.now != nil {
+		now = v.now()
+	}
+	window := v.Window
+	if window == 0 {
+		window = DefaultSignatureWindow
+	}
+
+	ts := time.Unix(sig.Timestamp, 0)
+	if ts.Before(now.Add(-window)) || ts.After(now.Add(window)) {
+		return ErrSignatureExpired
+	}
+
+	key, err := v.Keys(sig.KeyID)
+	if err != nil {
+		return err
+	}
+	if alg, err := signatureAlgorithm(key); err != nil || alg != sig.Algorithm {
+		return ErrUnsupportedKey
+	}
+
+	input, err := signingInput(msg, sig)
+	if err != nil {
+		return err
+	}
+
+	var valid bool
+	switch key := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, key)
+		mac.Write(input)
+		valid = hmac.Equal(mac.Sum(nil), sig.Value)
+	case ed25519.PublicKey:
+		valid = len(key) == ed25519.PublicKeySize && ed25519.Verify(key, input, sig.Value)
+	}
+	if !valid {
+		return ErrInvalidSignature
+	}
+
+	return v.useNonce(sig.KeyID+"\x00"+sig.Nonce, now, 2*window)
+}
+
+// useNonce records nonce, failing if it is already recorded. Nonces are kept
+// for ttl, which covers every timestamp that the window accepts.
+func (v *Verifier) useNonce(nonce string, now time.Time, ttl time.Duration) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.nonces == nil {
+		v.nonces = make(map[string]time.Time)
+	}
+	if now.Sub(v.lastPrune) > ttl/2 {
+		for n, expiry := range v.nonces {
+			if now.After(expiry) {
+				delete(v.nonces, n)
+			}
+		}
+		v.lastPrune = now
+	}
+
+	if expiry, ok := v.nonces[nonce]; ok && !now.After(expiry) {
+		return ErrReplayedSignature
+	}
+	v.nonces[nonce] = now.Add(ttl)
+	return nil
+}
+
+// Middleware returns Dispatcher middleware that verifies the signature found
+// with SignatureFromContext on every Request and Notification. Requests that
+// fail are answered with an error Response using ErrorCode, whose data is the
+// reason. Notifications that fail are dropped. Responses are passed through.
+func (v *Verifier) Middleware() Middleware {
+	return func(next MessageHandler) MessageHandler {
+		return func(ctx context.Context, msg Message) *Response {
+			if _, ok := msg.(*Response); ok {
+				return next(ctx, msg)
+			}
+
+			sig, _ := SignatureFromContext(ctx)
+			err := v.Verify(msg, sig)
+			if err == nil {
+				return next(ctx, msg)
+			}
+
+			req, ok := msg.(*Request)
+			if !ok {
+				return nil
+			}
+			code := v.ErrorCode
+			if code == 0 {
+				code = CodeInvalidRequest
+			}
+			resp, _ := req.MakeResponseWithError(MakeError(code, "Invalid signature", err.Error()))
+			return resp
+		}
+	}
+}
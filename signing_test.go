@@ -0,0 +1,326 @@
+package gojsonrpc
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testSigningTime = time.Date(2016, 8, 3, 12, 0, 0, 0, time.UTC)
+
+func testSigningKeys(t *testing.T) (signers []*Signer, verifier *Verifier) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := []byte("secret")
+
+	now := func() time.Time { return testSigningTime }
+	signers = []*Signer{
+		{KeyID: "hmac", Key: secret, now: now},
+		{KeyID: "ed25519", Key: priv, now: now},
+	}
+	verifier = &Verifier{
+		Keys: func(keyID string) (interface{}, error) {
+			switch keyID {
+			case "hmac":
+				return secret, nil
+			case "ed25519":
+				return pub, nil
+			}
+			return nil, errors.New("unknown key")
+		},
+		now: now,
+	}
+
+	return signers, verifier
+}
+
+func TestSignAndVerify(t *testing.T) {
+	signers, v := testSigningKeys(t)
+	req, _ := MakeRequest(testRequestMethod, map[string]interface{}{"b": 1, "a": 2}, testRequestId)
+	notif, _ := MakeNotification(testNotificationMethod, nil)
+
+	for _, s := range signers {
+		for _, msg := range []Message{req, notif} {
+			sig, err := s.Sign(msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = v.Verify(msg, sig); err != nil {
+				t.Errorf("%s: %v", s.KeyID, err)
+			}
+		}
+	}
+}
+
+func TestVerifyCanonicalMessage(t *testing.T) {
+	signers, v := testSigningKeys(t)
+	req, _ := MakeRequest(testRequestMethod, map[string]interface{}{"b": 1, "a": 2}, testRequestId)
+	sig, err := signers[0].Sign(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The same request, as received with different formatting.
+	received, err := ParseIncoming(`{ "id": 1, "params": {"a": 2.0, "b": 1}, "method": "test", "jsonrpc": "2.0" }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = v.Verify(received, sig); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestVerifyFailures(t *testing.T) {
+	signers, v := testSigningKeys(t)
+	req, _ := MakeRequest(testRequestMethod, []interface{}{1}, testRequestId)
+	other, _ := MakeRequest(testRequestMethod, []interface{}{2}, testRequestId)
+
+	for _, s := range signers {
+		sig, err := s.Sign(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err = v.Verify(other, sig); err != ErrInvalidSignature {
+			t.Errorf("%s: tampered message: expected %v got %v", s.KeyID, ErrInvalidSignature, err)
+		}
+
+		changed := *sig
+		changed.Nonce = "other"
+		if err = v.Verify(req, &changed); err != ErrInvalidSignature {
+			t.Errorf("%s: tampered nonce: expected %v got %v", s.KeyID, ErrInvalidSignature, err)
+		}
+
+		changed = *sig
+		changed.Timestamp -= int64(DefaultSignatureWindow/time.Second) + 1
+		if err = v.Verify(req, &changed); err != ErrSignatureExpired {
+			t.Errorf("%s: old timestamp: expected %v got %v", s.KeyID, ErrSignatureExpired, err)
+		}
+
+		changed = *sig
+		changed.Algorithm = SignatureHMACSHA256
+		changed.KeyID = signers[1].KeyID
+		if err = v.Verify(req, &changed); err != ErrUnsupportedKey {
+			t.Errorf("%s: wrong algorithm: expected %v got %v", s.KeyID, ErrUnsupportedKey, err)
+		}
+
+		if err = v.Verify(req, sig); err != nil {
+			t.Errorf("%s: %v", s.KeyID, err)
+		}
+		if err = v.Verify(req, sig); err != ErrReplayedSignature {
+			t.Errorf("%s: replay: expected %v got %v", s.KeyID, ErrReplayedSignature, err)
+		}
+	}
+
+	if err := v.Verify(req, nil); err != ErrMissingSignature {
+		t.Errorf("expected %v got %v", ErrMissingSignature, err)
+	}
+}
+
+func TestVerifyForgetsExpiredNonces(t *testing.T) {
+	signers, v := testSigningKeys(t)
+	req, _ := MakeRequest(testRequestMethod, nil, testRequestId)
+	sig, err := signers[0].Sign(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = v.Verify(req, sig); err != nil {
+		t.Fatal(err)
+	}
+
+	later := func() time.Time { return testSigningTime.Add(3 * DefaultSignatureWindow) }
+	v.now, signers[0].now = later, later
+	if err = v.Verify(req, sig); err != ErrSignatureExpired {
+		t.Errorf("expected %v got %v", ErrSignatureExpired, err)
+	}
+
+	if sig, err = signers[0].Sign(req); err != nil {
+		t.Fatal(err)
+	}
+	if err = v.Verify(req, sig); err != nil {
+		t.Fatal(err)
+	}
+	if len(v.nonces) != 1 {
+		t.Errorf("expected expired nonces to be pruned, have %d", len(v.nonces))
+	}
+}
+
+func TestSignatureHeader(t *testing.T) {
+	sig := &Signature{
+		KeyID:     "key id,=&",
+		Algorithm: SignatureEd25519,
+		Nonce:     "abc",
+		Timestamp: 1470225600,
+		Value:     []byte{0, 1, 0xfe, 0xff},
+	}
+
+	parsed, err := ParseSignature(sig.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(sig, parsed) {
+		t.Errorf("expected %#v got %#v", sig, parsed)
+	}
+
+	for _, header := range []string{"%zz", "ts=x&sig=", "ts=1&sig=!!"} {
+		if _, err = ParseSignature(header); err != ErrInvalidSignature {
+			t.Errorf("%s: expected %v got %v", header, ErrInvalidSignature, err)
+		}
+	}
+}
+
+func TestVerifierMiddleware(t *testing.T) {
+	signers, v := testSigningKeys(t)
+	v.ErrorCode = -32001
+
+	called := 0
+	d := testDispatcher()
+	d.Register("count", func(ctx context.Context, params interface{}) (interface{}, *Error) {
+		called++
+		return called, nil
+	})
+	d.Use(v.Middleware())
+
+	req, _ := MakeRequest("count", nil, 1)
+	sig, err := signers[1].Sign(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := ContextWithSignature(context.Background(), sig)
+
+	resp := d.DispatchMessage(ctx, req)
+	if resp == nil || !resp.IsResult() || called != 1 {
+		t.Fatalf("expected the signed request to be handled, got %v", resp)
+	}
+
+	// Replayed and unsigned requests are rejected before reaching the handler.
+	for _, ctx := range []context.Context{ctx, context.Background()} {
+		resp = d.DispatchMessage(ctx, req)
+		got, _ := json.Marshal(resp)
+		if resp == nil || !resp.IsError() || resp.Error().Code() != -32001 || called != 1 {
+			t.Errorf("expected an error response, got %s", got)
+		}
+	}
+
+	notif, _ := MakeNotification("count", nil)
+	if resp = d.DispatchMessage(context.Background(), notif); resp != nil || called != 1 {
+		t.Errorf("expected unsigned notification to be dropped, got %v", resp)
+	}
+}
+
+func TestHTTPHandlerGetSigned(t *testing.T) {
+	signers, v := testSigningKeys(t)
+	h := &HTTPHandler{SafeMethods: map[string]bool{"echo": true}}
+	srv := testHTTPServer(t, h)
+	h.Dispatcher.Use(v.Middleware())
+
+	req, _ := MakeRequest("echo", []string{"a"}, 3)
+	sig, err := signers[0].Sign(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u := srv.URL + "?method=echo&params=" + url.QueryEscape(`["a"]`) + "&id=3"
+	tests := []struct {
+		header string
+		status int
+		reply  string
+	}{
+		{sig.String(), http.StatusOK, `{"jsonrpc":"2.0","result":["a"],"id":3}`},
+		// Replayed.
+		{sig.String(), http.StatusOK, ""},
+		{"", http.StatusOK, ""},
+		{"ts=x", http.StatusBadRequest, ""},
+	}
+	for i, test := range tests {
+		var header http.Header
+		if test.header != "" {
+			header = http.Header{SignatureHeader: {test.header}}
+		}
+		resp, body := testHTTPGet(t, u, header)
+		if resp.StatusCode != test.status {
+			t.Errorf("%d: expected %d got %s %s", i, test.status, resp.Status, body)
+			continue
+		}
+		if test.reply != "" && body != test.reply {
+			t.Errorf("%d: expected %s got %s", i, test.reply, body)
+		}
+		if test.reply == "" && test.status == http.StatusOK && !strings.Contains(body, `"error"`) {
+			t.Errorf("%d: expected an error response got %s", i, body)
+		}
+		if resp.StatusCode == http.StatusOK && resp.Header.Get("Vary") != SignatureHeader {
+			t.Errorf("%d: expected Vary: %s got %v", i, SignatureHeader, resp.Header)
+		}
+	}
+}
+
+func TestSignedTransports(t *testing.T) {
+	signers, v := testSigningKeys(t)
+	v.now = nil
+	signer := &Signer{KeyID: signers[0].KeyID, Key: signers[0].Key}
+
+	h := new(SSEHandler)
+	sseSrv := testSSEServer(t, h)
+	h.Dispatcher.Use(v.Middleware())
+	httpSrv := httptest.NewServer(&HTTPHandler{Dispatcher: h.Dispatcher})
+	defer httpSrv.Close()
+
+	sse := &SSETransport{URL: sseSrv.URL}
+	defer sse.Close()
+	post := func(header string) RoundTripper {
+		return RoundTripperFunc(func(ctx context.Context, message []byte) ([]byte, error) {
+			req, err := http.NewRequest(http.MethodPost, httpSrv.URL, bytes.NewReader(message))
+			if err != nil {
+				return nil, err
+			}
+			if sig, ok := SignatureFromContext(ctx); ok {
+				header = sig.String()
+			}
+			req.Header.Set(SignatureHeader, header)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				return nil, err
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				return nil, errors.New(resp.Status)
+			}
+			return ioutil.ReadAll(resp.Body)
+		})
+	}
+
+	tests := []struct {
+		name      string
+		transport RoundTripper
+		signed    bool
+	}{
+		{"SSE", sse, false},
+		{"signed SSE", signer.Transport(sse), true},
+		{"HTTP", post(""), false},
+		{"signed HTTP", signer.Transport(post("")), true},
+		{"malformed header", post("ts=x"), false},
+	}
+	for _, test := range tests {
+		c := &Client{Transport: test.transport}
+		var result []string
+		err := c.Call(context.Background(), "echo", []string{"a"}, &result)
+		if test.signed && (err != nil || len(result) != 1) {
+			t.Errorf("%s: expected [a] got %v, %v", test.name, result, err)
+		}
+		if !test.signed && err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+	}
+}
@@ -0,0 +1,503 @@
+package gojsonrpc
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// SessionHeader is the HTTP header carrying the session ID of the SSE
+// transport.
+const SessionHeader = "Jsonrpc-Session"
+
+// DefaultSSEBufferSize is the number of events kept per session for replay
+// when SSEHandler.BufferSize is zero.
+const DefaultSSEBufferSize = 256
+
+// DefaultSSEIdleTimeout is how long a session may go without a POST or an open
+// stream before it is closed, when SSEHandler.IdleTimeout is zero.
+const DefaultSSEIdleTimeout = 10 * time.Minute
+
+// ErrSessionClosed is returned when sending on a closed SSE session.
+var ErrSessionClosed = errors.New("gojsonrpc: session closed")
+
+// errTooManySessions is returned when SSEHandler.MaxSessions is reached.
+var errTooManySessions = errors.New("too many sessions")
+
+// SSEHandler is an HTTP transport for clients that can't keep a bidirectional
+// connection open, following the "streamable HTTP" pattern: clients POST
+// messages, and receive the replies along with messages sent by the server on
+// a long-lived text/event-stream, opened with GET.
+//
+// The first POST from a client, without a SessionHeader, starts a session
+// whose ID is returned in the SessionHeader of the reply. Later requests must
+// carry it. POSTs are answered with 202 Accepted once their messages have been
+// handled, and a DELETE ends the session. A POST that can't be parsed doesn't
+// start a session, and sessions left idle for IdleTimeout are closed.
+//
+// Each message sent to a client is an event with an ID. The last events are
+// kept in a buffer, so that a client reconnecting with a Last-Event-ID header
+// gets the events it missed, as long as they are still in the buffer. Only one
+// stream per session is live: opening a new one closes the previous one.
+type SSEHandler struct {
+	// Dispatcher handles the messages POSTed. Handlers can send messages to
+	// the client with the SSESession from SSESessionFromContext or
+	// PeerFromContext.
+	Dispatcher *Dispatcher
+	// BufferSize is the number of events kept per session for replay. If
+	// zero, DefaultSSEBufferSize is used.
+	BufferSize int
+	// KeepAlive, if not zero, is how often a comment is sent on idle
+	// streams, to stop proxies from closing them.
+	KeepAlive time.Duration
+	// IdleTimeout is how long a session may go without a POST being
+	// handled or a stream being open before it is closed. If zero,
+	// DefaultSSEIdleTimeout is used. If negative, sessions are only closed
+	// by the client or Close.
+	IdleTimeout time.Duration
+	// MaxSessions, if not zero, is the maximum number of open sessions.
+	// POSTs that would start another one are answered with 503 Service
+	// Unavailable.
+	MaxSessions int
+
+	mu       sync.Mutex
+	sessions map[string]*SSESession
+}
+
+// SSESession is a client session of an SSEHandler. It is the Peer of the
+// messages POSTed in the session.
+type SSESession struct {
+	id      string
+	handler *SSEHandler
+
+	mu      sync.Mutex
+	events  []sseEvent
+	lastID  uint64
+	sent    uint64
+	stream  uint64
+	changed chan struct{}
+	closed  bool
+	done    chan struct{}
+
+	idle       *time.Timer
+	busy       int // POSTs being handled and open streams.
+	lastActive time.Time
+}
+
+type sseEvent struct {
+	id   uint64
+	data []byte
+}
+
+type sseSessionContextKey struct{}
+
+// SSESessionFromContext returns the session of the client whose message is
+// being handled, from the context passed to handlers by an SSEHandler.
+func SSESessionFromContext(ctx context.Context) (*SSESession, bool) {
+	s, ok := ctx.Value(sseSessionContextKey{}).(*SSESession)
+	return s, ok
+}
+
+// ServeHTTP implements http.Handler.
+func (h *SSEHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		h.post(w, r)
+	case http.MethodGet:
+		s, ok := h.requestSession(w, r)
+		if ok {
+			h.stream(w, r, s)
+		}
+	case http.MethodDelete:
+		s, ok := h.requestSession(w, r)
+		if ok {
+			s.Close()
+			w.WriteHeader(http.StatusNoContent)
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// requestSession returns the session named in r, answering r with an error if
+// there is none.
+func (h *SSEHandler) requestSession(w http.ResponseWriter, r *http.Request) (*SSESession, bool) {
+	id := r.Header.Get(SessionHeader)
+	if id == "" {
+		http.Error(w, "missing "+SessionHeader+" header", http.StatusBadRequest)
+		return nil, false
+	}
+	s, ok := h.Session(id)
+	if !ok {
+		http.Error(w, "unknown session", http.StatusNotFound)
+		return nil, false
+	}
+	return s, true
+}
+
+func (h *SSEHandler) post(w http.ResponseWriter, r *http.Request) {
+	d := h.Dispatcher
+	if d == nil {
+		d = new(Dispatcher)
+	}
+
+	sigCtx, err := contextWithRequestSignature(r.Context(), r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	body := r.Body
+	if d.Parser.Limits != nil && d.Parser.Limits.MaxBytes > 0 {
+		body = http.MaxBytesReader(w, body, int64(d.Parser.Limits.MaxBytes))
+	}
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	var s *SSESession
+	if r.Header.Get(SessionHeader) == "" {
+		// Only start sessions for clients that speak JSON-RPC.
+		if err = parseable(d, data); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if s, err = h.newSession(); err == errTooManySessions {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	} else {
+		var ok bool
+		if s, ok = h.requestSession(w, r); !ok {
+			return
+		}
+	}
+
+	s.begin()
+	defer s.end()
+	ctx := ContextWithPeer(context.WithValue(sigCtx, sseSessionContextKey{}, s), s)
+	ctx, hooks := withReplyHooks(ctx)
+	if reply := d.DispatchRaw(ctx, data); reply != nil {
+		s.push(reply)
+	}
+	hooks.run()
+
+	w.Header().Set(SessionHeader, s.id)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// parseable returns the error met parsing data, a message or a batch, with the
+// Parser of d.
+func parseable(d *Dispatcher, data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || data[0] != '[' {
+		_, err := d.Parser.ParseIncoming(string(data))
+		return err
+	}
+
+	if d.Parser.Strict || d.Parser.Limits != nil {
+		if err := scanMessage(data, d.Parser.Strict, d.Parser.Limits); err != nil {
+			return err
+		}
+	}
+	var messages []json.RawMessage
+	if err := json.Unmarshal(data, &messages); err != nil {
+		return err
+	}
+	if len(messages) == 0 {
+		return InvalidMessage
+	}
+	for _, m := range messages {
+		if _, err := d.Parser.ParseIncoming(string(m)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *SSEHandler) newSession() (*SSESession, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return nil, err
+	}
+	s := &SSESession{
+		id:         hex.EncodeToString(b[:]),
+		handler:    h,
+		changed:    make(chan struct{}),
+		done:       make(chan struct{}),
+		lastActive: time.Now(),
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.MaxSessions > 0 && len(h.sessions) >= h.MaxSessions {
+		return nil, errTooManySessions
+	}
+	if h.sessions == nil {
+		h.sessions = make(map[string]*SSESession)
+	}
+	h.sessions[s.id] = s
+	if timeout := h.idleTimeout(); timeout > 0 {
+		s.idle = time.AfterFunc(timeout, s.expire)
+	}
+	return s, nil
+}
+
+func (h *SSEHandler) idleTimeout() time.Duration {
+	if h.IdleTimeout != 0 {
+		return h.IdleTimeout
+	}
+	return DefaultSSEIdleTimeout
+}
+
+// Session returns the session with the given ID.
+func (h *SSEHandler) Session(id string) (*SSESession, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s, ok := h.sessions[id]
+	return s, ok
+}
+
+// Close ends all sessions.
+func (h *SSEHandler) Close() {
+	h.mu.Lock()
+	sessions := h.sessions
+	h.sessions = nil
+	h.mu.Unlock()
+
+	for _, s := range sessions {
+		s.Close()
+	}
+}
+
+func (h *SSEHandler) bufferSize() int {
+	if h.BufferSize > 0 {
+		return h.BufferSize
+	}
+	return DefaultSSEBufferSize
+}
+
+// stream sends the events of s to the client, starting after the
+// Last-Event-ID given, or after the last event sent to a previous stream.
+func (h *SSEHandler) stream(w http.ResponseWriter, r *http.Request, s *SSESession) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	s.begin()
+	defer s.end()
+
+	s.mu.Lock()
+	s.stream++
+	stream, cursor := s.stream, s.sent
+	s.wakeLocked()
+	s.mu.Unlock()
+
+	if last := r.Header.Get("Last-Event-ID"); last != "" {
+		id, err := strconv.ParseUint(last, 10, 64)
+		if err != nil {
+			http.Error(w, "invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+		cursor = id
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set(SessionHeader, s.id)
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	var keepAlive <-chan time.Time
+	if h.KeepAlive > 0 {
+		ticker := time.NewTicker(h.KeepAlive)
+		defer ticker.Stop()
+		keepAlive = ticker.C
+	}
+
+	for {
+		s.mu.Lock()
+		if s.closed || s.stream != stream {
+			s.mu.Unlock()
+			return
+		}
+		events := s.eventsAfterLocked(cursor)
+		changed := s.changed
+		s.mu.Unlock()
+
+		for _, e := range events {
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: message\ndata: %s\n\n", e.id, e.data); err != nil {
+				return
+			}
+			cursor = e.id
+		}
+		if len(events) != 0 {
+			flusher.Flush()
+			s.mu.Lock()
+			if cursor > s.sent {
+				s.sent = cursor
+			}
+			s.mu.Unlock()
+			continue
+		}
+
+		select {
+		case <-changed:
+		case <-keepAlive:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// ID returns the session's ID.
+func (s *SSESession) ID() string {
+	return s.id
+}
+
+// Send sends msg to the client on its event stream. If the client isn't
+// connected, msg is buffered until it reconnects.
+func (s *SSESession) Send(msg Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return s.sendRaw(data)
+}
+
+// sendRaw implements rawSender.
+func (s *SSESession) sendRaw(data []byte) error {
+	if !s.push(data) {
+		return ErrSessionClosed
+	}
+	return nil
+}
+
+// Notify sends a Notification for method with params to the client.
+func (s *SSESession) Notify(method string, params interface{}) error {
+	notif, err := MakeNotification(method, params)
+	if err != nil {
+		return err
+	}
+	return s.Send(notif)
+}
+
+// push adds an event holding data, dropping the oldest one if the buffer is
+// full. It returns false if s is closed.
+func (s *SSESession) push(data []byte) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return false
+	}
+	s.lastID++
+	s.events = append(s.events, sseEvent{id: s.lastID, data: data})
+	if n := s.handler.bufferSize(); len(s.events) > n {
+		s.events = append(s.events[:0], s.events[len(s.events)-n:]...)
+	}
+	s.wakeLocked()
+	return true
+}
+
+// eventsAfterLocked returns the buffered events whose ID is greater than id.
+func (s *SSESession) eventsAfterLocked(id uint64) []sseEvent {
+	if len(s.events) == 0 || id >= s.lastID {
+		return nil
+	}
+	first := s.events[0].id
+	if id < first {
+		return append([]sseEvent(nil), s.events...)
+	}
+	return append([]sseEvent(nil), s.events[id-first+1:]...)
+}
+
+// wakeLocked wakes the stream up.
+func (s *SSESession) wakeLocked() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// begin marks s as in use, so that it doesn't expire until end is called.
+func (s *SSESession) begin() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.busy++
+	if s.idle != nil {
+		s.idle.Stop()
+	}
+}
+
+// end undoes begin, restarting the idle timer once s is no longer in use.
+func (s *SSESession) end() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.busy--
+	s.lastActive = time.Now()
+	if s.busy == 0 && s.idle != nil && !s.closed {
+		s.idle.Reset(s.handler.idleTimeout())
+	}
+}
+
+// expire closes s if it has been idle for the handler's IdleTimeout.
+func (s *SSESession) expire() {
+	s.mu.Lock()
+	idle := s.busy == 0 && time.Since(s.lastActive) >= s.handler.idleTimeout()
+	s.mu.Unlock()
+
+	if idle {
+		s.Close()
+	}
+}
+
+// Done is closed once the session has ended.
+func (s *SSESession) Done() <-chan struct{} {
+	return s.done
+}
+
+// Close ends the session, closing its stream. It implements Peer.
+func (s *SSESession) Close() error {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		s.events = nil
+		if s.idle != nil {
+			s.idle.Stop()
+		}
+		s.wakeLocked()
+		close(s.done)
+	}
+	s.mu.Unlock()
+
+	h := s.handler
+	h.mu.Lock()
+	if h.sessions[s.id] == s {
+		delete(h.sessions, s.id)
+	}
+	h.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,300 @@
+package gojsonrpc
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testSSEServer serves testDispatcher, plus a "count" method sending
+// notifications "tick" with params [1] to [n] on the caller's session.
+func testSSEServer(t *testing.T, h *SSEHandler) *httptest.Server {
+	d := testDispatcher()
+	d.Register("count", func(ctx context.Context, params interface{}) (interface{}, *Error) {
+		s, ok := SSESessionFromContext(ctx)
+		if !ok {
+			return nil, MakeError(1, "no session", nil)
+		}
+		n := int(params.([]interface{})[0].(float64))
+		for i := 1; i <= n; i++ {
+			s.Notify("tick", []int{i})
+		}
+		return n, nil
+	})
+	h.Dispatcher = d
+
+	srv := httptest.NewServer(h)
+	t.Cleanup(func() {
+		h.Close()
+		srv.Close()
+	})
+	return srv
+}
+
+func testTicks(t *testing.T, ticks chan *Notification, from, to int) {
+	for i := from; i <= to; i++ {
+		select {
+		case n := <-ticks:
+			if got := int(n.Params().([]interface{})[0].(float64)); got != i {
+				t.Fatalf("expected tick %d got %d", i, got)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for tick %d", i)
+		}
+	}
+}
+
+func TestSSETransport(t *testing.T) {
+	srv := testSSEServer(t, new(SSEHandler))
+	ticks := make(chan *Notification, 100)
+	transport := &SSETransport{URL: srv.URL, OnNotification: func(n *Notification) { ticks <- n }}
+	defer transport.Close()
+	c := &Client{Transport: transport}
+	ctx := context.Background()
+
+	var result []string
+	if err := c.Call(ctx, "echo", []string{"a"}, &result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 1 || result[0] != "a" {
+		t.Errorf("expected [a] got %v", result)
+	}
+	if err := c.Call(ctx, "fail", nil, nil); err == nil || AsError(err).Code() != 1 {
+		t.Errorf("expected error 1 got %v", err)
+	}
+	if err := c.Notify(ctx, "echo", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Call(ctx, "count", []int{3}, nil); err != nil {
+		t.Fatal(err)
+	}
+	testTicks(t, ticks, 1, 3)
+}
+
+func TestSSETransportReconnect(t *testing.T) {
+	h := new(SSEHandler)
+	srv := testSSEServer(t, h)
+	ticks := make(chan *Notification, 100)
+	transport := &SSETransport{
+		URL:            srv.URL,
+		RetryDelay:     10 * time.Millisecond,
+		OnNotification: func(n *Notification) { ticks <- n },
+	}
+	defer transport.Close()
+	c := &Client{Transport: transport}
+
+	if err := c.Call(context.Background(), "count", []int{2}, nil); err != nil {
+		t.Fatal(err)
+	}
+	testTicks(t, ticks, 1, 2)
+
+	// Events sent while the client is away are replayed once it is back.
+	srv.CloseClientConnections()
+	s, ok := h.Session(transport.SessionID())
+	if !ok {
+		t.Fatal("no session")
+	}
+	s.Notify("tick", []int{3})
+	s.Notify("tick", []int{4})
+	testTicks(t, ticks, 3, 4)
+
+	select {
+	case n := <-ticks:
+		t.Errorf("unexpected notification %v", n)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestSSETransportSessionClosed(t *testing.T) {
+	h := new(SSEHandler)
+	srv := testSSEServer(t, h)
+	transport := &SSETransport{URL: srv.URL, RetryDelay: 10 * time.Millisecond}
+	defer transport.Close()
+	c := &Client{Transport: transport}
+
+	if err := c.Call(context.Background(), "echo", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	h.Close()
+	if err := c.Call(context.Background(), "echo", nil, nil); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestSSETransportNullIDError(t *testing.T) {
+	h := new(SSEHandler)
+	srv := testSSEServer(t, h)
+	h.Dispatcher.Parser.Limits = &Limits{MaxStringLength: 8}
+	transport := &SSETransport{URL: srv.URL}
+	defer transport.Close()
+	c := &Client{Transport: transport}
+
+	if err := c.Call(context.Background(), "echo", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// The server can't tell which call the error is about, so it comes with
+	// a null ID.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := c.Call(ctx, "echo", []string{"a long string"}, nil)
+	if e := AsError(err); e == nil || e.Code() != CodeInvalidRequest {
+		t.Errorf("expected an invalid request error got %v", err)
+	}
+}
+
+func TestSSEHandlerReplay(t *testing.T) {
+	h := &SSEHandler{BufferSize: 2}
+	srv := testSSEServer(t, h)
+
+	resp, err := http.Post(srv.URL, "application/json", strings.NewReader(`{"jsonrpc":"2.0","method":"echo"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("expected 202 got %s", resp.Status)
+	}
+	s, ok := h.Session(resp.Header.Get(SessionHeader))
+	if !ok {
+		t.Fatal("no session")
+	}
+	for i := 1; i <= 3; i++ {
+		s.Notify("tick", []int{i})
+	}
+
+	for _, test := range []struct {
+		lastEventID string
+		expected    string
+	}{
+		// The first event has left the buffer.
+		{"", "id: 2\nevent: message\ndata: {\"jsonrpc\":\"2.0\",\"method\":\"tick\",\"params\":[2]}\n"},
+		{"2", "id: 3\nevent: message\ndata: {\"jsonrpc\":\"2.0\",\"method\":\"tick\",\"params\":[3]}\n"},
+	} {
+		ctx, cancel := context.WithCancel(context.Background())
+		req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+		req = req.WithContext(ctx)
+		req.Header.Set(SessionHeader, s.ID())
+		if test.lastEventID != "" {
+			req.Header.Set("Last-Event-ID", test.lastEventID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+			t.Errorf("expected text/event-stream got %s", ct)
+		}
+
+		r := bufio.NewReader(resp.Body)
+		var event string
+		for i := 0; i < 3; i++ {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				t.Fatal(err)
+			}
+			event += line
+		}
+		if event != test.expected {
+			t.Errorf("Last-Event-ID %q: expected %q got %q", test.lastEventID, test.expected, event)
+		}
+		cancel()
+		resp.Body.Close()
+	}
+}
+
+func TestSSEHandlerErrors(t *testing.T) {
+	h := new(SSEHandler)
+	srv := testSSEServer(t, h)
+
+	tests := []struct {
+		method, session string
+		status          int
+	}{
+		{http.MethodGet, "", http.StatusBadRequest},
+		{http.MethodGet, "unknown", http.StatusNotFound},
+		{http.MethodPost, "unknown", http.StatusNotFound},
+		{http.MethodDelete, "unknown", http.StatusNotFound},
+		{http.MethodPut, "", http.StatusMethodNotAllowed},
+	}
+	for _, test := range tests {
+		req, _ := http.NewRequest(test.method, srv.URL, strings.NewReader(`{}`))
+		if test.session != "" {
+			req.Header.Set(SessionHeader, test.session)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != test.status {
+			t.Errorf("%s %q: expected %d got %s", test.method, test.session, test.status, resp.Status)
+		}
+	}
+}
+
+func TestSSEHandlerSessionLimits(t *testing.T) {
+	h := &SSEHandler{MaxSessions: 1, IdleTimeout: 50 * time.Millisecond}
+	srv := testSSEServer(t, h)
+	post := func(body string) *http.Response {
+		resp, err := http.Post(srv.URL, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+	sessions := func() int {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		return len(h.sessions)
+	}
+
+	for _, body := range []string{``, `not json`, `{}`, `[]`, `[{"jsonrpc":"2.0","method":"echo"}, 1]`} {
+		if resp := post(body); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%q: expected 400 got %s", body, resp.Status)
+		}
+	}
+	if n := sessions(); n != 0 {
+		t.Fatalf("messages that can't be parsed must not start sessions, got %d", n)
+	}
+
+	notif := `{"jsonrpc":"2.0","method":"echo"}`
+	id := post(notif).Header.Get(SessionHeader)
+	if resp := post(notif); resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 past MaxSessions got %s", resp.Status)
+	}
+
+	// An open stream keeps the session alive.
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	req.Header.Set(SessionHeader, id)
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if _, ok := h.Session(id); !ok {
+		t.Error("a session with an open stream must not expire")
+	}
+	cancel()
+	resp.Body.Close()
+
+	s, ok := h.Session(id)
+	if !ok {
+		t.Fatal("the session expired too early")
+	}
+	select {
+	case <-s.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("the idle session should have been closed")
+	}
+	if resp := post(notif); resp.StatusCode != http.StatusAccepted {
+		t.Errorf("expected a new session once the idle one expired, got %s", resp.Status)
+	}
+}
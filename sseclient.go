@@ -0,0 +1,408 @@
+package gojsonrpc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultSSERetryDelay is how long SSETransport waits before reopening a
+// broken event stream when neither RetryDelay nor the server sets it.
+const DefaultSSERetryDelay = time.Second
+
+// SSETransport is a RoundTripper for servers using SSEHandler. Messages are
+// POSTed to URL, and replies are read from the session's event stream, which
+// is opened after the first POST and reopened with Last-Event-ID whenever it
+// breaks, so that no event is missed as long as the server still buffers it.
+// Batches aren't supported. A signature in the context of RoundTrip (see
+// Signer.Transport) is sent in the SignatureHeader.
+type SSETransport struct {
+	// URL is the endpoint of the SSEHandler.
+	URL string
+	// HTTPClient is used for all requests. If nil, http.DefaultClient is
+	// used. It must not time out the long-lived event stream.
+	HTTPClient *http.Client
+	// Header is added to all requests.
+	Header http.Header
+	// Parser parses the messages received.
+	Parser Parser
+	// RetryDelay is how long to wait before reopening a broken event stream,
+	// unless the server sets it with a retry field. If zero,
+	// DefaultSSERetryDelay is used.
+	RetryDelay time.Duration
+	// OnNotification, if set, is called with each notification sent by the
+	// server, in order, from the goroutine reading the stream.
+	OnNotification func(notif *Notification)
+
+	startMu     sync.Mutex
+	mu          sync.Mutex
+	sessionID   string
+	lastEventID string
+	retry       time.Duration
+	waiting     map[uint]chan *Response
+	streaming   bool
+	err         error
+	done        chan struct{}
+	cancel      context.CancelFunc
+}
+
+// SessionID returns the ID of the session, or "" before the first message is
+// sent.
+func (t *SSETransport) SessionID() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.sessionID
+}
+
+// RoundTrip implements RoundTripper.
+func (t *SSETransport) RoundTrip(ctx context.Context, message []byte) ([]byte, error) {
+	msg, err := t.Parser.ParseIncoming(string(message))
+	if err != nil {
+		return nil, err
+	}
+
+	var wait chan *Response
+	req, isRequest := msg.(*Request)
+	if isRequest {
+		wait = make(chan *Response, 1)
+		if err = t.await(req.ID(), wait); err != nil {
+			return nil, err
+		}
+		defer t.forget(req.ID())
+	}
+
+	if err = t.post(ctx, message); err != nil {
+		return nil, err
+	}
+	if !isRequest {
+		return nil, nil
+	}
+
+	t.mu.Lock()
+	done := t.done
+	t.mu.Unlock()
+	select {
+	case resp := <-wait:
+		return json.Marshal(resp)
+	case <-done:
+		return nil, t.closeError()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (t *SSETransport) await(id uint, wait chan *Response) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.err != nil {
+		return t.err
+	}
+	t.initLocked()
+	t.waiting[id] = wait
+	return nil
+}
+
+func (t *SSETransport) initLocked() {
+	if t.done == nil {
+		t.waiting = make(map[uint]chan *Response)
+		t.done = make(chan struct{})
+	}
+}
+
+func (t *SSETransport) forget(id uint) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.waiting, id)
+}
+
+func (t *SSETransport) closeError() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.err
+}
+
+func (t *SSETransport) client() *http.Client {
+	if t.HTTPClient != nil {
+		return t.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+func (t *SSETransport) newRequest(ctx context.Context, method string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, t.URL, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	for k, v := range t.Header {
+		req.Header[k] = v
+	}
+
+	t.mu.Lock()
+	if t.sessionID != "" {
+		req.Header.Set(SessionHeader, t.sessionID)
+	}
+	t.mu.Unlock()
+	return req, nil
+}
+
+// post sends message, starting the event stream once the session is known.
+func (t *SSETransport) post(ctx context.Context, message []byte) error {
+	if t.SessionID() == "" {
+		// Concurrent first messages must not start several sessions.
+		t.startMu.Lock()
+		defer t.startMu.Unlock()
+	}
+
+	req, err := t.newRequest(ctx, http.MethodPost, bytes.NewReader(message))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if sig, ok := SignatureFromContext(ctx); ok {
+		req.Header.Set(SignatureHeader, sig.String())
+	}
+
+	resp, err := t.client().Do(req)
+	if err != nil {
+		return err
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("HTTP %s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.err != nil {
+		return t.err
+	}
+	if t.sessionID == "" {
+		t.sessionID = resp.Header.Get(SessionHeader)
+	}
+	if !t.streaming && t.sessionID != "" {
+		t.streaming = true
+		t.initLocked()
+		var streamCtx context.Context
+		streamCtx, t.cancel = context.WithCancel(context.Background())
+		go t.readStream(streamCtx)
+	}
+	return nil
+}
+
+// readStream reads the event stream until the transport is closed, reopening
+// it when it breaks.
+func (t *SSETransport) readStream(ctx context.Context) {
+	for {
+		gone, err := t.readStreamOnce(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if gone {
+			t.fail(fmt.Errorf("%w: %v", ErrSessionClosed, err))
+			return
+		}
+
+		t.mu.Lock()
+		delay := t.retry
+		t.mu.Unlock()
+		if delay == 0 {
+			delay = t.RetryDelay
+		}
+		if delay == 0 {
+			delay = DefaultSSERetryDelay
+		}
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// readStreamOnce opens the event stream and reads it until it breaks. gone
+// tells whether the session no longer exists.
+func (t *SSETransport) readStreamOnce(ctx context.Context) (gone bool, err error) {
+	req, err := t.newRequest(ctx, http.MethodGet, nil)
+	if err != nil {
+		return true, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	t.mu.Lock()
+	if t.lastEventID != "" {
+		req.Header.Set("Last-Event-ID", t.lastEventID)
+	}
+	t.mu.Unlock()
+
+	resp, err := t.client().Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return true, fmt.Errorf("HTTP %s", resp.Status)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("HTTP %s", resp.Status)
+	}
+
+	r := bufio.NewReader(resp.Body)
+	var id string
+	var data []string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return false, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		if line == "" {
+			if data != nil {
+				t.handleEvent(id, []byte(strings.Join(data, "\n")))
+			}
+			id, data = "", nil
+			continue
+		}
+		if line[0] == ':' {
+			continue
+		}
+
+		field, value := line, ""
+		if colon := strings.IndexByte(line, ':'); colon >= 0 {
+			field, value = line[:colon], strings.TrimPrefix(line[colon+1:], " ")
+		}
+		switch field {
+		case "id":
+			id = value
+		case "data":
+			data = append(data, value)
+		case "retry":
+			if ms, err := strconv.Atoi(value); err == nil {
+				t.mu.Lock()
+				t.retry = time.Duration(ms) * time.Millisecond
+				t.mu.Unlock()
+			}
+		}
+	}
+}
+
+// handleEvent passes the messages in data to the calls waiting for them or to
+// OnNotification.
+func (t *SSETransport) handleEvent(id string, data []byte) {
+	if id != "" {
+		t.mu.Lock()
+		t.lastEventID = id
+		t.mu.Unlock()
+	}
+
+	messages := []json.RawMessage{data}
+	if data = bytes.TrimSpace(data); len(data) != 0 && data[0] == '[' {
+		if json.Unmarshal(data, &messages) != nil {
+			return
+		}
+	}
+
+	for _, raw := range messages {
+		msg, err := t.Parser.ParseIncoming(string(raw))
+		if err != nil {
+			continue
+		}
+
+		switch m := msg.(type) {
+		case *Notification:
+			if t.OnNotification != nil {
+				t.OnNotification(m)
+			}
+		case *Response:
+			if m.HasNullID() {
+				if m.IsError() {
+					t.failWaiting(m)
+				}
+				continue
+			}
+			t.mu.Lock()
+			wait, ok := t.waiting[m.ID()]
+			t.mu.Unlock()
+			if ok {
+				select {
+				case wait <- m:
+				default:
+				}
+			}
+		}
+	}
+}
+
+// failWaiting passes resp, an error the server couldn't match to a call
+// because it couldn't parse a message, to all the pending calls: it is the
+// reply to the only one, or to any of them.
+func (t *SSETransport) failWaiting(resp *Response) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, wait := range t.waiting {
+		select {
+		case wait <- resp:
+		default:
+		}
+	}
+}
+
+// fail ends all pending and future calls with err.
+func (t *SSETransport) fail(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.err != nil {
+		return
+	}
+	t.err = err
+	if t.done != nil {
+		close(t.done)
+	}
+}
+
+// Close ends the session and stops reading the event stream. Pending calls
+// return ErrSessionClosed.
+func (t *SSETransport) Close() error {
+	t.fail(ErrSessionClosed)
+
+	t.mu.Lock()
+	cancel, sessionID := t.cancel, t.sessionID
+	t.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+	if sessionID == "" {
+		return nil
+	}
+
+	req, err := http.NewRequest(http.MethodDelete, t.URL, nil)
+	if err != nil {
+		return err
+	}
+	for k, v := range t.Header {
+		req.Header[k] = v
+	}
+	req.Header.Set(SessionHeader, sessionID)
+	resp, err := t.client().Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
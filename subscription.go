@@ -0,0 +1,284 @@
+package gojsonrpc
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+)
+
+// SlowPolicy is what a subscription does when its buffer is full because the
+// client doesn't read its notifications fast enough.
+type SlowPolicy int
+
+const (
+	// DropNotifications drops the notifications published while the buffer
+	// is full. Publish returns ErrSubscriptionFull.
+	DropNotifications SlowPolicy = iota
+	// BlockPublisher makes Publish wait for room in the buffer.
+	BlockPublisher
+	// DisconnectPeer closes the client's connection, ending all of its
+	// subscriptions. Publish returns ErrSubscriptionFull.
+	DisconnectPeer
+)
+
+// DefaultSubscriptionBufferSize is the number of notifications buffered per
+// subscription when Subscriptions.BufferSize is zero.
+const DefaultSubscriptionBufferSize = 64
+
+// Subscription errors.
+var (
+	ErrNoPeer             = errors.New("gojsonrpc: no connection to send notifications on")
+	ErrSubscriptionClosed = errors.New("gojsonrpc: subscription closed")
+	ErrSubscriptionFull   = errors.New("gojsonrpc: subscription buffer full")
+)
+
+// Subscriptions manages streams of notifications sent to clients, in the style
+// of Ethereum's eth_subscribe: a handler calls Subscribe and returns the ID
+// of the new Subscription as its result, then publishes values on it. Each
+// value is sent as a notification for Method, with params
+//
+//	{"subscription": id, "result": value}
+//
+// Subscriptions end when Unsubscribe is called, or when the client's
+// connection closes. Notifications published before the response to the
+// subscribe request is sent are held back until it has been, on transports
+// that support it (Server, SSEHandler and PipeEnd.Serve). They are queued
+// whatever the BufferSize and Policy, so that the subscribe handler never
+// blocks on, or loses, its own notifications.
+//
+// Fields must be set before Subscribe is first called.
+type Subscriptions struct {
+	// Method is the method of the notifications, e.g. "eth_subscription".
+	Method string
+	// BufferSize is the number of notifications buffered per subscription.
+	// If zero, DefaultSubscriptionBufferSize is used.
+	BufferSize int
+	// Policy is what happens when a buffer is full.
+	Policy SlowPolicy
+
+	mu   sync.Mutex
+	subs map[string]*Subscription
+}
+
+// Subscription is a stream of notifications sent to a client.
+type Subscription struct {
+	id    string
+	subs  *Subscriptions
+	peer  Peer
+	queue chan *Notification
+	ready chan struct{}
+	done  chan struct{}
+	once  sync.Once
+
+	mu      sync.Mutex
+	replied bool
+	early   []*Notification // Published before the reply was sent.
+}
+
+// Subscribe starts a subscription for the client whose message is being
+// handled with ctx. It returns ErrNoPeer if the transport doesn't provide a
+// Peer.
+func (s *Subscriptions) Subscribe(ctx context.Context) (*Subscription, error) {
+	peer, ok := PeerFromContext(ctx)
+	if !ok {
+		return nil, ErrNoPeer
+	}
+
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return nil, err
+	}
+	size := s.BufferSize
+	if size <= 0 {
+		size = DefaultSubscriptionBufferSize
+	}
+	sub := &Subscription{
+		id:    "0x" + hex.EncodeToString(b[:]),
+		subs:  s,
+		peer:  peer,
+		queue: make(chan *Notification, size),
+		ready: make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+
+	s.mu.Lock()
+	if s.subs == nil {
+		s.subs = make(map[string]*Subscription)
+	}
+	s.subs[sub.id] = sub
+	s.mu.Unlock()
+
+	go sub.deliver()
+	afterReply(ctx, func() {
+		sub.mu.Lock()
+		sub.replied = true
+		sub.mu.Unlock()
+		close(sub.ready)
+	})
+	return sub, nil
+}
+
+// Get returns the subscription with the given ID.
+func (s *Subscriptions) Get(id string) (*Subscription, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sub, ok := s.subs[id]
+	return sub, ok
+}
+
+// Len returns the number of live subscriptions.
+func (s *Subscriptions) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.subs)
+}
+
+// Unsubscribe ends the subscription with the given ID, if it belongs to the
+// client whose message is being handled with ctx. It reports whether there was
+// such a subscription.
+func (s *Subscriptions) Unsubscribe(ctx context.Context, id string) bool {
+	sub, ok := s.Get(id)
+	if !ok {
+		return false
+	}
+	if peer, _ := PeerFromContext(ctx); peer != sub.peer {
+		return false
+	}
+	sub.Close()
+	return true
+}
+
+// UnsubscribeHandler returns a HandlerFunc for an unsubscribe method taking
+// the subscription ID as its only param, e.g. eth_unsubscribe. Its result
+// tells whether the subscription was found.
+func (s *Subscriptions) UnsubscribeHandler() HandlerFunc {
+	return func(ctx context.Context, params interface{}) (interface{}, *Error) {
+		list, ok := params.([]interface{})
+		if !ok || len(list) != 1 {
+			return nil, MakeError(CodeInvalidParams, "Invalid params", "expected [subscription ID]")
+		}
+		id, ok := list[0].(string)
+		if !ok {
+			return nil, MakeError(CodeInvalidParams, "Invalid params", "the subscription ID must be a string")
+		}
+		return s.Unsubscribe(ctx, id), nil
+	}
+}
+
+// ID returns the subscription's ID.
+func (sub *Subscription) ID() string {
+	return sub.id
+}
+
+// Done is closed once the subscription has ended.
+func (sub *Subscription) Done() <-chan struct{} {
+	return sub.done
+}
+
+// Publish sends result to the client. What happens if the subscription's
+// buffer is full depends on the Policy; with BlockPublisher, Publish returns
+// ctx's error if ctx ends first. Before the response to the subscribe request
+// has been sent, result is queued whatever the Policy. It returns
+// ErrSubscriptionClosed if the subscription has ended.
+func (sub *Subscription) Publish(ctx context.Context, result interface{}) error {
+	notif, err := MakeNotification(sub.subs.Method, map[string]interface{}{
+		"subscription": sub.id,
+		"result":       result,
+	})
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-sub.done:
+		return ErrSubscriptionClosed
+	default:
+	}
+
+	sub.mu.Lock()
+	if !sub.replied {
+		sub.early = append(sub.early, notif)
+		sub.mu.Unlock()
+		return nil
+	}
+	sub.mu.Unlock()
+
+	if sub.subs.Policy == BlockPublisher {
+		select {
+		case sub.queue <- notif:
+			return nil
+		case <-sub.done:
+			return ErrSubscriptionClosed
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	select {
+	case sub.queue <- notif:
+		return nil
+	default:
+	}
+	if sub.subs.Policy == DisconnectPeer {
+		sub.peer.Close()
+		sub.Close()
+	}
+	return ErrSubscriptionFull
+}
+
+// Close ends the subscription. Notifications still buffered are dropped.
+func (sub *Subscription) Close() {
+	sub.once.Do(func() {
+		close(sub.done)
+
+		s := sub.subs
+		s.mu.Lock()
+		delete(s.subs, sub.id)
+		s.mu.Unlock()
+	})
+}
+
+// deliver sends the buffered notifications, once the response to the
+// subscribe request has been sent, until the subscription or the connection
+// ends.
+func (sub *Subscription) deliver() {
+	select {
+	case <-sub.ready:
+	case <-sub.done:
+		return
+	case <-sub.peer.Done():
+		sub.Close()
+		return
+	}
+
+	// Nothing is added to early once the reply has been sent.
+	sub.mu.Lock()
+	early := sub.early
+	sub.early = nil
+	sub.mu.Unlock()
+	for _, notif := range early {
+		if err := sub.peer.Send(notif); err != nil {
+			sub.Close()
+			return
+		}
+	}
+
+	for {
+		select {
+		case notif := <-sub.queue:
+			if err := sub.peer.Send(notif); err != nil {
+				sub.Close()
+				return
+			}
+		case <-sub.done:
+			return
+		case <-sub.peer.Done():
+			sub.Close()
+			return
+		}
+	}
+}
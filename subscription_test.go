@@ -0,0 +1,288 @@
+package gojsonrpc
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testSubscriptionServer serves "subscribe", which publishes its params on a
+// new subscription before returning, and "unsubscribe" on a pipe.
+func testSubscriptionServer(t *testing.T, subs *Subscriptions) (client *PipeEnd, served chan error) {
+	d := new(Dispatcher)
+	d.Register("subscribe", func(ctx context.Context, params interface{}) (interface{}, *Error) {
+		sub, err := subs.Subscribe(ctx)
+		if err != nil {
+			return nil, AsError(err)
+		}
+		for _, v := range params.([]interface{}) {
+			sub.Publish(ctx, v)
+		}
+		return sub.ID(), nil
+	})
+	d.Register("unsubscribe", subs.UnsubscribeHandler())
+
+	client, server := NewPipe()
+	client.Serialize = true
+	served = make(chan error, 1)
+	go func() { served <- server.Serve(context.Background(), d) }()
+	t.Cleanup(func() { client.Close() })
+	return client, served
+}
+
+func testReceive(t *testing.T, end *PipeEnd) Message {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	msg, err := end.Receive(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func testCall(t *testing.T, end *PipeEnd, method string, params interface{}, id uint) interface{} {
+	req, err := MakeRequest(method, params, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = end.Send(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	resp, ok := testReceive(t, end).(*Response)
+	if !ok || resp.ID() != id {
+		t.Fatalf("%s: expected response %d got %v", method, id, resp)
+	}
+	if resp.IsError() {
+		t.Fatalf("%s: %v", method, resp.Error())
+	}
+	return resp.Result()
+}
+
+func TestSubscriptions(t *testing.T) {
+	subs := &Subscriptions{Method: "sub"}
+	client, _ := testSubscriptionServer(t, subs)
+
+	// The response comes before the notifications published by the handler.
+	id := testCall(t, client, "subscribe", []interface{}{"a", "b"}, 1).(string)
+	for _, expected := range []string{"a", "b"} {
+		notif, ok := testReceive(t, client).(*Notification)
+		if !ok || notif.Method() != "sub" {
+			t.Fatalf("expected a notification got %v", notif)
+		}
+		params := notif.Params().(map[string]interface{})
+		if params["subscription"] != id || params["result"] != expected {
+			t.Errorf("expected %s for %s got %v", expected, id, params)
+		}
+	}
+
+	sub, ok := subs.Get(id)
+	if !ok || subs.Len() != 1 {
+		t.Fatal("the subscription should be live")
+	}
+	if err := sub.Publish(context.Background(), "c"); err != nil {
+		t.Fatal(err)
+	}
+	if notif := testReceive(t, client).(*Notification); notif.Params().(map[string]interface{})["result"] != "c" {
+		t.Errorf("expected c got %v", notif.Params())
+	}
+
+	if found := testCall(t, client, "unsubscribe", []string{id}, 2); found != true {
+		t.Errorf("expected the subscription to be found")
+	}
+	if found := testCall(t, client, "unsubscribe", []string{id}, 3); found != false {
+		t.Errorf("expected the subscription to be gone")
+	}
+	if err := sub.Publish(context.Background(), "d"); err != ErrSubscriptionClosed {
+		t.Errorf("expected ErrSubscriptionClosed got %v", err)
+	}
+	if subs.Len() != 0 {
+		t.Errorf("expected no subscriptions got %d", subs.Len())
+	}
+}
+
+func TestSubscriptionsPublishBeforeReply(t *testing.T) {
+	for _, policy := range []SlowPolicy{DropNotifications, BlockPublisher, DisconnectPeer} {
+		subs := &Subscriptions{Method: "sub", BufferSize: 2, Policy: policy}
+		client, _ := testSubscriptionServer(t, subs)
+
+		// More values than BufferSize are published before the handler
+		// returns, and none of them is lost.
+		values := []interface{}{"a", "b", "c"}
+		id := testCall(t, client, "subscribe", values, 1)
+		for _, expected := range values {
+			notif, ok := testReceive(t, client).(*Notification)
+			if !ok || notif.Params().(map[string]interface{})["result"] != expected {
+				t.Fatalf("policy %d: expected %s got %v", policy, expected, notif)
+			}
+		}
+		if sub, ok := subs.Get(id.(string)); !ok {
+			t.Errorf("policy %d: the subscription should be live", policy)
+		} else {
+			sub.Close()
+		}
+	}
+}
+
+func TestSubscriptionsEndWithConnection(t *testing.T) {
+	subs := &Subscriptions{Method: "sub"}
+	client, served := testSubscriptionServer(t, subs)
+	id := testCall(t, client, "subscribe", []interface{}{}, 1).(string)
+	sub, _ := subs.Get(id)
+
+	client.Close()
+	<-served
+	select {
+	case <-sub.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("the subscription should end with the connection")
+	}
+	if subs.Len() != 0 {
+		t.Errorf("expected no subscriptions got %d", subs.Len())
+	}
+}
+
+func TestSubscriptionsOtherPeer(t *testing.T) {
+	subs := &Subscriptions{Method: "sub"}
+	client, _ := testSubscriptionServer(t, subs)
+	other, _ := testSubscriptionServer(t, subs)
+
+	id := testCall(t, client, "subscribe", []interface{}{}, 1).(string)
+	if found := testCall(t, other, "unsubscribe", []string{id}, 1); found != false {
+		t.Error("a client must not end another client's subscriptions")
+	}
+	if _, err := subs.Subscribe(context.Background()); err != ErrNoPeer {
+		t.Errorf("expected ErrNoPeer got %v", err)
+	}
+}
+
+// testSlowPeer is a Peer whose Send blocks until release is closed.
+type testSlowPeer struct {
+	release chan struct{}
+	done    chan struct{}
+	once    sync.Once
+}
+
+func newTestSlowPeer() *testSlowPeer {
+	return &testSlowPeer{release: make(chan struct{}), done: make(chan struct{})}
+}
+
+func (p *testSlowPeer) Send(msg Message) error {
+	select {
+	case <-p.release:
+		return nil
+	case <-p.done:
+		return ErrSubscriptionClosed
+	}
+}
+
+func (p *testSlowPeer) Close() error {
+	p.once.Do(func() { close(p.done) })
+	return nil
+}
+
+func (p *testSlowPeer) Done() <-chan struct{} {
+	return p.done
+}
+
+// testFill publishes until the subscription's buffer is full, returning the
+// error of the last Publish.
+func testFill(t *testing.T, sub *Subscription, ctx context.Context) error {
+	// One notification may be held by the blocked Send, and one buffered.
+	for i := 0; i < 3; i++ {
+		if err := sub.Publish(ctx, i); err != nil {
+			return err
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("the buffer should be full")
+	return nil
+}
+
+func TestSubscriptionSlowPolicies(t *testing.T) {
+	for _, policy := range []SlowPolicy{DropNotifications, BlockPublisher, DisconnectPeer} {
+		subs := &Subscriptions{Method: "sub", BufferSize: 1, Policy: policy}
+		peer := newTestSlowPeer()
+		sub, err := subs.Subscribe(ContextWithPeer(context.Background(), peer))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		err = testFill(t, sub, ctx)
+		cancel()
+
+		switch policy {
+		case DropNotifications:
+			if err != ErrSubscriptionFull {
+				t.Errorf("drop: expected ErrSubscriptionFull got %v", err)
+			}
+			close(peer.release)
+			time.Sleep(10 * time.Millisecond)
+			if err = sub.Publish(context.Background(), "later"); err != nil {
+				t.Errorf("drop: expected room once the peer catches up, got %v", err)
+			}
+		case BlockPublisher:
+			if err != context.DeadlineExceeded {
+				t.Errorf("block: expected DeadlineExceeded got %v", err)
+			}
+			close(peer.release)
+			if err = sub.Publish(context.Background(), "later"); err != nil {
+				t.Errorf("block: expected Publish to go through, got %v", err)
+			}
+		case DisconnectPeer:
+			if err != ErrSubscriptionFull {
+				t.Errorf("disconnect: expected ErrSubscriptionFull got %v", err)
+			}
+			select {
+			case <-peer.Done():
+			default:
+				t.Error("disconnect: the peer should be closed")
+			}
+			if err = sub.Publish(context.Background(), "later"); err != ErrSubscriptionClosed {
+				t.Errorf("disconnect: expected ErrSubscriptionClosed got %v", err)
+			}
+		}
+		sub.Close()
+		peer.Close()
+	}
+}
+
+func TestSubscriptionsOverServer(t *testing.T) {
+	subs := &Subscriptions{Method: "sub"}
+	d := new(Dispatcher)
+	d.Register("subscribe", func(ctx context.Context, params interface{}) (interface{}, *Error) {
+		sub, err := subs.Subscribe(ctx)
+		if err != nil {
+			return nil, AsError(err)
+		}
+		sub.Publish(ctx, 1)
+		return sub.ID(), nil
+	})
+
+	clientConn, serverConn := net.Pipe()
+	s := &Server{Dispatcher: d}
+	go s.ServeConn(serverConn)
+	defer clientConn.Close()
+
+	NewlineFraming.WriteFrame(clientConn, []byte(`{"jsonrpc":"2.0","method":"subscribe","id":1}`))
+	r := newTestFrameReader(clientConn)
+	resp, _ := r()
+	notif, _ := r()
+	if msg, err := ParseIncoming(string(resp)); err != nil || msg.(*Response).ID() != 1 {
+		t.Fatalf("expected the response first, got %s", resp)
+	}
+	if msg, err := ParseIncoming(string(notif)); err != nil || msg.(*Notification).Method() != "sub" {
+		t.Fatalf("expected a notification, got %s", notif)
+	}
+
+	clientConn.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for subs.Len() != 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if subs.Len() != 0 {
+		t.Error("the subscription should end with the connection")
+	}
+}
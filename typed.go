@@ -0,0 +1,283 @@
+package gojsonrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+var (
+	contextType         = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorPtrType        = reflect.TypeOf((*Error)(nil))
+	timeType            = reflect.TypeOf(time.Time{})
+	rawMessageType      = reflect.TypeOf(json.RawMessage(nil))
+	jsonMarshalerType   = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	errInvalidTypedFunc = errors.New("handler must be a func(context.Context[, P]) (R, *Error) where P is a struct or a pointer to one")
+)
+
+// typedParam is a parameter of a typed handler: a field of its params struct.
+type typedParam struct {
+	name     string
+	typ      reflect.Type
+	required bool
+}
+
+// typedMethod is what RegisterFunc knows about a method, from the types of its
+// handler.
+type typedMethod struct {
+	params     []typedParam
+	paramsType reflect.Type // nil for handlers without params.
+	resultType reflect.Type
+}
+
+// RegisterFunc sets the handler for method to fn, which must have the form
+//
+//	func(ctx context.Context, params P) (result R, err *Error)
+//
+// or the same without params. P must be a struct, or a pointer to one, whose
+// fields are the method's parameters, named as encoding/json would name them.
+// Params may be given by name, as an object decoded into P, or by position,
+// as an array whose elements are decoded into the fields of P in order. Fields
+// that aren't pointers and aren't tagged omitempty are required. Params that
+// can't be decoded are answered with a CodeInvalidParams error.
+//
+// The types of P and R are used to describe the method in the document
+// returned by OpenRPC.
+func (d *Dispatcher) RegisterFunc(method string, fn interface{}) error {
+	v := reflect.ValueOf(fn)
+	if !v.IsValid() {
+		return errInvalidTypedFunc
+	}
+	t := v.Type()
+	if t.Kind() != reflect.Func || t.NumIn() < 1 || t.NumIn() > 2 || t.NumOut() != 2 ||
+		t.In(0) != contextType || t.Out(1) != errorPtrType || t.IsVariadic() {
+		return errInvalidTypedFunc
+	}
+
+	m := &typedMethod{resultType: t.Out(0)}
+	if t.NumIn() == 2 {
+		m.paramsType = t.In(1)
+		structType := m.paramsType
+		if structType.Kind() == reflect.Ptr {
+			structType = structType.Elem()
+		}
+		if structType.Kind() != reflect.Struct {
+			return errInvalidTypedFunc
+		}
+		m.params = typedParams(structType, nil)
+	}
+
+	d.Register(method, func(ctx context.Context, params interface{}) (interface{}, *Error) {
+		in := []reflect.Value{reflect.ValueOf(ctx)}
+		if m.paramsType != nil {
+			p, err := m.decodeParams(params)
+			if err != nil {
+				return nil, MakeError(CodeInvalidParams, "Invalid params", err.Error())
+			}
+			in = append(in, p)
+		}
+
+		out := v.Call(in)
+		if rpcErr := out[1].Interface().(*Error); rpcErr != nil {
+			return nil, rpcErr
+		}
+		return out[0].Interface(), nil
+	})
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.typed == nil {
+		d.typed = make(map[string]*typedMethod)
+	}
+	d.typed[method] = m
+	return nil
+}
+
+// typedParams lists the fields of t as encoding/json sees them, including the
+// fields of embedded structs, or pointers to structs, without a JSON name.
+// embedding holds the types t is embedded in, to stop at cycles.
+func typedParams(t reflect.Type, embedding map[reflect.Type]bool) []typedParam {
+	var params []typedParam
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts := tag, ""
+		if comma := strings.IndexByte(tag, ','); comma >= 0 {
+			name, opts = tag[:comma], tag[comma:]
+		}
+
+		if embedded := f.Type; f.Anonymous && name == "" {
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				if embedded != t && !embedding[embedded] {
+					if embedding == nil {
+						embedding = make(map[reflect.Type]bool)
+					}
+					embedding[t] = true
+					params = append(params, typedParams(embedded, embedding)...)
+					delete(embedding, t)
+				}
+				continue
+			}
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		params = append(params, typedParam{
+			name:     name,
+			typ:      f.Type,
+			required: f.Type.Kind() != reflect.Ptr && !strings.Contains(opts, ",omitempty"),
+		})
+	}
+
+	return params
+}
+
+// decodeParams converts params into a value of m.paramsType.
+func (m *typedMethod) decodeParams(params interface{}) (reflect.Value, error) {
+	structType := m.paramsType
+	if structType.Kind() == reflect.Ptr {
+		structType = structType.Elem()
+	}
+	p := reflect.New(structType)
+
+	present := make(map[string]bool)
+	switch params := params.(type) {
+	case nil:
+	case []interface{}:
+		if len(params) > len(m.params) {
+			return reflect.Value{}, fmt.Errorf("expected at most %d params, got %d", len(m.params), len(params))
+		}
+		for i, elem := range params {
+			// Decoded as a member, so that encoding/json allocates embedded
+			// pointers and reaches fields of unexported embedded structs.
+			param := m.params[i]
+			raw, err := json.Marshal(map[string]interface{}{param.name: elem})
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			if err = json.Unmarshal(raw, p.Interface()); err != nil {
+				if typeErr, ok := err.(*json.UnmarshalTypeError); ok {
+					// The param is already named in the message.
+					typeErr.Struct, typeErr.Field = "", ""
+				}
+				return reflect.Value{}, fmt.Errorf("param %s: %v", param.name, err)
+			}
+			present[param.name] = true
+		}
+	default:
+		raw, err := json.Marshal(params)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.DisallowUnknownFields()
+		if err = dec.Decode(p.Interface()); err != nil {
+			return reflect.Value{}, err
+		}
+
+		var members map[string]json.RawMessage
+		if err = json.Unmarshal(raw, &members); err != nil {
+			return reflect.Value{}, err
+		}
+		for _, param := range m.params {
+			// encoding/json matches names case insensitively.
+			for name := range members {
+				if strings.EqualFold(name, param.name) {
+					present[param.name] = true
+				}
+			}
+		}
+	}
+
+	for _, param := range m.params {
+		if param.required && !present[param.name] {
+			return reflect.Value{}, fmt.Errorf("missing param %s", param.name)
+		}
+	}
+
+	if m.paramsType.Kind() == reflect.Ptr {
+		return p, nil
+	}
+	return p.Elem(), nil
+}
+
+// typeSchema returns a JSON Schema describing the JSON encoding of t.
+// Recursive types are described down to the first repeated type, which is
+// left unconstrained.
+func typeSchema(t reflect.Type, seen map[reflect.Type]bool) map[string]interface{} {
+	if seen[t] {
+		return map[string]interface{}{}
+	}
+
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t == rawMessageType, t.Implements(jsonMarshalerType), reflect.PtrTo(t).Implements(jsonMarshalerType):
+		return map[string]interface{}{}
+	case t.Implements(textMarshalerType), reflect.PtrTo(t).Implements(textMarshalerType):
+		return map[string]interface{}{"type": "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return map[string]interface{}{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Ptr:
+		return typeSchema(t.Elem(), seen)
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 && t.Kind() == reflect.Slice {
+			return map[string]interface{}{"type": "string", "contentEncoding": "base64"}
+		}
+		s := map[string]interface{}{"type": "array", "items": typeSchema(t.Elem(), seen)}
+		if t.Kind() == reflect.Array {
+			s["minItems"], s["maxItems"] = t.Len(), t.Len()
+		}
+		return s
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem(), seen)}
+	case reflect.Struct:
+		seen[t] = true
+		defer delete(seen, t)
+
+		properties := make(map[string]interface{})
+		required := []interface{}{}
+		for _, param := range typedParams(t, nil) {
+			properties[param.name] = typeSchema(param.typ, seen)
+			if param.required {
+				required = append(required, param.name)
+			}
+		}
+		s := map[string]interface{}{"type": "object", "properties": properties}
+		if len(required) > 0 {
+			s["required"] = required
+		}
+		return s
+	}
+
+	// Interfaces, and types encoding/json can't encode.
+	return map[string]interface{}{}
+}
@@ -0,0 +1,136 @@
+package gojsonrpc
+
+import (
+	"context"
+	"testing"
+)
+
+type testAddParams struct {
+	A    int     `json:"a"`
+	B    int     `json:"b"`
+	Note *string `json:"note"`
+}
+
+func testTypedDispatcher(t *testing.T) *Dispatcher {
+	d := new(Dispatcher)
+	err := d.RegisterFunc("add", func(ctx context.Context, p testAddParams) (int, *Error) {
+		if p.Note != nil {
+			return 0, MakeError(1, *p.Note, nil)
+		}
+		return p.A + p.B, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.RegisterFunc("ping", func(ctx context.Context) (string, *Error) {
+		return "pong", nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestRegisterFunc(t *testing.T) {
+	d := testTypedDispatcher(t)
+
+	testDispatch(t, d,
+		`{"jsonrpc":"2.0", "method":"add", "params":{"a":1, "b":2}, "id":1}`,
+		`{"jsonrpc":"2.0","result":3,"id":1}`)
+	testDispatch(t, d,
+		`{"jsonrpc":"2.0", "method":"add", "params":[1, 2], "id":2}`,
+		`{"jsonrpc":"2.0","result":3,"id":2}`)
+	testDispatch(t, d,
+		`{"jsonrpc":"2.0", "method":"add", "params":[1, 2, "failed"], "id":3}`,
+		`{"jsonrpc":"2.0","error":{"code":1,"message":"failed"},"id":3}`)
+	testDispatch(t, d,
+		`{"jsonrpc":"2.0", "method":"ping", "id":4}`,
+		`{"jsonrpc":"2.0","result":"pong","id":4}`)
+}
+
+func TestRegisterFuncInvalidParams(t *testing.T) {
+	d := testTypedDispatcher(t)
+	messages := map[string]string{
+		`{"jsonrpc":"2.0", "method":"add", "params":{"a":1}, "id":1}`:               "missing param b",
+		`{"jsonrpc":"2.0", "method":"add", "params":[1], "id":1}`:                   "missing param b",
+		`{"jsonrpc":"2.0", "method":"add", "id":1}`:                                 "missing param a",
+		`{"jsonrpc":"2.0", "method":"add", "params":[1, 2, "x", 4], "id":1}`:        "expected at most 3 params, got 4",
+		`{"jsonrpc":"2.0", "method":"add", "params":{"a":1, "b":2, "c":3}, "id":1}`: `json: unknown field "c"`,
+		`{"jsonrpc":"2.0", "method":"add", "params":["1", 2], "id":1}`:              "param a: json: cannot unmarshal string into Go value of type int",
+	}
+
+	for message, data := range messages {
+		resp := d.Dispatch(context.Background(), message)
+		if resp == nil || !resp.IsError() || resp.Error().Code() != CodeInvalidParams {
+			t.Errorf("%s: expected an invalid params error, got %v", message, resp)
+			continue
+		}
+		if resp.Error().Data() != data {
+			t.Errorf("%s: expected data %q got %q", message, data, resp.Error().Data())
+		}
+	}
+}
+
+type TestPage struct {
+	Limit int `json:"limit"`
+}
+
+type testSearchParams struct {
+	*TestPage
+	Query string `json:"query"`
+}
+
+func TestRegisterFuncEmbeddedPointer(t *testing.T) {
+	d := new(Dispatcher)
+	err := d.RegisterFunc("search", func(ctx context.Context, p testSearchParams) (int, *Error) {
+		if p.TestPage == nil {
+			return 0, nil
+		}
+		return p.Limit, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testDispatch(t, d,
+		`{"jsonrpc":"2.0", "method":"search", "params":[5, "q"], "id":1}`,
+		`{"jsonrpc":"2.0","result":5,"id":1}`)
+	testDispatch(t, d,
+		`{"jsonrpc":"2.0", "method":"search", "params":{"query":"q", "limit":7}, "id":2}`,
+		`{"jsonrpc":"2.0","result":7,"id":2}`)
+
+	var names []string
+	for _, param := range d.OpenRPC(OpenRPCInfo{}).Methods[0].Params {
+		names = append(names, param.Name)
+	}
+	if len(names) != 2 || names[0] != "limit" || names[1] != "query" {
+		t.Errorf("expected params [limit query] got %v", names)
+	}
+
+	// A plain handler replaces the typed signature.
+	d.Register("search", func(ctx context.Context, params interface{}) (interface{}, *Error) {
+		return nil, nil
+	})
+	if params := d.OpenRPC(OpenRPCInfo{}).Methods[0].Params; len(params) != 0 {
+		t.Errorf("expected the untyped method to have no params got %v", params)
+	}
+}
+
+func TestRegisterFuncInvalid(t *testing.T) {
+	funcs := []interface{}{
+		nil,
+		1,
+		func() (int, *Error) { return 0, nil },
+		func(ctx context.Context) int { return 0 },
+		func(ctx context.Context) (int, error) { return 0, nil },
+		func(ctx context.Context, a int) (int, *Error) { return 0, nil },
+		func(ctx context.Context, p testAddParams, q testAddParams) (int, *Error) { return 0, nil },
+		func(ctx context.Context, p ...testAddParams) (int, *Error) { return 0, nil },
+	}
+
+	for _, fn := range funcs {
+		if err := new(Dispatcher).RegisterFunc("test", fn); err != errInvalidTypedFunc {
+			t.Errorf("%T: expected %v got %v", fn, errInvalidTypedFunc, err)
+		}
+	}
+}
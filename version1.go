@@ -0,0 +1,178 @@
+package gojsonrpc
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// Version1RequestValidAndExpectedKeys is a map whose keys are all the possible
+// fields in a JSON-RPC 1.0 request or notification, mapped to whether they are
+// required fields. A 1.0 notification is a request whose id is null.
+var Version1RequestValidAndExpectedKeys = map[string]bool{"method": true, "params": false, "id": true}
+
+// Version1ResponseValidAndExpectedKeys is a map whose keys are all the possible
+// fields in a JSON-RPC 1.0 response, mapped to whether they are required
+// fields. Unlike 2.0, both result and error must be present, with the unused
+// one set to null.
+var Version1ResponseValidAndExpectedKeys = map[string]bool{"result": true, "error": true, "id": true}
+
+// messageDataV1 is the wire format of 1.0 requests and notifications. ID is a
+// pointer so that notifications marshal with a null id.
+type messageDataV1 struct {
+	Method string      `json:"method"`
+	Params interface{} `json:"params"`
+	ID     *uint       `json:"id"`
+}
+
+// responseDataV1 is the wire format of 1.0 responses. Neither field is
+// omitted, so the unused one marshals to null.
+type responseDataV1 struct {
+	Result interface{} `json:"result"`
+	Err    *Error      `json:"error"`
+	ID     *uint       `json:"id"`
+}
+
+// MakeRequestV1 behaves like MakeRequest, but the returned Request uses the
+// JSON-RPC 1.0 dialect.
+func MakeRequestV1(method string, params interface{}, id uint) (*Request, error) {
+	r, err := MakeRequest(method, params, id)
+	if err != nil {
+		return nil, err
+	}
+
+	r.requestData.Jsonrpc = Version1
+	return r, nil
+}
+
+// MakeNotificationV1 behaves like MakeNotification, but the returned
+// Notification uses the JSON-RPC 1.0 dialect (a request with a null id).
+func MakeNotificationV1(method string, params interface{}) (*Notification, error) {
+	n, err := MakeNotification(method, params)
+	if err != nil {
+		return nil, err
+	}
+
+	n.notificationData.Jsonrpc = Version1
+	return n, nil
+}
+
+// 1.0 requires params to be present, so nil params are sent as an empty array.
+func paramsV1(params interface{}) interface{} {
+	if params == nil {
+		return []interface{}{}
+	}
+
+	return params
+}
+
+func isNullJSON(raw json.RawMessage) bool {
+	return bytes.Equal(bytes.TrimSpace(raw), []byte("null"))
+}
+
+func parseIncomingV1(incomingMap map[string]json.RawMessage, alloc allocator, unmarshal func([]byte, interface{}) error) (Message, error) {
+	var keys []string
+	for k := range incomingMap {
+		keys = append(keys, k)
+	}
+
+	if AreKeySetsMatching(keys, Version1RequestValidAndExpectedKeys) {
+		return parseIncomingRequestV1(incomingMap, alloc, unmarshal)
+	} else if AreKeySetsMatching(keys, Version1ResponseValidAndExpectedKeys) {
+		return parseIncomingResponseV1(incomingMap, alloc, unmarshal)
+	}
+
+	return nil, InvalidMessage
+}
+
+func parseIncomingRequestV1(incomingMap map[string]json.RawMessage, alloc allocator, unmarshal func([]byte, interface{}) error) (Message, error) {
+	var method string
+	if err := json.Unmarshal(incomingMap[MethodKey], &method); err != nil {
+		return nil, err
+	}
+
+	var params interface{}
+	if rawParams, ok := incomingMap[ParamsKey]; ok {
+		if err := unmarshal(rawParams, &params); err != nil {
+			return nil, err
+		}
+
+		// Params must be a JSON array or object.
+		normalized, valid := normalizeParams(params)
+		if !valid {
+			return nil, InvalidMessage
+		}
+		params = normalized
+	}
+
+	if isNullJSON(incomingMap[IDKey]) {
+		notif := alloc.notification()
+		notif.notificationData = notificationData{
+			Jsonrpc: Version1,
+			Method:  method,
+			Params:  params,
+		}
+		return notif, nil
+	}
+
+	var id uint
+	if err := json.Unmarshal(incomingMap[IDKey], &id); err != nil {
+		return nil, err
+	}
+
+	req := alloc.request()
+	req.requestData = requestData{
+		Jsonrpc: Version1,
+		Method:  method,
+		Params:  params,
+		ID:      id,
+	}
+	return req, nil
+}
+
+func parseIncomingResponseV1(incomingMap map[string]json.RawMessage, alloc allocator, unmarshal func([]byte, interface{}) error) (Message, error) {
+	// A null id is allowed here: 1.0 servers use it when the request's id could
+	// not be read.
+	var id *uint
+	if err := json.Unmarshal(incomingMap[IDKey], &id); err != nil {
+		return nil, err
+	}
+
+	resp := alloc.response()
+
+	if !isNullJSON(incomingMap[ErrorKey]) {
+		if !isNullJSON(incomingMap[ResultKey]) {
+			return nil, InvalidMessage
+		}
+
+		var errorMap map[string]json.RawMessage
+		if err := json.Unmarshal(incomingMap[ErrorKey], &errorMap); err != nil {
+			return nil, err
+		}
+
+		var errKeys []string
+		for k := range errorMap {
+			errKeys = append(errKeys, k)
+		}
+		if !isValidResponseError(errKeys) {
+			return nil, InvalidMessage
+		}
+
+		e := new(Error)
+		if err := unmarshal(incomingMap[ErrorKey], &e.errorData); err != nil {
+			return nil, err
+		}
+
+		resp.responseData = responseData{Err: e, _type: responseTypeError}
+	} else {
+		var result interface{}
+		if err := unmarshal(incomingMap[ResultKey], &result); err != nil {
+			return nil, err
+		}
+
+		resp.responseData = responseData{Result: result, _type: responseTypeResult}
+	}
+
+	resp.responseData.Jsonrpc = Version1
+	resp.responseData.ID = id
+	return resp, nil
+}
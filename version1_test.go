@@ -0,0 +1,227 @@
+package gojsonrpc
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+var testParserV1 = &Parser{AllowVersion1: true}
+
+func TestParseIncomingV1RejectedByDefault(t *testing.T) {
+	rawMsg := `{"method":"test", "params":[], "id":1}`
+	if _, err := ParseIncoming(rawMsg); err != InvalidMessage {
+		t.Error("should have returned invalid message error")
+	}
+}
+
+func TestParseIncomingV1Request(t *testing.T) {
+	rawMsg := `{"method":"test", "params":["a", 1], "id":4}`
+	msg, err := testParserV1.ParseIncoming(rawMsg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, ok := msg.(*Request)
+	if !ok {
+		t.Fatal("should have returned request")
+	}
+	if r.JSONRPCVersion() != Version1 {
+		t.Errorf("expected version %s got %s", Version1, r.JSONRPCVersion())
+	}
+	if r.Method() != "test" {
+		t.Error("method not set correctly")
+	}
+	if r.ID() != 4 {
+		t.Error("id not set correctly")
+	}
+}
+
+func TestParseIncomingV1RequestWithVersionField(t *testing.T) {
+	rawMsg := `{"jsonrpc":"1.0", "method":"test", "params":[], "id":4}`
+	msg, err := testParserV1.ParseIncoming(rawMsg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r, ok := msg.(*Request); !ok {
+		t.Error("should have returned request")
+	} else if r.JSONRPCVersion() != Version1 {
+		t.Errorf("expected version %s got %s", Version1, r.JSONRPCVersion())
+	}
+}
+
+func TestParseIncomingV1Notification(t *testing.T) {
+	rawMsg := `{"method":"test", "params":[], "id":null}`
+	msg, err := testParserV1.ParseIncoming(rawMsg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n, ok := msg.(*Notification); !ok {
+		t.Error("should have returned notification")
+	} else if n.JSONRPCVersion() != Version1 {
+		t.Errorf("expected version %s got %s", Version1, n.JSONRPCVersion())
+	}
+}
+
+func TestParseIncomingV1RequestWithStringID(t *testing.T) {
+	rawMsg := `{"method":"test", "params":[], "id":"curltest"}`
+	if msg, err := testParserV1.ParseIncoming(rawMsg); err == nil {
+		t.Errorf("should have rejected string id, got %v", msg)
+	}
+}
+
+func TestParseIncomingV1WithInvalidParams(t *testing.T) {
+	rawMsg := `{"method":"test", "params":"test1", "id":1}`
+	if _, err := testParserV1.ParseIncoming(rawMsg); err != InvalidMessage {
+		t.Error("should have returned invalid message error")
+	}
+}
+
+func TestParseIncomingV1ResultResponse(t *testing.T) {
+	rawMsg := `{"result":"test", "error":null, "id":1}`
+	msg, err := testParserV1.ParseIncoming(rawMsg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r, ok := msg.(*Response); !ok {
+		t.Error("should have returned response")
+	} else if !r.IsResult() || r.Result() != "test" {
+		t.Error("should have returned result response")
+	}
+}
+
+func TestParseIncomingV1NullResultResponse(t *testing.T) {
+	rawMsg := `{"result":null, "error":null, "id":1}`
+	msg, err := testParserV1.ParseIncoming(rawMsg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r, ok := msg.(*Response); !ok {
+		t.Error("should have returned response")
+	} else if !r.IsResult() || r.Result() != nil {
+		t.Error("should have returned null result response")
+	}
+}
+
+func TestParseIncomingV1ErrorResponse(t *testing.T) {
+	rawMsg := `{"result":null, "error":{"code":-1, "message":"test"}, "id":1}`
+	msg, err := testParserV1.ParseIncoming(rawMsg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r, ok := msg.(*Response); !ok {
+		t.Error("should have returned response")
+	} else if !r.IsError() || r.Error().Code() != -1 {
+		t.Error("should have returned error response")
+	}
+}
+
+func TestParseIncomingV1ResponseWithResultAndError(t *testing.T) {
+	rawMsg := `{"result":1, "error":{"code":-1, "message":"test"}, "id":1}`
+	if _, err := testParserV1.ParseIncoming(rawMsg); err != InvalidMessage {
+		t.Error("should have returned invalid message error")
+	}
+}
+
+func TestParseIncomingV1ResponseWithoutError(t *testing.T) {
+	rawMsg := `{"result":1, "id":1}`
+	if _, err := testParserV1.ParseIncoming(rawMsg); err != InvalidMessage {
+		t.Error("should have returned invalid message error")
+	}
+}
+
+func TestParserStillParsesV2(t *testing.T) {
+	rawMsg := `{"jsonrpc":"2.0", "method":"test", "id":1}`
+	msg, err := testParserV1.ParseIncoming(rawMsg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r, ok := msg.(*Request); !ok {
+		t.Error("should have returned request")
+	} else if r.JSONRPCVersion() != Version {
+		t.Errorf("expected version %s got %s", Version, r.JSONRPCVersion())
+	}
+}
+
+func TestMarshalRequestV1(t *testing.T) {
+	r, err := MakeRequestV1(testRequestMethod, nil, testRequestId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jsonReq, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedJSON := `{"method":"test","params":[],"id":1}`
+	if string(jsonReq) != expectedJSON {
+		t.Errorf("expected %s, got %s\n", expectedJSON, jsonReq)
+	}
+}
+
+func TestMarshalNotificationV1(t *testing.T) {
+	n, err := MakeNotificationV1(testNotificationMethod, []interface{}{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	jsonNotif, err := json.Marshal(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedJSON := `{"method":"test","params":[1],"id":null}`
+	if string(jsonNotif) != expectedJSON {
+		t.Errorf("expected %s, got %s\n", expectedJSON, jsonNotif)
+	}
+}
+
+func TestMarshalResponseV1(t *testing.T) {
+	msg, err := testParserV1.ParseIncoming(`{"method":"test", "params":[], "id":7}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := msg.(*Request)
+
+	jsonResp, err := json.Marshal(req.MakeResponseWithResult("ok"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedJSON := `{"result":"ok","error":null,"id":7}`
+	if string(jsonResp) != expectedJSON {
+		t.Errorf("expected %s, got %s\n", expectedJSON, jsonResp)
+	}
+
+	resp, err := req.MakeResponseWithError(MakeError(-1, "test", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	jsonResp, err = json.Marshal(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedJSON = `{"result":null,"error":{"code":-1,"message":"test"},"id":7}`
+	if string(jsonResp) != expectedJSON {
+		t.Errorf("expected %s, got %s\n", expectedJSON, jsonResp)
+	}
+}
+
+func TestMarshalResponseToV2Request(t *testing.T) {
+	req, err := MakeRequest(testRequestMethod, nil, testRequestId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jsonResp, err := json.Marshal(req.MakeResponseWithResult("ok"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedJSON := `{"jsonrpc":"2.0","result":"ok","id":1}`
+	if string(jsonResp) != expectedJSON {
+		t.Errorf("expected %s, got %s\n", expectedJSON, jsonResp)
+	}
+}